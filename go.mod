@@ -7,6 +7,7 @@ require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gin-gonic/gin v1.10.1
 	github.com/liuzl/gocc v0.0.0-20231231122217-0372e1059ca5
+	github.com/mozillazg/go-pinyin v0.21.0
 	github.com/yanyiwu/gojieba v1.4.6
 	github.com/yuin/goldmark v1.5.6
 	gopkg.in/yaml.v3 v3.0.1
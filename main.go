@@ -2,35 +2,58 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
+	"embed"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template/parse"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/liuzl/gocc"
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 	"gopkg.in/yaml.v3"
 
 	"github.com/emirpasic/gods/maps/treemap"
 	"github.com/emirpasic/gods/utils"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
+	"github.com/mozillazg/go-pinyin"
 	"github.com/yanyiwu/gojieba"
 )
 
@@ -53,6 +76,21 @@ type Config struct {
 	IncludesDir string `yaml:"includes_dir"`
 	PostsDir    string `yaml:"posts_dir"`
 
+	// 主题：本地主题目录路径，或 themes/<name> 下的主题名称
+	Theme string `yaml:"theme"`
+
+	// 排除的文件和目录（相对源目录，支持通配符），不作为页面加载也不监听
+	Exclude []string `yaml:"exclude"`
+
+	// 多语言
+	DefaultLang string               `yaml:"default_lang"` // 默认语言代码
+	Languages   map[string]*Language `yaml:"languages"`    // 语言代码 -> 语言配置
+	I18nDir     string               `yaml:"i18n_dir"`     // 翻译文件目录
+
+	// 繁简镜像：zh-hant 把默认语言的内容转为繁体输出到 /zh-hant/，zh-hans 转为简体输出到 /zh-hans/，
+	// auto 按默认语言选择另一种字形
+	ChineseMirror string `yaml:"chinese_mirror"`
+
 	// 内容处理
 	MarkdownExt      string `yaml:"markdown_ext"`
 	Permalink        string `yaml:"permalink"`
@@ -62,11 +100,31 @@ type Config struct {
 	RecentPosts      int    `yaml:"recent_posts"`
 	ExcerptLink      string `yaml:"excerpt_link"`
 	Titlecase        bool   `yaml:"titlecase"`
+	SimplifyTitles   bool   `yaml:"simplify_titles"` // 把文章标题和摘要转为简体显示，前置数据 simplify 可按文章覆盖
+
+	// 构建配置
+	Jobs          int  `yaml:"jobs"`            // 渲染和写入的并发数，0 表示使用 GOMAXPROCS
+	Incremental   bool `yaml:"incremental"`     // 增量构建：只重新渲染受影响的输出
+	GzipStatic    bool `yaml:"gzip_static"`     // 为 HTML、CSS、JS、XML、JSON 输出写入 .gz 预压缩副本，供 nginx gzip_static 使用
+	GzipMinLength int  `yaml:"gzip_min_length"` // 预压缩和服务器即时压缩的最小文件大小（字节）
+
+	// 搜索配置
+	SearchSnippetLength int             `yaml:"search_snippet_length"` // /api/search 结果片段的字符数
+	SearchCollections   map[string]bool `yaml:"search_collections"`    // 集合是否参与搜索（posts、pages），未列出的集合参与
 
 	// 服务器配置
-	Port    int    `yaml:"port"`
-	Host    string `yaml:"host"`
-	BaseURL string `yaml:"baseurl"`
+	Port         int         `yaml:"port"`
+	Host         string      `yaml:"host"`
+	BaseURL      string      `yaml:"baseurl"`
+	CacheControl []CacheRule `yaml:"cache_control"` // 按路径模式设置 Cache-Control，第一条匹配的规则生效
+
+	ReadTimeout  time.Duration `yaml:"read_timeout"`  // 读取整个请求的超时
+	WriteTimeout time.Duration `yaml:"write_timeout"` // 写入响应的超时，实时刷新连接不受限制
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`  // keep-alive 空闲连接的超时
+	CORSOrigins  []string      `yaml:"cors_origins"`  // 允许跨域调用 /api 的来源，"*" 表示任意来源；默认不允许跨域
+	BasicAuth    *BasicAuth    `yaml:"basic_auth"`    // 设置后所有请求都需要 HTTP 基本认证，用于预览部署
+	TLSCert      string        `yaml:"tls_cert"`      // TLS 证书文件，与 tls_key 同时设置时以 HTTPS 提供服务
+	TLSKey       string        `yaml:"tls_key"`       // TLS 私钥文件
 
 	// 其他配置
 	Title       string                 `yaml:"title"`
@@ -87,27 +145,35 @@ type Config struct {
 
 	// 内部使用
 	configPath string
+	overrides  func(*Config) // 命令行参数覆盖，重新加载配置后再次应用
 }
 
 // Defaults 返回默认配置
 func Defaults() *Config {
 	return &Config{
-		Source:      ".",
-		Destination: "_site",
-		CacheDir:    ".jekyll-cache",
-		LayoutsDir:  "_layouts",
-		DataDir:     "_data",
-		IncludesDir: "_includes",
-		PostsDir:    "_posts",
-		MarkdownExt: "markdown,mkdown,mkdn,mkd,md",
-		Permalink:   "date",
-		Port:        4000,
-		Host:        "127.0.0.1",
-		Title:       "Octopress 文档",
-		Description: "Octopress 静态博客框架文档",
-		Author:      "Octopress",
-		URL:         "http://localhost:4000",
-		Data:        make(map[string]interface{}),
+		Source:              ".",
+		Destination:         "_site",
+		CacheDir:            ".jekyll-cache",
+		LayoutsDir:          "_layouts",
+		DataDir:             "_data",
+		IncludesDir:         "_includes",
+		PostsDir:            "_posts",
+		I18nDir:             "_i18n",
+		DefaultLang:         "zh-CN",
+		MarkdownExt:         "markdown,mkdown,mkdn,mkd,md",
+		Permalink:           "date",
+		GzipMinLength:       1024,
+		SearchSnippetLength: 120,
+		Port:                4000,
+		Host:                "127.0.0.1",
+		ReadTimeout:         15 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         2 * time.Minute,
+		Title:               "Octopress 文档",
+		Description:         "Octopress 静态博客框架文档",
+		Author:              "Octopress",
+		URL:                 "http://localhost:4000",
+		Data:                make(map[string]interface{}),
 	}
 }
 
@@ -154,8 +220,11 @@ func (c *Config) loadFromFile() error {
 	}
 
 	if configFile == "" {
-		// 使用指定的配置文件路径
+		// 使用指定的配置文件路径；默认的 _config.yml 不存在时使用默认值
 		if c.configPath != "" {
+			if _, err := os.Stat(c.configPath); os.IsNotExist(err) && filepath.Base(c.configPath) == "_config.yml" {
+				return nil
+			}
 			configFile = c.configPath
 		} else {
 			return nil // 没有配置文件，使用默认值
@@ -174,6 +243,136 @@ func (c *Config) loadFromFile() error {
 	return nil
 }
 
+// Reload 重新读取配置文件并再次应用命令行参数，返回新的配置
+func (c *Config) Reload() (*Config, error) {
+	cfg, err := Load(c.configPath, c.Source, c.Destination)
+	if err != nil {
+		return nil, err
+	}
+	cfg.overrides = c.overrides
+	if cfg.overrides != nil {
+		cfg.overrides(cfg)
+	}
+	return cfg, nil
+}
+
+// IsConfigFile 判断路径是否是站点的配置文件
+func (c *Config) IsConfigFile(name string) bool {
+	absName, _ := filepath.Abs(name)
+	if c.configPath != "" {
+		if absConfig, _ := filepath.Abs(c.configPath); absConfig == absName {
+			return true
+		}
+	}
+	absSource, _ := filepath.Abs(c.Source)
+	switch filepath.Base(name) {
+	case "_config.yml", "_config.yaml", "_config.toml":
+		return filepath.Dir(absName) == absSource
+	}
+	return false
+}
+
+// IsExcluded 判断相对源目录的路径是否被 exclude 排除；排除目录时其下所有文件都被排除
+func (c *Config) IsExcluded(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, pattern := range c.Exclude {
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if relPath == pattern || strings.HasPrefix(relPath, pattern+"/") {
+			return true
+		}
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheRule 一条 Cache-Control 规则，模式的写法与 exclude 相同：目录前缀、完整路径或文件名通配符
+type CacheRule struct {
+	Pattern string `yaml:"pattern"` // 如 stylesheets、*.html、archives/*/index.html
+	Value   string `yaml:"value"`   // 如 public, max-age=31536000, immutable
+}
+
+// BasicAuth HTTP 基本认证的用户名和密码
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// AllowOrigin 返回跨域请求应回显的 Access-Control-Allow-Origin，来源不在 cors_origins 中时返回空字符串
+func (c *Config) AllowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range c.CORSOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Searchable 判断集合是否参与搜索，search_collections 中未列出的集合默认参与
+func (c *Config) Searchable(collection string) bool {
+	v, ok := c.SearchCollections[collection]
+	return !ok || v
+}
+
+// TLSFiles 返回证书和私钥路径，相对路径以源目录为基准；未启用 TLS 时返回空字符串
+func (c *Config) TLSFiles() (cert, key string) {
+	if c.TLSCert == "" || c.TLSKey == "" {
+		return "", ""
+	}
+	resolve := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(c.Source, name)
+	}
+	return resolve(c.TLSCert), resolve(c.TLSKey)
+}
+
+// CacheControlFor 返回请求路径匹配的 Cache-Control，没有匹配的规则时返回空字符串
+func (c *Config) CacheControlFor(reqPath string) string {
+	reqPath = strings.TrimPrefix(reqPath, "/")
+	for _, rule := range c.CacheControl {
+		pattern := strings.Trim(rule.Pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		if reqPath == pattern || strings.HasPrefix(reqPath, pattern+"/") {
+			return rule.Value
+		}
+		if ok, _ := path.Match(pattern, reqPath); ok {
+			return rule.Value
+		}
+		if ok, _ := path.Match(pattern, path.Base(reqPath)); ok {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+// isNotFoundPage 判断相对源目录的路径是否是根目录下的 404 页面（404.md 或 404.html，可带语言后缀）；
+// HTML 格式的 404 页面也作为页面经过布局渲染
+func (c *Config) isNotFoundPage(relPath string) bool {
+	if filepath.Dir(relPath) != "." {
+		return false
+	}
+	_, base := c.splitLanguageSuffix(filepath.Base(relPath))
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) == "404" && (strings.EqualFold(ext, ".html") || c.IsMarkdownFile(base))
+}
+
 // validate 验证配置
 func (c *Config) validate() error {
 	// 检查源目录是否存在
@@ -193,9 +392,174 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// 检查 Cache-Control 规则
+	for _, rule := range c.CacheControl {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("cache_control 模式无效: %s", rule.Pattern)
+		}
+	}
+
+	if c.SearchSnippetLength < 1 || c.SearchSnippetLength > searchMaxSnippet {
+		return fmt.Errorf("search_snippet_length 必须在 1 到 %d 之间", searchMaxSnippet)
+	}
+	for name := range c.SearchCollections {
+		if !slices.Contains(searchCollections, name) {
+			return fmt.Errorf("search_collections 中的集合未知: %s（可用: %s）", name, strings.Join(searchCollections, "、"))
+		}
+	}
+
+	// 检查繁简镜像
+	if c.ChineseMirror != "" {
+		m := c.chineseMirror()
+		if m == nil {
+			return fmt.Errorf("chinese_mirror 必须是 zh-hant、zh-hans 或 auto: %s", c.ChineseMirror)
+		}
+		for _, code := range c.LanguageCodes() {
+			if strings.EqualFold(code, m.Lang) || c.LanguagePrefix(code) == m.Prefix {
+				return fmt.Errorf("chinese_mirror 的 %s 与语言 %s 冲突", m.Prefix, code)
+			}
+		}
+	}
+
+	// 检查服务器设置
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return fmt.Errorf("read_timeout、write_timeout 和 idle_timeout 不能为负数")
+	}
+	if c.BasicAuth != nil && (c.BasicAuth.Username == "" || c.BasicAuth.Password == "") {
+		return fmt.Errorf("basic_auth 需要同时设置 username 和 password")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert 和 tls_key 需要同时设置")
+	}
+	if cert, key := c.TLSFiles(); cert != "" {
+		for _, name := range []string{cert, key} {
+			if _, err := os.Stat(name); err != nil {
+				return fmt.Errorf("TLS 文件不可读: %w", err)
+			}
+		}
+	}
+
+	// 检查主题目录是否存在
+	if c.Theme != "" && c.ThemeDir() == "" {
+		return fmt.Errorf("主题不存在: %s（已查找 %s 和 %s）", c.Theme,
+			filepath.Join(c.Source, c.Theme), filepath.Join(c.Source, "themes", c.Theme))
+	}
+
 	return nil
 }
 
+// ThemeDir 返回主题目录路径，未配置主题或主题不存在时返回空字符串
+func (c *Config) ThemeDir() string {
+	if c.Theme == "" {
+		return ""
+	}
+
+	// 优先按路径查找，其次查找 themes/<name>
+	candidates := []string{filepath.Join(c.Source, c.Theme), filepath.Join(c.Source, "themes", c.Theme)}
+	if filepath.IsAbs(c.Theme) {
+		candidates = []string{c.Theme}
+	}
+
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Language 表示一种站点语言的配置
+type Language struct {
+	Name        string `yaml:"name"`        // 显示名称，用于语言切换
+	Title       string `yaml:"title"`       // 该语言的站点标题，为空时使用全局标题
+	Description string `yaml:"description"` // 该语言的站点描述，为空时使用全局描述
+	Prefix      string `yaml:"prefix"`      // 永久链接前缀；默认语言默认为空，其他语言默认为 /<代码>
+}
+
+// LanguageCodes 返回所有语言代码，默认语言在前，其余按代码排序
+func (c *Config) LanguageCodes() []string {
+	codes := []string{c.DefaultLang}
+	var others []string
+	for code := range c.Languages {
+		if code != c.DefaultLang {
+			others = append(others, code)
+		}
+	}
+	sort.Strings(others)
+	return append(codes, others...)
+}
+
+// IsMultilingual 检查是否配置了多种语言
+func (c *Config) IsMultilingual() bool {
+	return len(c.LanguageCodes()) > 1
+}
+
+// HasLanguage 检查语言代码是否已配置
+func (c *Config) HasLanguage(code string) bool {
+	if code == c.DefaultLang {
+		return true
+	}
+	_, ok := c.Languages[code]
+	return ok
+}
+
+// LanguagePrefix 返回语言的永久链接前缀，形如 "/en"，默认语言通常为空
+func (c *Config) LanguagePrefix(code string) string {
+	prefix := ""
+	if lang, ok := c.Languages[code]; ok && lang != nil && lang.Prefix != "" {
+		prefix = lang.Prefix
+	} else if code != c.DefaultLang {
+		prefix = code
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// splitLanguageSuffix 识别文件名中的语言后缀，如 post.en.md 返回 "en" 和 post.md；
+// 只识别已配置的语言代码
+func (c *Config) splitLanguageSuffix(filename string) (lang, base string) {
+	ext := filepath.Ext(filename)
+	stem := strings.TrimSuffix(filename, ext)
+	suffix := filepath.Ext(stem)
+	if suffix == "" {
+		return "", filename
+	}
+
+	code := suffix[1:]
+	if !c.HasLanguage(code) {
+		return "", filename
+	}
+	return code, strings.TrimSuffix(stem, suffix) + ext
+}
+
+// JobCount 返回渲染和写入使用的工作协程数
+func (c *Config) JobCount() int {
+	if c.Jobs > 0 {
+		return c.Jobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// PaginationDir 返回分页页面所在的目录名，未设置 paginate_path 时为 page
+func (c *Config) PaginationDir() string {
+	if dir := strings.Trim(c.PaginatePath, "/"); dir != "" {
+		return dir
+	}
+	return "page"
+}
+
+// CachePath 返回构建缓存目录，相对路径基于源目录
+func (c *Config) CachePath() string {
+	if filepath.IsAbs(c.CacheDir) {
+		return c.CacheDir
+	}
+	return filepath.Join(c.Source, c.CacheDir)
+}
+
 // GetMarkdownExtensions 获取Markdown文件扩展名列表
 func (c *Config) GetMarkdownExtensions() []string {
 	exts := strings.Split(c.MarkdownExt, ",")
@@ -341,6 +705,86 @@ func (c *MarkdownConverter) Convert(content string) (string, error) {
 	return result, nil
 }
 
+// plainText 提取 Markdown 的纯文本用于搜索：保留各个块中的文字和代码，丢弃标记和原始 HTML，块之间以换行分隔
+func (c *MarkdownConverter) plainText(content string) string {
+	src := []byte(content)
+	doc := c.md.Parser().Parse(text.NewReader(src))
+
+	var buf bytes.Buffer
+	newline := func() {
+		if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				newline()
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte('\n')
+			}
+		case *ast.String:
+			if !bytes.HasPrefix(n.Value, []byte("&")) { // 排版扩展生成的 HTML 实体
+				buf.Write(n.Value)
+			}
+		case *ast.AutoLink:
+			buf.Write(n.Label(src))
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				buf.Write(seg.Value(src))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+var (
+	// htmlHiddenRegex 匹配不显示为正文的部分：注释、head、脚本、样式和模板
+	htmlHiddenRegex = regexp.MustCompile(`(?is)<!--.*?-->|<head\b.*?</head\s*>|<script\b.*?</script\s*>|<style\b.*?</style\s*>|<template\b.*?</template\s*>`)
+	htmlTagRegex    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlBlockTags 提取纯文本时在前后换行的块级标签，其余标签直接去掉，避免把行内的词拆开
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+// htmlPlainText 提取 HTML 页面的纯文本用于搜索：去掉注释、脚本、样式和标签，块级标签处换行，解析字符引用
+func htmlPlainText(content string) string {
+	content = htmlHiddenRegex.ReplaceAllString(content, "")
+	content = htmlTagRegex.ReplaceAllStringFunc(content, func(tag string) string {
+		if m := htmlTagNameRegex.FindStringSubmatch(tag); m != nil && htmlBlockTags[strings.ToLower(m[1])] {
+			return "\n"
+		}
+		return ""
+	})
+	content = string(util.ResolveEntityNames(util.ResolveNumericReferences([]byte(content))))
+
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // preprocessMarkdown 预处理Markdown内容
 func (c *MarkdownConverter) preprocessMarkdown(content string) string {
 	// 处理空行
@@ -508,6 +952,9 @@ type Page struct {
 	Description      string
 	Excerpt          string
 	ExcerptSeparator string
+	Lang             string      // 语言代码
+	TranslationKey   string      // 同一内容不同语言版本共享的键
+	Alternates       []Alternate // 其他语言版本（含自身），无翻译时为空
 }
 
 // NewPage 创建新的页面
@@ -542,6 +989,9 @@ func NewPage(path string, cfg *Config) (*Page, error) {
 		page.Date = time.Now()
 	}
 
+	// 识别语言
+	page.Lang, page.TranslationKey = detectLanguage(path, fm, cfg)
+
 	// 生成URL
 	page.generateURL(cfg)
 
@@ -599,7 +1049,10 @@ func (p *Page) generateURL(cfg *Config) {
 	// 计算相对路径
 	relPath, _ := filepath.Rel(cfg.Source, p.Path)
 
-	// 移除扩展名
+	// 移除语言后缀和扩展名
+	if _, base := cfg.splitLanguageSuffix(filepath.Base(relPath)); base != filepath.Base(relPath) {
+		relPath = filepath.Join(filepath.Dir(relPath), base)
+	}
 	relPath = strings.TrimSuffix(relPath, filepath.Ext(relPath))
 
 	// 转换为URL格式
@@ -607,6 +1060,23 @@ func (p *Page) generateURL(cfg *Config) {
 
 	// 添加.html扩展名
 	p.URL += ".html"
+
+	// 添加语言前缀
+	if prefix := cfg.LanguagePrefix(p.Lang); prefix != "" {
+		p.URL = strings.TrimPrefix(prefix, "/") + "/" + p.URL
+	}
+}
+
+// fingerprint 返回页面源内容和元数据的指纹，用于增量构建
+func (p *Page) fingerprint() string {
+	c := *p
+	c.RenderedContent = ""
+	return contentHash(c)
+}
+
+// isHTML 判断页面源文件是否是 HTML（如 404.html），HTML 页面不经过 Markdown 转换
+func (p *Page) isHTML() bool {
+	return strings.EqualFold(filepath.Ext(p.Path), ".html")
 }
 
 // generateExcerpt 生成摘要
@@ -638,6 +1108,26 @@ type Post struct {
 	ExcerptSeparator string
 	Slug             string
 	Permalink        string
+	Lang             string      // 语言代码
+	TranslationKey   string      // 同一内容不同语言版本共享的键
+	Alternates       []Alternate // 其他语言版本（含自身），无翻译时为空
+	SearchTitle      string      // 转为简体的标题，只用于标签云，显示仍使用 Title
+}
+
+// normalizedTitle 返回转为简体的标题；开发模式下加载时没有预先转换，在此转换
+func (p *Post) normalizedTitle() string {
+	if p.SearchTitle != "" {
+		return p.SearchTitle
+	}
+	return toSimplified(p.Title)
+}
+
+// simplifyPost 判断文章的标题和摘要是否转为简体显示：前置数据 simplify 优先，其次是 simplify_titles
+func (c *Config) simplifyPost(p *Post) bool {
+	if v, ok := p.FrontMatter["simplify"].(bool); ok {
+		return v
+	}
+	return c.SimplifyTitles
 }
 
 // 文件名格式正则表达式: YYYY-MM-DD-title.md
@@ -681,8 +1171,11 @@ func NewPost(path string, cfg *Config) (*Post, error) {
 		post.Layout = "post"
 	}
 
+	// 识别语言
+	post.Lang, post.TranslationKey = detectLanguage(path, fm, cfg)
+
 	// 只从文件名提取slug和title，不再处理日期
-	post.extractFromFilename()
+	post.extractFromFilename(cfg)
 
 	// 生成URL
 	post.generateURL(cfg)
@@ -719,8 +1212,8 @@ func (p *Post) extractFrontMatter() error {
 }
 
 // extractFromFilename 只处理slug和title，不再处理日期
-func (p *Post) extractFromFilename() {
-	filename := filepath.Base(p.Path)
+func (p *Post) extractFromFilename(cfg *Config) {
+	_, filename := cfg.splitLanguageSuffix(filepath.Base(p.Path))
 	matches := filenameRegex.FindStringSubmatch(filename)
 
 	if len(matches) >= 5 {
@@ -778,13 +1271,13 @@ func (p *Post) makeAbsoluteURL(relativeURL string, cfg *Config) string {
 		relativeURL = "/" + relativeURL
 	}
 
-	// 组合基础URL和路径
+	// 组合基础URL、语言前缀和路径
 	baseURL := cfg.URL
 	if strings.HasSuffix(baseURL, "/") {
 		baseURL = baseURL[:len(baseURL)-1] // 移除末尾的 /
 	}
 
-	return baseURL + relativeURL
+	return baseURL + cfg.LanguagePrefix(p.Lang) + relativeURL
 }
 
 // generateDateURL 生成日期格式的URL
@@ -861,6 +1354,13 @@ func (p *Post) extractRelativeURL() string {
 	return parsedURL.Path
 }
 
+// fingerprint 返回文章源内容和元数据的指纹，用于增量构建
+func (p *Post) fingerprint() string {
+	c := *p
+	c.RenderedContent = ""
+	return contentHash(c)
+}
+
 // generateExcerpt 生成摘要
 func (p *Post) generateExcerpt() {
 	if p.ExcerptSeparator == "" {
@@ -880,6 +1380,12 @@ type Layout struct {
 	Name    string
 	Content string
 	tmpl    *template.Template
+
+	// 源码映射：模板对应的原始文件，用于错误定位
+	Path       string // 相对于源目录的文件路径，如 _layouts/post.html
+	Source     string // 原始文件内容
+	LineOffset int    // 模板第1行在源文件中的行偏移（include 去除 define 包装后产生）
+	ColOffset  int    // 模板第1行在源文件中的列偏移
 }
 
 // Engine 表示模板引擎
@@ -920,42 +1426,271 @@ func (s *Site) initMasterTemplate() error {
 		"first":           s.Template.first,
 		"mul":             func(a, b int) int { return a * b },
 		"join":            s.Template.join,
+		"t":               s.translate,
+		"i18n":            s.translate,
 	})
 
-	// 解析所有布局文件和包含文件
-	for name, layout := range s.Layouts {
-		// Each layout/include is a named template within the master template set
-		_, err := s.MasterTemplate.Parse(fmt.Sprintf("{{define \"%s\"}}%s{{end}}", name, layout.Content))
-		if err != nil {
-			return fmt.Errorf("解析模板 %s 失败: %w", name, err)
+	// 解析所有布局文件和包含文件，按名称排序以保证错误输出顺序稳定
+	names := make([]string, 0, len(s.Layouts))
+	for name := range s.Layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 每个布局/包含文件直接作为同名模板解析，行号与源文件保持一致；
+	// 解析失败不会修改模板集合，因此可以继续解析其余文件并一次性报告所有错误
+	var errs []error
+	for _, name := range names {
+		layout := s.Layouts[name]
+		if _, err := s.MasterTemplate.New(name).Parse(layout.Content); err != nil {
+			errs = append(errs, s.templateError(err))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d 个模板解析失败:\n%w", len(errs), errors.Join(errs...))
+	}
+
+	// 主模板只用于克隆，渲染时从上下文池中取用各自的副本
+	s.renderPool = make(chan *renderContext, s.Config.JobCount())
+
 	log.Println("所有布局和包含文件已解析到主模板")
 	return nil
 }
 
-// Render 渲染模板
+// TemplateError 表示映射回源文件位置的模板错误
+type TemplateError struct {
+	File    string // 源文件路径
+	Line    int    // 源文件中的行号
+	Col     int    // 源文件中的列号（字节偏移），0 表示未知
+	Message string // 已将模板位置替换为源文件位置的错误信息
+	Excerpt string // 出错位置附近的源码片段
+	Err     error  // 原始错误
+}
+
+// Error 实现 error 接口
+func (e *TemplateError) Error() string {
+	if e.Excerpt == "" {
+		return e.Message
+	}
+	return e.Message + "\n" + e.Excerpt
+}
+
+// Unwrap 返回原始错误
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// templateLocationRegex 匹配 text/template 错误中的位置，如 "template: post:17:5:" 或 "template: post:17:"
+var templateLocationRegex = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::(\d+))?:`)
+
+// templateError 将模板错误中的位置映射回布局/包含文件，并附带源码片段
+func (s *Site) templateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var te *TemplateError
+	if errors.As(err, &te) {
+		return err
+	}
+
+	msg := err.Error()
+	matches := templateLocationRegex.FindAllStringSubmatchIndex(msg, -1)
+	if len(matches) == 0 {
+		return err
+	}
+
+	var out strings.Builder
+	var last *TemplateError
+	prev := 0
+	for _, m := range matches {
+		name := msg[m[2]:m[3]]
+		line, _ := strconv.Atoi(msg[m[4]:m[5]])
+		col := 0
+		if m[6] >= 0 {
+			col, _ = strconv.Atoi(msg[m[6]:m[7]])
+		}
+
+		layout, ok := s.Layouts[name]
+		if !ok || layout.Path == "" {
+			continue
+		}
+
+		// 换算为源文件中的位置
+		if line == 1 && col > 0 {
+			col += layout.ColOffset
+		}
+		line += layout.LineOffset
+
+		out.WriteString(msg[prev:m[0]])
+		if col > 0 {
+			fmt.Fprintf(&out, "%s:%d:%d:", layout.Path, line, col)
+		} else {
+			fmt.Fprintf(&out, "%s:%d:", layout.Path, line)
+		}
+		prev = m[1]
+
+		last = &TemplateError{File: layout.Path, Line: line, Col: col}
+		last.Excerpt = sourceExcerpt(layout.Source, line, col, 2)
+	}
+	if last == nil {
+		return err
+	}
+	out.WriteString(msg[prev:])
+
+	// 嵌套错误（如 include 内部出错）以最内层位置为准
+	last.Message = out.String()
+	last.Err = err
+	return last
+}
+
+// sourceExcerpt 返回指定行附近 context 行的源码，出错行以 ">" 标记，列位置以 "^" 标记
+func sourceExcerpt(source string, line, col, context int) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	start := line - context
+	if start < 1 {
+		start = 1
+	}
+	end := line + context
+	if end > len(lines) {
+		end = len(lines)
+	}
+	width := len(strconv.Itoa(end))
+
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, i, lines[i-1])
+		if i == line && col > 0 {
+			// text/template 的列号是从行首起算的字节偏移；制表符保留以便与源码对齐
+			pad := []byte(lines[i-1])
+			if col < len(pad) {
+				pad = pad[:col]
+			}
+			for j, c := range pad {
+				if c != '\t' {
+					pad[j] = ' '
+				}
+			}
+			fmt.Fprintf(&b, "  %*s | %s^\n", width, "", pad)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Render 渲染模板，可在多个协程中并发调用
 func (e *Engine) Render(layout *Layout, data map[string]interface{}) (string, error) {
+	rc, err := e.site.acquireRenderContext()
+	if err != nil {
+		return "", err
+	}
+	defer e.site.releaseRenderContext(rc)
+
 	// 渲染模板
 	var buf bytes.Buffer
-	if err := e.site.MasterTemplate.ExecuteTemplate(&buf, layout.Name, data); err != nil {
-		return "", fmt.Errorf("渲染模板 %s 失败: %w", layout.Name, err)
+	if err := rc.execute(&buf, layout.Name, data); err != nil {
+		return "", fmt.Errorf("渲染模板 %s 失败: %w", layout.Name, e.site.templateError(err))
+	}
+	if m := e.site.mirror; m != nil {
+		return m.convertHTML(buf.String()), nil
 	}
 
 	return buf.String(), nil
 }
 
-// include 包含文件
+// include 主模板中的占位函数，实际调用由渲染上下文中的同名函数处理
 func (e *Engine) include(filename string) (template.HTML, error) {
+	return "", fmt.Errorf("include %s 只能在渲染时调用", filename)
+}
+
+// renderContext 表示一个渲染上下文：主模板的独立副本及其当前渲染数据，
+// 同一时刻只被一个协程使用，include 因此可以读取当前页面的数据
+type renderContext struct {
+	tmpl *template.Template
+	data map[string]interface{}
+}
+
+// acquireRenderContext 从池中取出渲染上下文，池为空时克隆主模板新建一个
+func (s *Site) acquireRenderContext() (*renderContext, error) {
+	select {
+	case rc := <-s.renderPool:
+		return rc, nil
+	default:
+	}
+
+	rc := &renderContext{}
+	tmpl, err := s.MasterTemplate.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("克隆主模板失败: %w", err)
+	}
+	rc.tmpl = tmpl.Funcs(template.FuncMap{"include": rc.include})
+	return rc, nil
+}
+
+// releaseRenderContext 将渲染上下文放回池中，池已满时丢弃
+func (s *Site) releaseRenderContext(rc *renderContext) {
+	rc.data = nil
+	select {
+	case s.renderPool <- rc:
+	default:
+	}
+}
+
+// execute 使用当前上下文渲染命名模板
+func (rc *renderContext) execute(w io.Writer, name string, data map[string]interface{}) error {
+	rc.data = data
+	return rc.tmpl.ExecuteTemplate(w, name, data)
+}
+
+// include 包含文件，使用当前渲染的数据
+func (rc *renderContext) include(filename string) (template.HTML, error) {
 	// 渲染包含文件
 	var buf bytes.Buffer
-	if err := e.site.MasterTemplate.ExecuteTemplate(&buf, filename, e.site.CurrentData); err != nil {
+	if err := rc.tmpl.ExecuteTemplate(&buf, filename, rc.data); err != nil {
 		return "", fmt.Errorf("渲染包含文件 %s 失败: %w", filename, err)
 	}
 
 	return template.HTML(buf.String()), nil
 }
 
+// runParallel 在最多 jobs 个工作协程中执行 n 个任务；
+// 所有任务都会执行，错误按任务序号排列后合并返回，因此结果与串行执行一致
+func runParallel(jobs, n int, task func(i int) error) error {
+	if jobs > n {
+		jobs = n
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]error, n)
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				errs[i] = task(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 // date 格式化日期
 func (e *Engine) date(format string, date interface{}) string {
 	if d, ok := date.(time.Time); ok {
@@ -1134,1786 +1869,6485 @@ func (t *URLTree) collectPosts(node *URLNode, results *[]*Post) {
 	}
 }
 
-// ==================== 站点管理 ====================
+// ==================== 主题与分层文件 ====================
 
-// Site 表示Jekyll站点
-type Site struct {
-	Config         *Config
-	Pages          []*Page
-	Posts          []*Post
-	Layouts        map[string]*Layout
-	Data           map[string]interface{}
-	Converter      *MarkdownConverter
-	Template       *Engine
-	MasterTemplate *template.Template     // 存储所有解析后的模板
-	CurrentData    map[string]interface{} // 用于传递当前渲染数据给include
+// 主题可以提供的静态资源目录
+var staticDirs = []string{"stylesheets", "images", "js", "fonts", "assets"}
 
-	mu sync.RWMutex
-	// 新增分页和归档结构体
-	PagedPosts [][]*Post
-	Archives   map[string][]*Post // "2024-07" => []*Post
-	JiebaTags  []string           // 高频词标签云
-	RouteTree  *treemap.Map       // key: 路由path, value: 主路径
-	URLTree    *URLTree           // URL二叉树，用于搜索
+// defaultThemeFS 内置默认主题，作为最低优先级的文件层，保证空目录也能构建
+//
+//go:embed all:themes/default
+var defaultThemeFS embed.FS
 
-	// RSS 和 Sitemap 相关
-	RSSFeed    string // RSS feed 内容
-	SitemapXML string // Sitemap XML 内容
-}
+// defaultThemeRoot 内置默认主题在 defaultThemeFS 中的根目录
+const defaultThemeRoot = "themes/default"
 
-// New 创建新的站点实例
-func New(cfg *Config) *Site {
-	s := &Site{
-		Config:    cfg,
-		Pages:     make([]*Page, 0),
-		Posts:     make([]*Post, 0),
-		Layouts:   make(map[string]*Layout),
-		Data:      make(map[string]interface{}),
-		Converter: NewConverter(cfg),
-		URLTree:   NewURLTree(),
+// defaultThemeLayer 返回内置默认主题的文件层
+func defaultThemeLayer() fileLayer {
+	sub, err := fs.Sub(defaultThemeFS, defaultThemeRoot)
+	if err != nil {
+		panic(err) // 嵌入路径固定，不会出错
 	}
-	s.Template = NewEngine(cfg, s) // Pass the site instance to NewEngine
-	return s
+	return fileLayer{Name: "内置主题", Root: "<内置主题>", FS: sub}
 }
 
-// Build 构建站点
-func (s *Site) Build() error {
-	log.Println("开始构建站点...")
+// fileLayer 表示分层文件系统中的一层，如站点目录或主题目录
+type fileLayer struct {
+	Name string // 层名称，用于日志
+	Root string // 层根目录，用于拼接错误信息中的文件路径
+	FS   fs.FS
+}
 
-	// 1. 读取数据文件
-	if err := s.loadData(); err != nil {
-		return fmt.Errorf("加载数据失败: %w", err)
+// displayPath 返回层内文件用于日志和错误信息的路径
+func (l fileLayer) displayPath(name string) string {
+	if l.Root == "" || l.Root == "." {
+		return name
 	}
+	return filepath.ToSlash(filepath.Join(l.Root, name))
+}
 
-	// 2. 读取布局文件
-	if err := s.loadLayouts(); err != nil {
-		return fmt.Errorf("加载布局失败: %w", err)
-	}
+// fileLayers 返回按优先级从高到低排列的文件层：站点目录 > 主题目录 > 内置默认主题
+func (s *Site) fileLayers() []fileLayer {
+	layers := []fileLayer{{Name: "站点", FS: os.DirFS(s.Config.Source)}}
 
-	// 2.5. 读取包含文件
-	if err := s.loadIncludes(); err != nil {
-		return fmt.Errorf("加载包含文件失败: %w", err)
+	if themeDir := s.Config.ThemeDir(); themeDir != "" {
+		root := themeDir
+		if rel, err := filepath.Rel(s.Config.Source, themeDir); err == nil && !strings.HasPrefix(rel, "..") {
+			root = rel
+		}
+		layers = append(layers, fileLayer{Name: "主题 " + s.Config.Theme, Root: root, FS: os.DirFS(themeDir)})
 	}
 
-	// 3. 读取页面文件
-	if err := s.loadPages(); err != nil {
-		return fmt.Errorf("加载页面失败: %w", err)
-	}
+	return append(layers, defaultThemeLayer())
+}
 
-	// 4. 读取文章文件
-	if err := s.loadPosts(); err != nil {
-		return fmt.Errorf("加载文章失败: %w", err)
-	}
+// layeredFile 表示分层查找到的文件及其所在层
+type layeredFile struct {
+	Name  string // 层内的斜杠分隔路径，如 _layouts/post.html
+	Layer fileLayer
+}
 
-	// 4.5. 初始化MasterTemplate
-	if err := s.initMasterTemplate(); err != nil {
-		return fmt.Errorf("初始化主模板失败: %w", err)
+// walkLayered 列出所有层中 dir 目录下的文件，同名文件只保留优先级最高的一层，结果按路径排序
+func (s *Site) walkLayered(dir string) ([]layeredFile, error) {
+	dir = path.Clean(filepath.ToSlash(dir))
+	found := make(map[string]layeredFile)
+
+	// 从低优先级到高优先级遍历，高优先级覆盖低优先级
+	layers := s.fileLayers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		err := fs.WalkDir(layer.FS, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && name == dir {
+					return fs.SkipDir // 该层没有这个目录
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			found[name] = layeredFile{Name: name, Layer: layer}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("遍历%s目录 %s 失败: %w", layer.Name, dir, err)
+		}
 	}
 
-	// 5. 处理分页、归档、标签、分类数据
-	s.processCollections()
-
-	// 6. 构建Jieba标签云、路由树和URL二叉树
-	s.buildJiebaTags()
-	s.buildRouteTree()
-	s.buildURLTree()
+	files := make([]layeredFile, 0, len(found))
+	for _, f := range found {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
 
-	// 7. 渲染所有内容
-	if err := s.render(); err != nil {
-		return fmt.Errorf("渲染失败: %w", err)
+// isThemePath 检查源目录下的相对路径是否属于主题目录，加载页面时需要跳过
+func (s *Site) isThemePath(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "themes" || strings.HasPrefix(relPath, "themes/") {
+		return true
 	}
 
-	// 7. 写入输出目录
-	if err := s.write(); err != nil {
-		return fmt.Errorf("写入失败: %w", err)
+	themeDir := s.Config.ThemeDir()
+	if themeDir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(s.Config.Source, themeDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
 	}
+	rel = filepath.ToSlash(rel)
+	return relPath == rel || strings.HasPrefix(relPath, rel+"/")
+}
 
-	// 8. 生成 RSS Feed
-	if err := s.generateRSSFeed(); err != nil {
-		return fmt.Errorf("生成RSS Feed失败: %w", err)
+// createNewTheme 以内置默认主题为模板，在 themes/<name> 下生成主题骨架
+func createNewTheme(name string, cfg *Config) error {
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("无效的主题名称: %q", name)
 	}
 
-	// 9. 生成 Sitemap
-	if err := s.generateSitemap(); err != nil {
-		return fmt.Errorf("生成Sitemap失败: %w", err)
+	themeDir := filepath.Join(cfg.Source, "themes", name)
+	if _, err := os.Stat(themeDir); err == nil {
+		return fmt.Errorf("主题已存在: %s", themeDir)
 	}
 
-	// 10. 复制静态文件
-	if err := s.copyStaticFiles(); err != nil {
-		return fmt.Errorf("复制静态文件失败: %w", err)
+	for _, dir := range []string{"_data", "images", "js"} {
+		if err := os.MkdirAll(filepath.Join(themeDir, dir), 0755); err != nil {
+			return err
+		}
 	}
 
-	log.Printf("构建完成: %d 个页面, %d 篇文章", len(s.Pages), len(s.Posts))
-	return nil
+	_, err := copyEmbeddedTheme(themeDir, false)
+	return err
 }
 
-// loadData 加载数据文件
-func (s *Site) loadData() error {
-	dataDir := filepath.Join(s.Config.Source, s.Config.DataDir)
-	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
-		return nil // 数据目录不存在，跳过
-	}
-
-	return filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+// copyEmbeddedTheme 将内置默认主题复制到 dest 目录，返回已写入的文件；
+// overwrite 为 false 时跳过已存在的文件
+func copyEmbeddedTheme(dest string, overwrite bool) (written []string, err error) {
+	layer := defaultThemeLayer()
+	err = fs.WalkDir(layer.FS, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
-		if info.IsDir() {
-			return nil
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
 		}
-
-		// 只处理YAML文件
-		ext := filepath.Ext(path)
-		if ext != ".yml" && ext != ".yaml" {
-			return nil
+		if !overwrite {
+			if _, err := os.Stat(target); err == nil {
+				return nil
+			}
 		}
 
-		// 读取并解析数据文件
-		data, err := os.ReadFile(path)
+		data, err := fs.ReadFile(layer.FS, name)
 		if err != nil {
-			return fmt.Errorf("读取数据文件 %s 失败: %w", path, err)
+			return err
 		}
-
-		var fileData interface{}
-		if err := yaml.Unmarshal(data, &fileData); err != nil {
-			return fmt.Errorf("解析数据文件 %s 失败: %w", path, err)
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
 		}
-
-		// 使用文件名（不含扩展名）作为键
-		key := strings.TrimSuffix(filepath.Base(path), ext)
-		s.Data[key] = fileData
-
-		log.Printf("加载数据文件: %s", key)
+		written = append(written, name)
 		return nil
 	})
+	return written, err
 }
 
-// loadLayouts 加载布局文件
-func (s *Site) loadLayouts() error {
-	// 只从文件系统加载布局（不再加载嵌入式布局）
-	layoutsDir := filepath.Join(s.Config.Source, s.Config.LayoutsDir)
-	if _, err := os.Stat(layoutsDir); os.IsNotExist(err) {
-		return fmt.Errorf("布局目录不存在: %s，请手动补充布局文件", layoutsDir)
+// ejectDefaultTheme 将内置默认主题复制到站点目录，已存在的同名文件保持不变
+func ejectDefaultTheme(cfg *Config) error {
+	written, err := copyEmbeddedTheme(cfg.Source, false)
+	if err != nil {
+		return err
+	}
+	if len(written) == 0 {
+		fmt.Println("站点已包含内置主题的所有文件，无需导出")
+		return nil
+	}
+	for _, name := range written {
+		fmt.Println("已导出: " + name)
 	}
+	return nil
+}
 
-	return filepath.Walk(layoutsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// ==================== 国际化 ====================
 
-		if info.IsDir() {
-			return nil
-		}
+// Alternate 表示内容的一个语言版本，用于 hreflang 和语言切换
+type Alternate struct {
+	Lang string
+	Name string
+	URL  string
+}
 
-		// 只处理HTML文件
-		ext := filepath.Ext(path)
-		if ext != ".html" && ext != ".htm" {
-			return nil
-		}
+// detectLanguage 根据前置数据的 lang 键或文件名后缀识别内容语言，并返回翻译键
+func detectLanguage(path string, fm map[string]interface{}, cfg *Config) (lang, key string) {
+	suffixLang, base := cfg.splitLanguageSuffix(filepath.Base(path))
 
-		// 读取布局文件
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("读取布局文件 %s 失败: %w", path, err)
+	lang = cfg.DefaultLang
+	if suffixLang != "" {
+		lang = suffixLang
+	}
+	if fmLang, ok := fm["lang"].(string); ok && fmLang != "" {
+		if cfg.HasLanguage(fmLang) || !cfg.IsMultilingual() {
+			lang = fmLang
+		} else {
+			log.Printf("警告: %s 的语言 %s 未在 languages 中配置，使用默认语言 %s", path, fmLang, cfg.DefaultLang)
 		}
+	}
 
-		// 创建布局对象
-		layoutName := strings.TrimSuffix(filepath.Base(path), ext)
-		layout := NewLayout(layoutName, string(content))
-
-		s.mu.Lock()
-		s.Layouts[layoutName] = layout
-		s.mu.Unlock()
+	// 翻译键：优先使用前置数据中的 translation_key，否则使用去掉语言后缀和扩展名的相对路径
+	if k, ok := fm["translation_key"].(string); ok && k != "" {
+		return lang, k
+	}
+	rel, err := filepath.Rel(cfg.Source, filepath.Join(filepath.Dir(path), base))
+	if err != nil {
+		rel = base
+	}
+	return lang, filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+}
 
-		log.Printf("加载文件布局: %s", layoutName)
-		return nil
-	})
+// languageName 返回语言的显示名称；启用繁简镜像时未设置名称的默认语言显示为简体中文或繁體中文
+func (c *Config) languageName(code string) string {
+	if lang, ok := c.Languages[code]; ok && lang != nil && lang.Name != "" {
+		return lang.Name
+	}
+	if m := c.chineseMirror(); m != nil && code == m.SourceLang {
+		return m.SourceName
+	}
+	return code
 }
 
-// loadIncludes 加载包含文件
-func (s *Site) loadIncludes() error {
-	includesDir := filepath.Join(s.Config.Source, s.Config.IncludesDir)
-	if _, err := os.Stat(includesDir); os.IsNotExist(err) {
-		return nil // 包含目录不存在，跳过
+// loadTranslations 加载 _i18n/<lang>.yml 翻译文件（站点、主题和内置主题，站点优先）
+func (s *Site) loadTranslations() error {
+	s.Translations = make(map[string]map[string]interface{})
+
+	files, err := s.walkLayered(s.Config.I18nDir)
+	if err != nil {
+		return err
 	}
 
-	// 正则表达式匹配 {{ define "name" }} 和 {{ end }}
-	defineStartRegex := regexp.MustCompile(`(?sU)^\s*\{\{\s*define\s*"([^"]+)"\s*\}\}\s*`)
-	defineEndRegex := regexp.MustCompile(`(?sU)\s*\{\{\s*end\s*\}\}\s*`)
+	// 同一语言的翻译文件在各层之间按键合并：从低优先级层读起，站点的键覆盖主题的键
+	layers := s.fileLayers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		for _, f := range files {
+			ext := path.Ext(f.Name)
+			if ext != ".yml" && ext != ".yaml" {
+				continue
+			}
+			data, err := fs.ReadFile(layers[i].FS, f.Name)
+			if err != nil {
+				continue // 该层没有这个文件
+			}
 
-	return filepath.Walk(includesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+			var strs map[string]interface{}
+			if err := yaml.Unmarshal(data, &strs); err != nil {
+				return fmt.Errorf("解析翻译文件 %s 失败: %w", layers[i].displayPath(f.Name), err)
+			}
+
+			lang := strings.TrimSuffix(path.Base(f.Name), ext)
+			if s.Translations[lang] == nil {
+				s.Translations[lang] = make(map[string]interface{})
+			}
+			for k, v := range strs {
+				s.Translations[lang][k] = v
+			}
 		}
+	}
 
-		if info.IsDir() {
-			return nil
+	for lang := range s.Translations {
+		log.Printf("加载翻译: %s", lang)
+	}
+	return nil
+}
+
+// lookupTranslation 按点分隔的键查找翻译字符串
+func lookupTranslation(strs map[string]interface{}, key string) (string, bool) {
+	var cur interface{} = strs
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", false
 		}
+		if cur, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+	str, ok := cur.(string)
+	return str, ok
+}
 
-		// 只处理HTML文件
-		ext := filepath.Ext(path)
-		if ext != ".html" && ext != ".htm" {
-			return nil
+// translate 模板函数 t/i18n：返回当前语言的翻译，依次回退到默认语言和键本身；
+// 额外参数按 fmt.Sprintf 格式化
+func (s *Site) translate(key string, args ...interface{}) string {
+	text := key
+	for _, lang := range []string{s.Lang, s.Config.DefaultLang} {
+		if str, ok := lookupTranslation(s.Translations[lang], key); ok {
+			text = str
+			break
 		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
 
-		// 读取包含文件
-		contentBytes, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("读取包含文件 %s 失败: %w", path, err)
+// linkTranslations 按翻译键关联不同语言版本的页面和文章；启用繁简镜像时，默认语言的内容另有镜像版本
+func (s *Site) linkTranslations() {
+	m := s.Config.chineseMirror()
+	pageGroups := make(map[string][]*Page)
+	for _, p := range s.Pages {
+		pageGroups[p.TranslationKey] = append(pageGroups[p.TranslationKey], p)
+	}
+	for _, group := range pageGroups {
+		var alternates []Alternate
+		for _, p := range group {
+			alternates = append(alternates, Alternate{Lang: p.Lang, Name: s.Config.languageName(p.Lang), URL: s.absolutePageURL(p)})
+			if m != nil && p.Lang == m.SourceLang {
+				alternates = append(alternates, m.alternate(s.Config.URL, s.absolutePageURL(p)))
+			}
 		}
-		content := string(contentBytes)
+		if len(alternates) < 2 {
+			continue
+		}
+		s.sortAlternates(alternates)
+		for _, p := range group {
+			p.Alternates = alternates
+		}
+	}
 
-		// 移除 {{ define "name" }} 和 {{ end }}
-		content = defineStartRegex.ReplaceAllString(content, "")
-		content = defineEndRegex.ReplaceAllString(content, "")
+	postGroups := make(map[string][]*Post)
+	for _, p := range s.Posts {
+		postGroups[p.TranslationKey] = append(postGroups[p.TranslationKey], p)
+	}
+	for _, group := range postGroups {
+		var alternates []Alternate
+		for _, p := range group {
+			alternates = append(alternates, Alternate{Lang: p.Lang, Name: s.Config.languageName(p.Lang), URL: p.URL})
+			if m != nil && p.Lang == m.SourceLang {
+				alternates = append(alternates, m.alternate(s.Config.URL, p.URL))
+			}
+		}
+		if len(alternates) < 2 {
+			continue
+		}
+		s.sortAlternates(alternates)
+		for _, p := range group {
+			p.Alternates = alternates
+		}
+	}
+}
 
-		// 创建布局对象，这里复用Layout结构体，但表示的是include
-		includeName := strings.TrimSuffix(filepath.Base(path), ext)
-		includeLayout := NewLayout(includeName, content)
+// sortAlternates 按 LanguageCodes 的顺序排列语言版本，繁简镜像排在被镜像的语言之后
+func (s *Site) sortAlternates(alternates []Alternate) {
+	order := make(map[string]int)
+	for i, code := range s.Config.LanguageCodes() {
+		order[code] = i
+	}
+	if m := s.Config.chineseMirror(); m != nil {
+		order[m.Lang] = order[m.SourceLang]
+	}
+	sort.SliceStable(alternates, func(i, j int) bool { return order[alternates[i].Lang] < order[alternates[j].Lang] })
+}
 
-		s.mu.Lock()
-		s.Layouts[includeName] = includeLayout // 存储在Layouts中，方便统一管理
-		s.mu.Unlock()
+// absolutePageURL 返回页面的绝对URL
+func (s *Site) absolutePageURL(p *Page) string {
+	return strings.TrimSuffix(s.Config.URL, "/") + "/" + p.URL
+}
 
-		log.Printf("加载包含: %s", includeName)
-		return nil
-	})
+// hreflangLinkRegex 匹配布局中已有的 hreflang 备用链接
+var hreflangLinkRegex = regexp.MustCompile(`<link[^>]+hreflang=`)
+
+// injectHreflang 在 </head> 前插入 hreflang 备用链接；布局已自行输出 hreflang 链接时不处理
+func injectHreflang(html string, alternates []Alternate) string {
+	if len(alternates) == 0 || hreflangLinkRegex.MatchString(html) {
+		return html
+	}
+	idx := strings.Index(html, "</head>")
+	if idx < 0 {
+		return html
+	}
+
+	var b strings.Builder
+	for _, alt := range alternates {
+		fmt.Fprintf(&b, "  <link rel=\"alternate\" hreflang=\"%s\" href=\"%s\">\n",
+			template.HTMLEscapeString(alt.Lang), template.HTMLEscapeString(alt.URL))
+	}
+	return html[:idx] + b.String() + html[idx:]
 }
 
-// loadPages 加载页面文件
-func (s *Site) loadPages() error {
-	return filepath.Walk(s.Config.Source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// languageSites 返回每种语言的子站点；单语言站点直接返回自身
+func (s *Site) languageSites() []*Site {
+	if !s.Config.IsMultilingual() {
+		return []*Site{s}
+	}
 
-		if info.IsDir() {
-			return nil
+	var sites []*Site
+	for _, code := range s.Config.LanguageCodes() {
+		cfg := *s.Config
+		cfg.URL = strings.TrimSuffix(s.Config.URL, "/") + s.Config.LanguagePrefix(code)
+		if lang, ok := s.Config.Languages[code]; ok && lang != nil {
+			if lang.Title != "" {
+				cfg.Title = lang.Title
+			}
+			if lang.Description != "" {
+				cfg.Description = lang.Description
+			}
 		}
 
-		// 跳过特殊目录
-		relPath, _ := filepath.Rel(s.Config.Source, path)
-		if strings.HasPrefix(relPath, "_") || strings.HasPrefix(relPath, ".") {
-			return nil
+		ls := &Site{
+			Config:       &cfg,
+			Layouts:      s.Layouts,
+			Data:         s.Data,
+			Converter:    s.Converter,
+			URLTree:      NewURLTree(),
+			Translations: s.Translations,
+			cache:        s.cache,
+			Lang:         code,
+			LangPrefix:   s.Config.LanguagePrefix(code),
 		}
+		ls.Template = NewEngine(&cfg, ls)
 
-		// 只处理Markdown文件
-		if !s.Config.IsMarkdownFile(path) {
-			return nil
+		for _, p := range s.Pages {
+			if p.Lang == code {
+				ls.Pages = append(ls.Pages, p)
+			}
 		}
-
-		// 创建页面对象
-		p, err := NewPage(path, s.Config)
-		if err != nil {
-			log.Printf("警告: 创建页面失败 %s: %v", path, err)
-			return nil // 跳过有问题的文件，继续处理其他文件
+		for _, p := range s.Posts {
+			if p.Lang == code {
+				ls.Posts = append(ls.Posts, p)
+			}
 		}
+		sites = append(sites, ls)
+	}
+	return sites
+}
 
-		// 验证Markdown格式
-		if valid, errors := ValidateMarkdown(p.Content); !valid {
-			log.Printf("警告: 页面 %s Markdown格式有问题: %v", filepath.Base(path), errors)
-			// 继续处理，不中断程序
-		}
+// languagesData 返回模板中 site.languages 的内容，用于语言切换
+func (s *Site) languagesData() []map[string]interface{} {
+	var langs []map[string]interface{}
+	for _, code := range s.Config.LanguageCodes() {
+		langs = append(langs, map[string]interface{}{
+			"code":    code,
+			"name":    s.Config.languageName(code),
+			"prefix":  s.Config.LanguagePrefix(code),
+			"current": code == s.Lang,
+		})
+	}
+	return langs
+}
 
-		s.mu.Lock()
-		s.Pages = append(s.Pages, p)
-		s.mu.Unlock()
+// outputPath 返回当前语言输出目录下的文件路径
+func (s *Site) outputPath(parts ...string) string {
+	elems := []string{s.Config.Destination, filepath.FromSlash(strings.TrimPrefix(s.LangPrefix, "/"))}
+	return filepath.Join(append(elems, parts...)...)
+}
 
-		log.Printf("加载页面: %s", relPath)
-		return nil
-	})
-}
+// ==================== 繁简镜像 ====================
 
-// loadPosts 加载文章文件
-func (s *Site) loadPosts() error {
-	postsDir := filepath.Join(s.Config.Source, s.Config.PostsDir)
-	if _, err := os.Stat(postsDir); os.IsNotExist(err) {
-		return nil // 文章目录不存在，跳过
-	}
+// chineseMirror 繁简镜像：默认语言的页面和文章转为另一种字形，输出到镜像前缀下
+type chineseMirror struct {
+	Lang       string // 镜像的语言代码，zh-Hant 或 zh-Hans
+	Name       string // 镜像的显示名称
+	Prefix     string // 镜像的 URL 前缀，/zh-hant 或 /zh-hans
+	SourceLang string // 被镜像的语言，即默认语言
+	SourceName string // 被镜像语言的显示名称
 
-	return filepath.Walk(postsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	traditional bool // 转为繁体
+}
 
-		if info.IsDir() {
-			return nil
+// chineseMirror 返回配置的繁简镜像，未启用或配置无效时为 nil
+func (c *Config) chineseMirror() *chineseMirror {
+	target := strings.ToLower(c.ChineseMirror)
+	if target == "auto" {
+		target = "zh-hant"
+		if isTraditionalLang(c.DefaultLang) {
+			target = "zh-hans"
 		}
+	}
 
-		// 只处理Markdown文件
-		if !s.Config.IsMarkdownFile(path) {
-			return nil
-		}
+	m := &chineseMirror{Prefix: "/" + target, SourceLang: c.DefaultLang}
+	switch target {
+	case "zh-hant":
+		m.Lang, m.Name, m.SourceName, m.traditional = "zh-Hant", "繁體中文", "简体中文", true
+	case "zh-hans":
+		m.Lang, m.Name, m.SourceName = "zh-Hans", "简体中文", "繁體中文"
+	default:
+		return nil
+	}
+	if lang, ok := c.Languages[c.DefaultLang]; ok && lang != nil && lang.Name != "" {
+		m.SourceName = lang.Name
+	}
+	return m
+}
 
-		// 创建文章对象
-		p, err := NewPost(path, s.Config)
-		if err != nil {
-			log.Printf("警告: 创建文章失败 %s: %v", path, err)
-			return nil // 跳过有问题的文件，继续处理其他文件
+// isTraditionalLang 判断语言代码是否表示繁体中文（zh-TW、zh-HK、zh-MO、zh-Hant）
+func isTraditionalLang(code string) bool {
+	code = strings.ToLower(code)
+	for _, t := range []string{"zh-tw", "zh-hk", "zh-mo", "zh-hant"} {
+		if code == t || strings.HasPrefix(code, t+"-") {
+			return true
 		}
+	}
+	return false
+}
 
-		// 验证Markdown格式
-		if valid, errors := ValidateMarkdown(p.Content); !valid {
-			log.Printf("警告: 文章 %s Markdown格式有问题: %v", filepath.Base(path), errors)
-			// 继续处理，不中断程序
-		}
+// convert 把文本转为镜像的字形
+func (m *chineseMirror) convert(text string) string {
+	if m.traditional {
+		return analyzer.ToTraditional(text)
+	}
+	return analyzer.ToSimplified(text)
+}
 
-		// 预处理：将标题和摘要转换为简体，用于搜索
-		p.Title = toSimplified(p.Title)
-		p.Excerpt = toSimplified(p.Excerpt)
+// url 在站点根 URL 之后插入镜像前缀，root 为空时 u 为站内路径
+func (m *chineseMirror) url(root, u string) string {
+	root = strings.TrimSuffix(root, "/")
+	return root + m.Prefix + strings.TrimPrefix(u, root)
+}
 
-		s.mu.Lock()
-		s.Posts = append(s.Posts, p)
-		s.mu.Unlock()
+// alternate 返回原站点中 URL 为 u 的内容的镜像版本
+func (m *chineseMirror) alternate(root, u string) Alternate {
+	return Alternate{Lang: m.Lang, Name: m.Name, URL: m.url(root, u)}
+}
 
-		log.Printf("加载文章: %s", filepath.Base(path))
-		return nil
-	})
+// mirrorSkipTags 镜像转换时保持原样的元素：代码、脚本和样式
+var mirrorSkipTags = map[string]bool{
+	"pre": true, "code": true, "kbd": true, "samp": true,
+	"script": true, "style": true, "textarea": true,
 }
 
-// processCollections 处理分页、归档、标签、分类数据
-func (s *Site) processCollections() {
-	// 按日期排序文章
-	sort.Slice(s.Posts, func(i, j int) bool {
-		return s.Posts[i].Date.After(s.Posts[j].Date)
-	})
+// htmlVoidTags 没有结束标签的元素
+var htmlVoidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
 
-	// 处理分页
-	s.processPagination()
+// mirrorTextAttrs 镜像转换时转换的属性；href、src 等其余属性多为 URL，保持原样
+var mirrorTextAttrs = map[string]bool{"title": true, "alt": true, "placeholder": true, "aria-label": true}
 
-	// 处理归档
-	s.processArchives()
-}
+var (
+	htmlTagNameRegex  = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9-]*)`)
+	htmlLangRegex     = regexp.MustCompile(`(?i)\slang\s*=\s*["']([^"']*)["']`)
+	htmlAttrRegex     = regexp.MustCompile(`(\s)([a-zA-Z][a-zA-Z0-9:-]*)(\s*=\s*)("[^"]*"|'[^']*')`)
+	metaTextNameRegex = regexp.MustCompile(`(?i)\s(name|property)\s*=\s*["'][^"']*(title|description|keywords)["']`)
+)
 
-// processPagination 处理分页
-func (s *Site) processPagination() {
-	if s.Config.Paginate <= 0 {
-		return
-	}
+// convertHTML 转换 HTML 中的文本和 title、alt 等属性的字形。代码、脚本、样式、注释和 URL 保持原样，
+// lang 属性标明其他语言的元素（如语言切换中的“简体中文”）也保持原样
+func (m *chineseMirror) convertHTML(html string) string {
+	var b strings.Builder
+	b.Grow(len(html))
+	skipName, skip := "", 0 // 保持原样的元素及其同名元素的嵌套层数
+	for i := 0; i < len(html); {
+		lt := strings.IndexByte(html[i:], '<')
+		if lt < 0 {
+			lt = len(html) - i
+		}
+		if text := html[i : i+lt]; skip == 0 {
+			b.WriteString(m.convert(text))
+		} else {
+			b.WriteString(text)
+		}
+		if i += lt; i >= len(html) {
+			break
+		}
 
-	s.PagedPosts = make([][]*Post, 0)
-	for i := 0; i < len(s.Posts); i += s.Config.Paginate {
-		end := i + s.Config.Paginate
-		if end > len(s.Posts) {
-			end = len(s.Posts)
+		if strings.HasPrefix(html[i:], "<!--") {
+			end := strings.Index(html[i:], "-->")
+			if end < 0 {
+				end = len(html) - i - 3
+			}
+			b.WriteString(html[i : i+end+3])
+			i += end + 3
+			continue
+		}
+		match := htmlTagNameRegex.FindStringSubmatch(html[i:])
+		if match == nil {
+			b.WriteByte('<') // 不是标签的 <
+			i++
+			continue
 		}
-		s.PagedPosts = append(s.PagedPosts, s.Posts[i:end])
-	}
-}
 
-// processArchives 处理归档
-func (s *Site) processArchives() {
-	s.Archives = make(map[string][]*Post)
-	for _, post := range s.Posts {
-		key := post.Date.Format("2006-01")
-		s.Archives[key] = append(s.Archives[key], post)
+		// 标签在第一个不在引号中的 > 处结束
+		end, quote := i+1, byte(0)
+		for ; end < len(html); end++ {
+			if c := html[end]; quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+			} else if c == '"' || c == '\'' {
+				quote = c
+			} else if c == '>' {
+				end++
+				break
+			}
+		}
+		tag, name, closing := html[i:end], strings.ToLower(match[1]), html[i+1] == '/'
+		i = end
+
+		void := htmlVoidTags[name] || strings.HasSuffix(tag, "/>")
+		if !closing && skip == 0 {
+			if lang := htmlLangRegex.FindStringSubmatch(tag); name != "html" && !void &&
+				(mirrorSkipTags[name] || lang != nil && lang[1] != "" && !strings.EqualFold(lang[1], m.Lang)) {
+				skipName = name
+			} else {
+				tag = m.convertAttrs(tag, name)
+			}
+		}
+		b.WriteString(tag)
+		switch {
+		case name != skipName:
+		case closing:
+			if skip--; skip == 0 {
+				skipName = ""
+			}
+		default:
+			skip++
+		}
+		if closing {
+			continue
+		}
+		switch name {
+		case "script", "style":
+			// 原始文本元素的内容直到结束标签都不是 HTML
+			rest := strings.Index(strings.ToLower(html[i:]), "</"+name)
+			if rest < 0 {
+				rest = len(html) - i
+			}
+			b.WriteString(html[i : i+rest])
+			i += rest
+		}
 	}
+	return b.String()
 }
 
-// render 渲染所有内容
-func (s *Site) render() error {
-	// 渲染页面
-	for _, p := range s.Pages {
-		if err := s.renderPage(p); err != nil {
-			return fmt.Errorf("渲染页面失败 %s: %w", p.Path, err)
+// convertAttrs 转换开始标签中 title、alt 等属性的值；meta 标签的 content 只在表示标题、描述或关键词时转换
+func (m *chineseMirror) convertAttrs(tag, name string) string {
+	textContent := name == "meta" && metaTextNameRegex.MatchString(tag)
+	return htmlAttrRegex.ReplaceAllStringFunc(tag, func(attr string) string {
+		parts := htmlAttrRegex.FindStringSubmatch(attr)
+		key := strings.ToLower(parts[2])
+		if !mirrorTextAttrs[key] && !(textContent && key == "content") {
+			return attr
 		}
-	}
+		value := parts[4]
+		return parts[1] + parts[2] + parts[3] + value[:1] + m.convert(value[1:len(value)-1]) + value[len(value)-1:]
+	})
+}
 
-	// 渲染文章
-	for _, p := range s.Posts {
-		if err := s.renderPost(p); err != nil {
-			return fmt.Errorf("渲染文章失败 %s: %w", p.Path, err)
-		}
-	}
+// markdownKeepRegex Markdown 中镜像转换时保持原样的部分：代码块、行内代码、链接地址和 URL
+var markdownKeepRegex = regexp.MustCompile("(?s)```.*?```|~~~.*?~~~|`[^`\n]*`|\\]\\([^)\n]*\\)|<[a-zA-Z][a-zA-Z0-9+.-]*:[^>\\s]*>|https?://[^\\s)>\\]]+")
 
-	// 渲染分页页面
-	if err := s.renderPagination(); err != nil {
-		return fmt.Errorf("渲染分页失败: %w", err)
+// convertMarkdown 转换 Markdown 文本（摘要）的字形，代码、链接地址和 URL 保持原样
+func (m *chineseMirror) convertMarkdown(md string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range markdownKeepRegex.FindAllStringIndex(md, -1) {
+		b.WriteString(m.convert(md[last:loc[0]]))
+		b.WriteString(md[loc[0]:loc[1]])
+		last = loc[1]
 	}
+	b.WriteString(m.convert(md[last:]))
+	return b.String()
+}
 
-	// 渲染归档页面
-	if err := s.renderArchives(); err != nil {
-		return fmt.Errorf("渲染归档失败: %w", err)
+// mirrorSite 创建繁简镜像的子站点：复制 base（默认语言的站点）的页面和文章，标题、描述和摘要转换字形，
+// URL 加上镜像前缀；正文和布局文本在渲染后整体转换。未启用镜像时返回 nil
+func (s *Site) mirrorSite(base *Site) *Site {
+	m := s.Config.chineseMirror()
+	if m == nil {
+		return nil
 	}
-
-	return nil
+	root := s.Config.URL
+	cfg := *base.Config
+	cfg.Title, cfg.Subtitle, cfg.Description = m.convert(cfg.Title), m.convert(cfg.Subtitle), m.convert(cfg.Description)
+
+	ms := &Site{
+		Config:       &cfg,
+		Layouts:      s.Layouts,
+		Data:         s.Data,
+		Converter:    s.Converter,
+		URLTree:      NewURLTree(),
+		Translations: s.Translations,
+		cache:        s.cache,
+		Lang:         m.Lang,
+		LangPrefix:   m.Prefix + base.LangPrefix,
+		mirror:       m,
+	}
+	cfg.URL = strings.TrimSuffix(root, "/") + ms.LangPrefix
+	ms.Template = NewEngine(&cfg, ms)
+
+	for _, p := range base.Pages {
+		c := *p
+		c.Title, c.Description, c.Excerpt = m.convert(p.Title), m.convert(p.Description), m.convertMarkdown(p.Excerpt)
+		c.URL = strings.TrimPrefix(m.Prefix, "/") + "/" + p.URL
+		c.Lang, c.RenderedContent = m.Lang, ""
+		ms.Pages = append(ms.Pages, &c)
+	}
+	for _, p := range base.Posts {
+		c := *p
+		c.Title, c.Description, c.Excerpt = m.convert(p.Title), m.convert(p.Description), m.convertMarkdown(p.Excerpt)
+		c.URL = m.url(root, p.URL)
+		c.Lang, c.RenderedContent = m.Lang, ""
+		ms.Posts = append(ms.Posts, &c)
+	}
+	return ms
 }
 
-// renderPagination 渲染分页页面
-func (s *Site) renderPagination() error {
-	if len(s.PagedPosts) == 0 {
+// listAlternates 返回列表页（首页、分页、归档、标签和搜索页）在原站点和繁简镜像中的两个版本，
+// 用于 hreflang 和语言切换；未启用镜像或当前语言不被镜像时为 nil
+func (s *Site) listAlternates(route string) []Alternate {
+	m := s.Config.chineseMirror()
+	if m == nil || s.mirror == nil && s.Lang != m.SourceLang {
 		return nil
 	}
+	root := strings.TrimSuffix(strings.TrimSuffix(s.Config.URL, "/"), s.LangPrefix)
+	route = strings.TrimSuffix(route, "index.html")
+	if s.mirror != nil {
+		route = strings.TrimPrefix(route, m.Prefix)
+	}
+	return []Alternate{
+		{Lang: m.SourceLang, Name: m.SourceName, URL: root + route},
+		m.alternate(root, root+route),
+	}
+}
 
-	for i, posts := range s.PagedPosts {
-		pageNum := i + 1
-
-		// 创建分页页面数据
-		data := map[string]interface{}{
-			"layout": "index",
-			"title":  s.Config.Title,
-			"posts":  posts,
-			"page": map[string]interface{}{
-				"number": pageNum,
-				"total":  len(s.PagedPosts),
-			},
-			"site": map[string]interface{}{
-				"title":       s.Config.Title,
-				"subtitle":    s.Config.Subtitle,
-				"description": s.Config.Description,
-				"author":      s.Config.Author,
-				"url":         s.Config.URL,
-				"posts":       s.Posts,
-				"pages":       s.Pages,
-				"data":        s.Data,
-				"archives":    s.Archives,
-				"tags":        s.JiebaTags,
-			},
-		}
-
-		// 设置CurrentData
-		s.CurrentData = data
-
-		// 渲染分页页面
-		layout, exists := s.Layouts["index"]
-		if !exists {
-			return fmt.Errorf("布局 index 不存在")
-		}
-
-		content, err := s.Template.Render(layout, data)
-		if err != nil {
-			return fmt.Errorf("渲染分页页面失败: %w", err)
-		}
+// ==================== 增量构建 ====================
 
-		// 写入分页页面
-		var outputPath string
-		if pageNum == 1 {
-			outputPath = filepath.Join(s.Config.Destination, "index.html")
-		} else {
-			outputPath = filepath.Join(s.Config.Destination, "page", fmt.Sprintf("%d", pageNum), "index.html")
-		}
-		outputDir := filepath.Dir(outputPath)
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return fmt.Errorf("创建目录失败: %w", err)
-		}
+// cacheVersion 构建缓存格式版本，转换或渲染逻辑变化时递增以使旧缓存失效
+const cacheVersion = "1"
 
-		if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
-			return fmt.Errorf("写入分页页面失败: %w", err)
-		}
+// buildManifest 构建缓存中的依赖图：每个输出使用了哪些布局、包含、数据文件和集合
+type buildManifest struct {
+	Version string                   `json:"version"`
+	Global  string                   `json:"global"`  // 配置和翻译的指纹，变化时所有输出都需重新渲染
+	Deps    map[string]string        `json:"deps"`    // 依赖名 -> 内容哈希
+	Outputs map[string]*outputRecord `json:"outputs"` // 输出键 -> 记录
+}
 
-		log.Printf("写入分页页面: 第 %d 页", pageNum)
-	}
+// outputRecord 一个输出（页面、文章或聚合页面）的依赖和写入的文件
+type outputRecord struct {
+	Source   string   `json:"source"`             // 源内容指纹
+	Deps     []string `json:"deps"`               // 依赖名，如 template:post、data:nav、posts@zh-CN
+	Markdown string   `json:"markdown,omitempty"` // 使用的 Markdown 转换缓存键
+	Files    []string `json:"files"`              // 写入的文件，相对输出目录
+}
 
-	return nil
+// buildCache 基于内容哈希的持久化构建缓存，保存 Markdown 转换结果和依赖图
+type buildCache struct {
+	dir  string // 缓存目录
+	dest string // 输出目录
+
+	mu           sync.Mutex
+	prev         *buildManifest
+	next         *buildManifest
+	invalid      bool                // 上次的依赖图不可用，所有输出都重新渲染
+	unchanged    map[string]bool     // 本次跳过渲染的输出键
+	templateDeps map[string][]string // 模板名 -> 静态分析得到的依赖
+	renderedKeys []string            // 本次重新渲染的输出键
+	rendered     int
+	skipped      int
 }
 
-// renderArchives 渲染归档页面
-func (s *Site) renderArchives() error {
-	// 如果没有归档，插入友好提示
-	archives := s.Archives
-	if len(archives) == 0 {
-		archives = map[string][]*Post{"": {}}
+// newBuildManifest 创建空的依赖图
+func newBuildManifest() *buildManifest {
+	return &buildManifest{
+		Version: cacheVersion,
+		Deps:    make(map[string]string),
+		Outputs: make(map[string]*outputRecord),
 	}
-	data := map[string]interface{}{
-		"layout":   "archive",
-		"title":    "归档",
-		"archives": archives,
-		"site": map[string]interface{}{
-			"title":       s.Config.Title,
-			"subtitle":    s.Config.Subtitle,
-			"description": s.Config.Description,
-			"author":      s.Config.Author,
-			"url":         s.Config.URL,
-			"posts":       s.Posts,
-			"pages":       s.Pages,
-			"data":        s.Data,
-			"archives":    archives,
-			"JiebaTags":   s.JiebaTags,
-		},
+}
+
+// openBuildCache 打开缓存目录并读取上次构建的依赖图；global 为本次配置和翻译的指纹
+func openBuildCache(cfg *Config, global string) *buildCache {
+	c := &buildCache{
+		dir:          cfg.CachePath(),
+		dest:         cfg.Destination,
+		prev:         newBuildManifest(),
+		next:         newBuildManifest(),
+		invalid:      true,
+		unchanged:    make(map[string]bool),
+		templateDeps: make(map[string][]string),
 	}
-	// 设置CurrentData
-	s.CurrentData = data
-	layout, exists := s.Layouts["archive"]
-	if !exists {
-		return fmt.Errorf("布局 archive 不存在")
+	c.next.Global = global
+
+	data, err := os.ReadFile(filepath.Join(c.dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		log.Printf("增量构建: 没有构建缓存，渲染全部内容")
+		return c
 	}
-	content, err := s.Template.Render(layout, data)
 	if err != nil {
-		return fmt.Errorf("渲染归档页面失败: %w", err)
+		log.Printf("警告: 读取构建缓存失败，渲染全部内容: %v", err)
+		return c
 	}
-	outputPath := filepath.Join(s.Config.Destination, "archives", "index.html")
-	outputDir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
+
+	var m buildManifest
+	if err := json.Unmarshal(data, &m); err != nil || m.Outputs == nil {
+		log.Printf("警告: 构建缓存已损坏，渲染全部内容: %v", err)
+		return c
 	}
-	if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
-		return fmt.Errorf("写入归档页面失败: %w", err)
+	if m.Deps == nil {
+		m.Deps = make(map[string]string)
 	}
-	log.Printf("写入归档页面: /archives/")
-	return nil
+	c.prev = &m
+
+	// 上次的输出仍用于清理过期文件，但配置或缓存版本变化后不能复用
+	if m.Version != cacheVersion || m.Global != global {
+		log.Printf("增量构建: 配置、翻译或缓存版本已变化，渲染全部内容")
+		return c
+	}
+	c.invalid = false
+	return c
 }
 
-// write 写入输出目录
-func (s *Site) write() error {
-	// 创建输出目录
-	if err := os.MkdirAll(s.Config.Destination, 0755); err != nil {
-		return fmt.Errorf("创建输出目录失败: %w", err)
+// addDeps 记录本次构建的依赖哈希
+func (c *buildCache) addDeps(deps map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, hash := range deps {
+		c.next.Deps[name] = hash
 	}
+}
 
-	// 写入页面
-	for _, p := range s.Pages {
-		if err := s.writePage(p); err != nil {
-			return fmt.Errorf("写入页面失败 %s: %w", p.Path, err)
+// fresh 判断输出是否可以跳过：源内容、依赖列表和每个依赖的哈希都与上次相同，且输出文件仍然存在
+func (c *buildCache) fresh(key, source string, deps []string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rec, ok := c.prev.Outputs[key]
+	if c.invalid || !ok || rec.Source != source || !slices.Equal(rec.Deps, deps) {
+		return false
+	}
+	for _, d := range deps {
+		if c.prev.Deps[d] != c.next.Deps[d] {
+			return false
+		}
+	}
+	for _, f := range rec.Files {
+		if _, err := os.Stat(filepath.Join(c.dest, f)); err != nil {
+			return false
 		}
 	}
 
-	// 写入文章
-	for _, p := range s.Posts {
-		if err := s.writePost(p); err != nil {
-			return fmt.Errorf("写入文章失败 %s: %w", p.Path, err)
+	c.next.Outputs[key] = rec
+	c.unchanged[key] = true
+	c.skipped++
+	return true
+}
+
+// record 记录重新渲染的输出；markdown 为转换的 Markdown 原文，files 为输出文件的完整路径
+func (c *buildCache) record(key, source string, deps []string, markdown string, files ...string) {
+	if c == nil {
+		return
+	}
+
+	rec := &outputRecord{Source: source, Deps: deps}
+	if markdown != "" {
+		rec.Markdown = markdownKey(markdown)
+	}
+	for _, f := range files {
+		if rel, err := filepath.Rel(c.dest, f); err == nil {
+			rec.Files = append(rec.Files, filepath.ToSlash(rel))
 		}
 	}
 
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next.Outputs[key] = rec
+	c.renderedKeys = append(c.renderedKeys, key)
+	c.rendered++
 }
 
-// writePage 写入单个页面
-func (s *Site) writePage(p *Page) error {
-	// 计算输出路径
-	relPath, _ := filepath.Rel(s.Config.Source, p.Path)
-	outputPath := filepath.Join(s.Config.Destination, strings.TrimSuffix(relPath, filepath.Ext(relPath))+".html")
+// renderedOutputs 返回本次重新渲染的输出键
+func (c *buildCache) renderedOutputs() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := slices.Clone(c.renderedKeys)
+	sort.Strings(keys)
+	return keys
+}
 
-	// 创建输出目录
-	outputDir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("创建输出目录失败: %w", err)
+// isUnchanged 判断输出在本次构建中是否跳过了渲染
+func (c *buildCache) isUnchanged(key string) bool {
+	if c == nil {
+		return false
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.unchanged[key]
+}
 
-	// 写入文件
-	if err := os.WriteFile(outputPath, []byte(p.RenderedContent), 0644); err != nil {
-		return fmt.Errorf("写入文件失败: %w", err)
+// dependencies 返回模板及其引用的模板和包含文件用到的依赖，结果按模板名缓存
+func (c *buildCache) dependencies(root *template.Template, name string) []string {
+	c.mu.Lock()
+	deps, ok := c.templateDeps[name]
+	c.mu.Unlock()
+	if ok {
+		return deps
 	}
 
-	log.Printf("写入页面: %s", outputPath)
-	return nil
+	deps = templateDependencies(root, name)
+	c.mu.Lock()
+	c.templateDeps[name] = deps
+	c.mu.Unlock()
+	return deps
 }
 
-// writePost 写入单个文章
-func (s *Site) writePost(p *Post) error {
-	// 从绝对URL中提取相对路径用于文件写入
-	relativeURL := p.extractRelativeURL()
+// markdownKey 返回 Markdown 转换缓存的键
+func markdownKey(content string) string {
+	sum := sha256.Sum256([]byte(cacheVersion + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
 
-	// 1. 原有路径
-	outputPath := filepath.Join(s.Config.Destination, relativeURL)
-	outputDir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("创建输出目录失败: %w", err)
+// markdownPath 返回 Markdown 转换缓存文件路径
+func (c *buildCache) markdownPath(key string) string {
+	return filepath.Join(c.dir, "markdown", key[:2], key+".html")
+}
+
+// convert 转换 Markdown，内容相同时直接读取缓存的 HTML
+func (c *buildCache) convert(conv *MarkdownConverter, content string) (string, error) {
+	if c == nil {
+		return conv.Convert(content)
 	}
-	if err := os.WriteFile(outputPath, []byte(p.RenderedContent), 0644); err != nil {
-		return fmt.Errorf("写入文件失败: %w", err)
+
+	cachePath := c.markdownPath(markdownKey(content))
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return string(data), nil
 	}
-	log.Printf("写入文章: %s", outputPath)
 
-	// 2. 归档路径副本 /archives/年/月/日/slug.html
-	archivePath := filepath.Join(s.Config.Destination, "archives", p.Date.Format("2006"), p.Date.Format("01"), p.Date.Format("02"), filepath.Base(relativeURL))
-	archiveDir := filepath.Dir(archivePath)
-	if err := os.MkdirAll(archiveDir, 0755); err != nil {
-		return fmt.Errorf("创建归档输出目录失败: %w", err)
+	html, err := conv.Convert(content)
+	if err != nil {
+		return "", err
 	}
-	if err := os.WriteFile(archivePath, []byte(p.RenderedContent), 0644); err != nil {
-		return fmt.Errorf("写入归档副本失败: %w", err)
+	if err := writeFileAtomic(cachePath, []byte(html)); err != nil {
+		log.Printf("警告: 写入Markdown缓存失败: %v", err)
 	}
-	log.Printf("写入归档副本: %s", archivePath)
-
-	// 已移除分类和标签路径副本，使用jieba分词作为智能分类
-
-	return nil
+	return html, nil
 }
 
-// copyStaticFiles 复制静态文件
-func (s *Site) copyStaticFiles() error {
-	// 复制 stylesheets 目录
-	stylesheetsSrc := filepath.Join(s.Config.Source, "stylesheets")
-	stylesheetsDest := filepath.Join(s.Config.Destination, "stylesheets")
+// save 删除不再生成的输出和不再使用的 Markdown 缓存，并写入本次的依赖图
+func (c *buildCache) save() error {
+	if c == nil {
+		return nil
+	}
 
-	if _, err := os.Stat(stylesheetsSrc); err == nil {
-		if err := s.copyDirectory(stylesheetsSrc, stylesheetsDest); err != nil {
-			return fmt.Errorf("复制 stylesheets 失败: %w", err)
+	files := make(map[string]bool)
+	markdown := make(map[string]bool)
+	for _, rec := range c.next.Outputs {
+		for _, f := range rec.Files {
+			files[f] = true
+		}
+		if rec.Markdown != "" {
+			markdown[rec.Markdown] = true
 		}
-		log.Printf("复制 stylesheets 目录")
-	} else {
-		return fmt.Errorf("未找到 stylesheets 目录: %s，请手动补充样式文件", stylesheetsSrc)
 	}
 
-	// 复制其他静态文件目录
-	staticDirs := []string{"images", "js", "fonts", "assets"}
-	for _, dir := range staticDirs {
-		src := filepath.Join(s.Config.Source, dir)
-		dest := filepath.Join(s.Config.Destination, dir)
-
-		if _, err := os.Stat(src); err == nil {
-			if err := s.copyDirectory(src, dest); err != nil {
-				return fmt.Errorf("复制 %s 失败: %w", dir, err)
+	// 删除源文件已移除的输出
+	for key, rec := range c.prev.Outputs {
+		if _, ok := c.next.Outputs[key]; ok {
+			continue
+		}
+		for _, f := range rec.Files {
+			if files[f] {
+				continue
 			}
-			log.Printf("复制 %s 目录", dir)
+			if err := os.Remove(filepath.Join(c.dest, filepath.FromSlash(f))); err == nil {
+				log.Printf("删除过期输出: %s", f)
+			}
+			os.Remove(filepath.Join(c.dest, filepath.FromSlash(f)) + ".gz")
 		}
 	}
 
-	return nil
-}
-
-// copyDirectory 复制目录
-func (s *Site) copyDirectory(src, dest string) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// 清理不再使用的 Markdown 缓存
+	markdownDir := filepath.Join(c.dir, "markdown")
+	filepath.Walk(markdownDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
 		}
-
-		// 计算相对路径
-		relPath, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
+		if !markdown[strings.TrimSuffix(info.Name(), ".html")] {
+			os.Remove(path)
 		}
+		return nil
+	})
 
-		destPath := filepath.Join(dest, relPath)
+	data, err := json.Marshal(c.next)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(c.dir, "manifest.json"), data); err != nil {
+		return err
+	}
 
-		if info.IsDir() {
-			// 创建目录
-			return os.MkdirAll(destPath, 0755)
-		} else {
-			// 复制文件
-			return s.copyFile(path, destPath)
-		}
-	})
+	log.Printf("增量构建: 重新渲染 %d 个输出，跳过 %d 个未变化的输出", c.rendered, c.skipped)
+	return nil
 }
 
-// copyFile 复制文件
-func (s *Site) copyFile(src, dest string) error {
-	// 创建目标目录
-	destDir := filepath.Dir(dest)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+// writeFileAtomic 先写入临时文件再重命名，避免并发读取到不完整的内容
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
-
-	// 读取源文件
-	data, err := os.ReadFile(src)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
 	if err != nil {
 		return err
 	}
-
-	// 写入目标文件
-	return os.WriteFile(dest, data, 0644)
-}
-
-// Watch 监听文件变化
-func (s *Site) Watch() error {
-	// TODO: 实现文件监听功能
-	log.Println("文件监听功能尚未实现")
-	return nil
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
-// Serve 启动本地服务器
-func (s *Site) Serve(host string, port int) error {
-	if err := s.Build(); err != nil {
-		return fmt.Errorf("构建站点失败: %w", err)
+// contentHash 返回任意可序列化值的哈希
+func contentHash(values ...interface{}) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			// 无法序列化时返回唯一值，使相关输出总是重新渲染
+			log.Printf("警告: 计算内容哈希失败: %v", err)
+			return fmt.Sprintf("unhashable-%d", time.Now().UnixNano())
+		}
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	// 使用 Gin 框架
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
-
-	// 静态文件服务
-	r.Static("/stylesheets", filepath.Join(s.Config.Destination, "stylesheets"))
-	r.Static("/images", filepath.Join(s.Config.Destination, "images"))
-	r.Static("/js", filepath.Join(s.Config.Destination, "js"))
-	r.Static("/fonts", filepath.Join(s.Config.Destination, "fonts"))
-	r.Static("/assets", filepath.Join(s.Config.Destination, "assets"))
-
-	// 搜索API
-	r.GET("/api/search", func(c *gin.Context) {
-		// 添加CORS头
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
-
-		query := c.Query("q")
-		if query == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "查询参数不能为空"})
+// templateDependencies 静态分析模板的语法树，收集引用的模板、包含文件、数据文件和集合；
+// 访问 Content 字段时记录 content，由 outputDeps 换算为所用集合的正文依赖
+func templateDependencies(root *template.Template, name string) []string {
+	deps := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if deps["template:"+name] {
 			return
 		}
-
-		// 将查询词转换为简体
-		query = toSimplified(query)
-
-		// 使用jieba分词
-		x := gojieba.NewJieba()
-		defer x.Free()
-		queryWords := x.CutForSearch(query, true)
-
-		// 使用map去重
-		postMap := make(map[*Post]bool)
-		var results []*Post
-
-		// 搜索匹配的文章
-		for _, word := range queryWords {
-			word = toSimplified(word)
-			if len([]rune(word)) < 2 {
-				continue
-			}
-
-			// 在URL树中搜索
-			path := "/content/" + word
-			posts := s.URLTree.SearchPrefix(path)
-			for _, post := range posts {
-				if !postMap[post] {
-					postMap[post] = true
-					results = append(results, post)
-				}
-			}
+		deps["template:"+name] = true
+		if t := root.Lookup(name); t != nil && t.Tree != nil {
+			collectTemplateDeps(t.Tree.Root, deps, visit)
 		}
+	}
+	visit(name)
 
-		// 如果没有找到结果，尝试全文搜索
-		if len(results) == 0 {
-			// 在所有文章中搜索标题和摘要
-			for _, post := range s.Posts {
-				// 检查标题是否包含查询词
-				if strings.Contains(strings.ToLower(post.Title), strings.ToLower(query)) {
-					if !postMap[post] {
-						postMap[post] = true
-						results = append(results, post)
-					}
-				}
-				// 检查摘要是否包含查询词
-				if strings.Contains(strings.ToLower(post.Excerpt), strings.ToLower(query)) {
-					if !postMap[post] {
-						postMap[post] = true
-						results = append(results, post)
-					}
-				}
-			}
-		}
+	result := make([]string, 0, len(deps))
+	for d := range deps {
+		result = append(result, d)
+	}
+	sort.Strings(result)
+	return result
+}
 
-		var response []gin.H
-		for _, post := range results {
-			response = append(response, gin.H{
-				"title":   post.Title,
-				"url":     post.URL,
-				"date":    post.Date.Format("2006-01-02"),
-				"excerpt": post.Excerpt,
-			})
+// collectTemplateDeps 遍历语法树节点
+func collectTemplateDeps(node parse.Node, deps map[string]bool, visit func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
 		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"query":   query,
-			"results": response,
-			"count":   len(response),
-		})
-	})
-
-	// 兜底路由处理
-	r.NoRoute(func(c *gin.Context) {
-		path := c.Request.URL.Path
-
-		// 使用URL二叉树搜索
-		if post := s.URLTree.Search(path); post != nil {
-			// 找到文章，提供对应的HTML文件
-			relativeURL := post.extractRelativeURL()
-			filePath := filepath.Join(s.Config.Destination, relativeURL)
-			if _, err := os.Stat(filePath); err == nil {
-				c.Header("Content-Type", "text/html; charset=utf-8")
-				c.File(filePath)
-				return
-			}
+		for _, child := range n.Nodes {
+			collectTemplateDeps(child, deps, visit)
 		}
-
-		// 尝试直接提供文件
-		filePath := filepath.Join(s.Config.Destination, path)
-		if _, err := os.Stat(filePath); err == nil {
-			c.File(filePath)
+	case *parse.ActionNode:
+		collectTemplateDeps(n.Pipe, deps, visit)
+	case *parse.IfNode:
+		collectBranchDeps(&n.BranchNode, deps, visit)
+	case *parse.RangeNode:
+		collectBranchDeps(&n.BranchNode, deps, visit)
+	case *parse.WithNode:
+		collectBranchDeps(&n.BranchNode, deps, visit)
+	case *parse.TemplateNode:
+		visit(n.Name)
+		collectTemplateDeps(n.Pipe, deps, visit)
+	case *parse.PipeNode:
+		if n == nil {
 			return
 		}
-
-		// 尝试添加 .html 扩展名
-		if !strings.HasSuffix(path, ".html") {
-			htmlPath := filepath.Join(s.Config.Destination, path+".html")
-			if _, err := os.Stat(htmlPath); err == nil {
-				c.Header("Content-Type", "text/html; charset=utf-8")
-				c.File(htmlPath)
-				return
+		for _, cmd := range n.Cmds {
+			collectTemplateDeps(cmd, deps, visit)
+		}
+	case *parse.CommandNode:
+		// include "name" 引用包含文件；参数不是常量时无法确定，依赖所有模板
+		if len(n.Args) >= 2 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "include" {
+				if str, ok := n.Args[1].(*parse.StringNode); ok {
+					visit(str.Text)
+				} else {
+					deps["template:*"] = true
+				}
 			}
 		}
-
-		// 尝试 index.html
-		indexPath := filepath.Join(s.Config.Destination, path, "index.html")
-		if _, err := os.Stat(indexPath); err == nil {
-			c.Header("Content-Type", "text/html; charset=utf-8")
-			c.File(indexPath)
-			return
+		for _, arg := range n.Args {
+			collectTemplateDeps(arg, deps, visit)
 		}
-
-		// 404 处理
-		c.Status(http.StatusNotFound)
-		c.String(http.StatusNotFound, "404 - 页面未找到")
-	})
-
-	addr := fmt.Sprintf("%s:%d", host, port)
-	log.Printf("启动服务器: http://%s", addr)
-	log.Printf("服务目录: %s", s.Config.Destination)
-	log.Println("按 Ctrl+C 停止服务器")
-
-	return r.Run(addr)
+	case *parse.ChainNode:
+		collectTemplateDeps(n.Node, deps, visit)
+		collectContentDeps(n.Field, deps)
+	case *parse.FieldNode:
+		collectSiteDeps(n.Ident, deps)
+		collectContentDeps(n.Ident, deps)
+	case *parse.VariableNode:
+		if len(n.Ident) > 0 && n.Ident[0] == "$" {
+			collectSiteDeps(n.Ident[1:], deps)
+		}
+		collectContentDeps(n.Ident, deps)
+	}
 }
 
-// ensureProjectStructure 自动初始化项目结构和核心文件
-func ensureProjectStructure() (fixed bool, report []string) {
-	// 只检查目录，不再自动写入嵌入式样式和布局
-	dirs := []string{"_layouts", "_posts", "_data", "_includes", "stylesheets"}
-	for _, dir := range dirs {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			os.Mkdir(dir, 0755)
-			report = append(report, "已创建目录: "+dir)
-			fixed = true
+// collectContentDeps 记录对 Content、RenderedContent 字段的访问，如在 range .site.posts 中显示全文
+func collectContentDeps(ident []string, deps map[string]bool) {
+	for _, id := range ident {
+		if id == "Content" || id == "RenderedContent" {
+			deps["content"] = true
 		}
 	}
-	return fixed, report
 }
 
-// doctorCheck 检查项目结构和文件格式
-func doctorCheck(cfg *Config) (fixed bool, report []string) {
-	report = append(report, "=== 开始检查项目结构 ===")
+// collectBranchDeps 遍历 if、range、with 节点
+func collectBranchDeps(n *parse.BranchNode, deps map[string]bool, visit func(string)) {
+	collectTemplateDeps(n.Pipe, deps, visit)
+	collectTemplateDeps(n.List, deps, visit)
+	collectTemplateDeps(n.ElseList, deps, visit)
+}
 
-	// 1. 检查必要目录
-	dirs := []string{"_layouts", "_posts", "_data", "_includes", "stylesheets"}
-	for _, dir := range dirs {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			os.Mkdir(dir, 0755)
-			report = append(report, "✓ 已创建目录: "+dir)
-			fixed = true
+// collectSiteDeps 根据 .site.xxx 字段访问记录数据文件和集合依赖；
+// 整体使用 .site 时无法确定访问了什么，依赖所有数据和集合
+func collectSiteDeps(ident []string, deps map[string]bool) {
+	if len(ident) == 0 || ident[0] != "site" {
+		return
+	}
+	if len(ident) == 1 {
+		deps["data:*"] = true
+		deps["posts"] = true
+		deps["pages"] = true
+		deps["tags"] = true
+		return
+	}
+
+	switch ident[1] {
+	case "data":
+		if len(ident) > 2 {
+			deps["data:"+ident[2]] = true
 		} else {
-			report = append(report, "✓ 目录存在: "+dir)
+			deps["data:*"] = true
 		}
+	case "posts", "archives":
+		deps["posts"] = true
+	case "tags", "JiebaTags":
+		deps["posts"] = true
+		deps["tags"] = true
+	case "pages":
+		deps["pages"] = true
 	}
+}
 
-	// 2. 检查布局文件
-	report = append(report, "\n=== 检查布局文件 ===")
-	layoutsDir := filepath.Join(cfg.Source, cfg.LayoutsDir)
-	if err := checkLayouts(layoutsDir, &report); err != nil {
-		report = append(report, "✗ 布局检查失败: "+err.Error())
-	} else {
-		report = append(report, "✓ 布局文件检查完成")
+// buildFingerprint 返回影响所有输出的配置和翻译的指纹
+func (s *Site) buildFingerprint() string {
+	cfg := *s.Config
+	cfg.Jobs = 0
+	cfg.Incremental = false
+	return contentHash(cfg, s.Translations)
+}
+
+// collectionDep 返回当前语言集合的依赖名
+func (s *Site) collectionDep(name string) string {
+	return name + "@" + s.Lang
+}
+
+// dependencyHashes 计算当前站点所有依赖的哈希；
+// 集合的元数据和正文分开计算，修改正文只使读取集合正文的页面失效
+func (s *Site) dependencyHashes() map[string]string {
+	deps := make(map[string]string)
+
+	names := make([]string, 0, len(s.Layouts))
+	for name, layout := range s.Layouts {
+		deps["template:"+name] = contentHash(layout.Source)
+		names = append(names, name+"\x00"+deps["template:"+name])
 	}
+	sort.Strings(names)
+	deps["template:*"] = contentHash(names)
 
-	// 3. 检查 Markdown 文件
-	report = append(report, "\n=== 检查 Markdown 文件 ===")
-	if err := checkMarkdownFiles(cfg, &report); err != nil {
-		report = append(report, "✗ Markdown 检查失败: "+err.Error())
-	} else {
-		report = append(report, "✓ Markdown 文件检查完成")
+	for key, value := range s.Data {
+		deps["data:"+key] = contentHash(value)
 	}
+	deps["data:*"] = contentHash(s.Data)
 
-	// 4. 检查样式文件
-	report = append(report, "\n=== 检查样式文件 ===")
-	if err := checkStylesheets(cfg, &report); err != nil {
-		report = append(report, "✗ 样式文件检查失败: "+err.Error())
-	} else {
-		report = append(report, "✓ 样式文件检查完成")
+	type summary struct {
+		Path, URL, Title, Description, Excerpt, Lang string
+		Date                                         time.Time
+		FrontMatter                                  map[string]interface{}
+		Alternates                                   []Alternate
+	}
+	posts := make([]summary, 0, len(s.Posts))
+	var postBodies []string
+	for _, p := range s.Posts {
+		posts = append(posts, summary{p.Path, p.URL, p.Title, p.Description, p.Excerpt, p.Lang, p.Date, p.FrontMatter, p.Alternates})
+		postBodies = append(postBodies, p.Path, p.Content)
 	}
+	deps[s.collectionDep("posts")] = contentHash(posts)
+	deps[s.collectionDep("posts.content")] = contentHash(postBodies)
 
-	// 5. 检查配置文件
-	report = append(report, "\n=== 检查配置文件 ===")
-	if err := checkConfigFile(cfg, &report); err != nil {
-		report = append(report, "✗ 配置文件检查失败: "+err.Error())
-	} else {
-		report = append(report, "✓ 配置文件检查完成")
+	pages := make([]summary, 0, len(s.Pages))
+	var pageBodies []string
+	for _, p := range s.Pages {
+		pages = append(pages, summary{p.Path, p.URL, p.Title, p.Description, p.Excerpt, p.Lang, p.Date, p.FrontMatter, p.Alternates})
+		pageBodies = append(pageBodies, p.Path, p.Content)
 	}
+	deps[s.collectionDep("pages")] = contentHash(pages)
+	deps[s.collectionDep("pages.content")] = contentHash(pageBodies)
+	deps[s.collectionDep("tags")] = contentHash(s.JiebaTags)
 
-	report = append(report, "\n=== 检查完成 ===")
-	return fixed, report
+	return deps
 }
 
-// checkLayouts 检查布局文件
-func checkLayouts(layoutsDir string, report *[]string) error {
-	if _, err := os.Stat(layoutsDir); os.IsNotExist(err) {
-		*report = append(*report, "✗ 布局目录不存在: "+layoutsDir)
-		return fmt.Errorf("布局目录不存在")
+// outputKey 返回页面或文章在依赖图中的键，使用相对源目录的路径
+func (s *Site) outputKey(kind, path string) string {
+	if rel, err := filepath.Rel(s.Config.Source, path); err == nil {
+		path = rel
 	}
+	if s.mirror != nil {
+		kind += "@" + s.Lang // 镜像与原站点的同一源文件是不同的输出
+	}
+	return kind + ":" + filepath.ToSlash(path)
+}
 
-	layouts := []string{"default.html", "post.html", "index.html", "archive.html", "tag.html", "category.html"}
-	foundLayouts := 0
-
-	for _, layout := range layouts {
-		layoutPath := filepath.Join(layoutsDir, layout)
-		if _, err := os.Stat(layoutPath); err == nil {
-			*report = append(*report, "✓ 布局文件存在: "+layout)
-			foundLayouts++
-
-			// 检查布局文件内容
-			if err := checkLayoutContent(layoutPath, report); err != nil {
-				*report = append(*report, "  ⚠ 布局内容有问题: "+err.Error())
-			}
-		} else {
-			*report = append(*report, "✗ 缺少布局文件: "+layout)
+// outputDeps 返回使用指定布局渲染的输出的依赖名，extra 为额外依赖的集合（posts、pages）；
+// 布局读取正文时同时依赖这些集合的正文
+func (s *Site) outputDeps(layoutName string, extra ...string) []string {
+	var deps []string
+	content := false
+	collections := slices.Clone(extra)
+	for _, d := range s.cache.dependencies(s.MasterTemplate, layoutName) {
+		switch d {
+		case "content":
+			content = true
+			continue
+		case "posts", "pages":
+			collections = append(collections, d)
+			continue
+		case "tags":
+			d = s.collectionDep(d)
 		}
+		deps = append(deps, d)
 	}
-
-	if foundLayouts == 0 {
-		*report = append(*report, "⚠ 警告: 没有找到任何布局文件")
+	for _, d := range collections {
+		deps = append(deps, s.collectionDep(d))
+		if content {
+			deps = append(deps, s.collectionDep(d+".content"))
+		}
 	}
-
-	return nil
+	sort.Strings(deps)
+	return slices.Compact(deps)
 }
 
-// checkLayoutContent 检查布局文件内容
-func checkLayoutContent(layoutPath string, report *[]string) error {
-	content, err := os.ReadFile(layoutPath)
-	if err != nil {
+// writeFile 写入输出文件；增量构建时内容未变化的文件不重写
+func (s *Site) writeFile(path string, data []byte) error {
+	if err := s.writeOutput(path, data); err != nil {
 		return err
 	}
+	return s.writeGzipSibling(path, data)
+}
 
-	contentStr := string(content)
-
-	// 检查基本结构
-	if !strings.Contains(contentStr, "<!DOCTYPE html>") {
-		*report = append(*report, "    ⚠ 缺少 DOCTYPE 声明")
+// writeOutput 写入单个输出文件，增量构建时跳过内容相同的写入
+func (s *Site) writeOutput(path string, data []byte) error {
+	if s.cache != nil {
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+			return nil
+		}
 	}
-
-	if !strings.Contains(contentStr, "<html") {
-		*report = append(*report, "    ⚠ 缺少 <html> 标签")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
 	}
+	return os.WriteFile(path, data, 0644)
+}
 
-	if !strings.Contains(contentStr, "<head>") {
-		*report = append(*report, "    ⚠ 缺少 <head> 标签")
+// writeGzipSibling 开启 gzip_static 时为足够大的文本输出写入 .gz 预压缩副本；
+// 不需要副本时删除旧的副本，避免 nginx 提供与原文件不一致的内容
+func (s *Site) writeGzipSibling(path string, data []byte) error {
+	gzPath := path + ".gz"
+	if !s.Config.GzipStatic || !compressible(path) || len(data) < s.Config.GzipMinLength {
+		if err := os.Remove(gzPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
 	}
+	return s.writeOutput(gzPath, gzipBytes(data))
+}
 
-	if !strings.Contains(contentStr, "<body>") {
-		*report = append(*report, "    ⚠ 缺少 <body> 标签")
+// ==================== 定向重建 ====================
+
+// changeKind 文件变化的类型，决定重建方式
+type changeKind int
+
+const (
+	changeOther   changeKind = iota // 与构建无关的文件
+	changeContent                   // 页面或文章
+	changeLayout                    // 布局或包含文件
+	changeData                      // 数据文件
+	changeConfig                    // 配置或翻译文件，影响所有输出
+	changeStatic                    // 静态资源
+)
+
+// String 返回变化类型的名称
+func (k changeKind) String() string {
+	switch k {
+	case changeContent:
+		return "内容"
+	case changeLayout:
+		return "布局"
+	case changeData:
+		return "数据"
+	case changeConfig:
+		return "配置"
+	case changeStatic:
+		return "静态文件"
+	default:
+		return "其他"
 	}
+}
 
-	// 检查模板变量
-	if !strings.Contains(contentStr, "{{") {
-		*report = append(*report, "    ⚠ 没有找到模板变量")
+// classifyChange 判断变化文件的类型；rel 为文件在站点或主题中的相对路径（斜杠分隔）
+func (c *Config) classifyChange(name string) (kind changeKind, rel string) {
+	if c.IsConfigFile(name) {
+		return changeConfig, filepath.Base(name)
 	}
 
-	// 检查内容占位符
-	if !strings.Contains(contentStr, "{{.content}}") && !strings.Contains(contentStr, "{{ content }}") {
-		*report = append(*report, "    ⚠ 没有找到内容占位符 {{.content}}")
+	// 依次在站点和主题中定位文件
+	inSite := true
+	rel, err := filepath.Rel(c.Source, name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		inSite = false
+		theme := c.ThemeDir()
+		if theme == "" || !isWithin(name, theme) {
+			return changeOther, ""
+		}
+		rel, _ = filepath.Rel(theme, name)
 	}
+	rel = filepath.ToSlash(rel)
+	top := strings.SplitN(rel, "/", 2)[0]
 
-	return nil
+	switch {
+	case top == c.LayoutsDir || top == c.IncludesDir:
+		return changeLayout, rel
+	case top == c.DataDir:
+		return changeData, rel
+	case top == c.I18nDir:
+		return changeConfig, rel
+	case slices.Contains(staticDirs, top):
+		return changeStatic, rel
+	case inSite && top == c.PostsDir:
+		return changeContent, rel
+	case inSite && c.IsMarkdownFile(name) && !strings.HasPrefix(rel, "_") && !c.IsExcluded(rel):
+		return changeContent, rel
+	case inSite && c.isNotFoundPage(rel):
+		return changeContent, rel
+	}
+	return changeOther, rel
 }
 
-// checkMarkdownFiles 检查 Markdown 文件
-func checkMarkdownFiles(cfg *Config, report *[]string) error {
-	// 检查页面文件
-	if err := checkMarkdownInDir(cfg.Source, cfg, report, "页面"); err != nil {
-		return err
-	}
+// snapshotReuse 定向重建时可以从上一次快照复用的内容
+type snapshotReuse struct {
+	prev           *Site
+	pages          map[string]*Page // 未变化的页面，按源文件路径索引
+	posts          map[string]*Post // 未变化的文章，按源文件路径索引
+	contentChanged bool             // 有页面或文章变化，需要重新计算标签云和搜索树
+}
 
-	// 检查文章文件
-	postsDir := filepath.Join(cfg.Source, cfg.PostsDir)
-	if _, err := os.Stat(postsDir); err == nil {
-		if err := checkMarkdownInDir(postsDir, cfg, report, "文章"); err != nil {
-			return err
+// newSnapshotReuse 从上一次快照中挑出未变化的页面和文章
+func newSnapshotReuse(prev *Site, dirty map[string]bool, contentChanged bool) *snapshotReuse {
+	r := &snapshotReuse{
+		prev:           prev,
+		pages:          make(map[string]*Page),
+		posts:          make(map[string]*Post),
+		contentChanged: contentChanged,
+	}
+	for _, p := range prev.Pages {
+		if !dirty[p.Path] {
+			r.pages[p.Path] = p
 		}
-	} else {
-		*report = append(*report, "⚠ 文章目录不存在: "+postsDir)
 	}
+	for _, p := range prev.Posts {
+		if !dirty[p.Path] {
+			r.posts[p.Path] = p
+		}
+	}
+	return r
+}
 
-	return nil
+// page 返回可复用页面的副本，渲染结果和翻译关联会在新快照中重新生成
+func (r *snapshotReuse) page(path string) *Page {
+	if r == nil {
+		return nil
+	}
+	old, ok := r.pages[path]
+	if !ok {
+		return nil
+	}
+	p := *old
+	p.RenderedContent = ""
+	p.Alternates = nil
+	return &p
 }
 
-// checkMarkdownInDir 检查目录中的 Markdown 文件
-func checkMarkdownInDir(dir string, cfg *Config, report *[]string, fileType string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// post 返回可复用文章的副本
+func (r *snapshotReuse) post(path string) *Post {
+	if r == nil {
+		return nil
+	}
+	old, ok := r.posts[path]
+	if !ok {
+		return nil
+	}
+	p := *old
+	p.RenderedContent = ""
+	p.Alternates = nil
+	return &p
+}
+
+// Rebuild 根据变化的文件选择代价最小的重建方式：配置变化时完整构建，
+// 只有静态文件变化时只复制这些文件，其余情况复用上一次快照并按依赖图只渲染受影响的输出
+func (s *Site) Rebuild(changed []string) error {
+	start := time.Now()
+
+	s.buildMu.Lock()
+	cfg := s.Config
+	s.buildMu.Unlock()
+
+	kinds := make(map[changeKind]int)
+	dirty := make(map[string]bool)
+	var static []string
+	analysisChanged := false // 分词词典或同义词变化，需要重新计算标签云和搜索索引
+	for _, name := range changed {
+		kind, rel := cfg.classifyChange(name)
+		kinds[kind]++
+		switch kind {
+		case changeContent:
+			dirty[filepath.Clean(name)] = true
+		case changeData:
+			if rel == path.Join(cfg.DataDir, userDictFile) || rel == path.Join(cfg.DataDir, synonymsFile) {
+				analysisChanged = true
+			}
+		case changeStatic:
+			static = append(static, rel)
+		}
+	}
+
+	prev := s.Snapshot()
+	switch {
+	case prev == nil || kinds[changeConfig] > 0:
+		// 配置、翻译变化或还没有成功的构建
+		if err := s.Build(); err != nil {
 			return err
 		}
+		log.Printf("完整重建（%s），耗时 %v", describeChanges(kinds), time.Since(start))
 
-		if info.IsDir() {
-			// 跳过特殊目录
-			relPath, _ := filepath.Rel(dir, path)
-			if strings.HasPrefix(relPath, "_") || strings.HasPrefix(relPath, ".") {
-				return filepath.SkipDir
+	case kinds[changeContent] == 0 && kinds[changeLayout] == 0 && kinds[changeData] == 0:
+		// 只有静态文件变化，不需要重新渲染
+		for _, name := range static {
+			if err := s.syncStaticFile(name); err != nil {
+				return fmt.Errorf("复制静态文件 %s 失败: %w", name, err)
 			}
+		}
+		if len(static) == 0 {
+			log.Printf("忽略与构建无关的变化: %s", strings.Join(changed, ", "))
 			return nil
 		}
+		log.Printf("复制静态文件: %s，耗时 %v", strings.Join(static, ", "), time.Since(start))
 
-		// 只检查 Markdown 文件
-		if !cfg.IsMarkdownFile(path) {
+	default:
+		reuse := newSnapshotReuse(prev, dirty, kinds[changeContent] > 0 || analysisChanged)
+		if err := s.rebuild(reuse); err != nil {
+			return err
+		}
+		for _, name := range static {
+			if err := s.syncStaticFile(name); err != nil {
+				return fmt.Errorf("复制静态文件 %s 失败: %w", name, err)
+			}
+		}
+
+		if s.memory {
+			log.Printf("定向重建（%s）: 已重新加载，页面将在下次请求时渲染，耗时 %v", describeChanges(kinds), time.Since(start))
 			return nil
 		}
 
-		// 检查文件内容
-		if err := checkMarkdownContent(path, report, fileType); err != nil {
-			*report = append(*report, "✗ "+fileType+"文件检查失败 "+filepath.Base(path)+": "+err.Error())
-		} else {
-			*report = append(*report, "✓ "+fileType+"文件正常: "+filepath.Base(path))
+		rendered := s.Snapshot().cache.renderedOutputs()
+		log.Printf("定向重建（%s）: 重新渲染 %d 个输出，耗时 %v", describeChanges(kinds), len(rendered), time.Since(start))
+		for _, key := range rendered {
+			log.Printf("  重新渲染: %s", key)
 		}
+	}
+	return nil
+}
 
-		return nil
-	})
+// describeChanges 描述各类变化的文件数量
+func describeChanges(kinds map[changeKind]int) string {
+	var parts []string
+	for kind := changeContent; kind <= changeStatic; kind++ {
+		if n := kinds[kind]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d 个", kind, n))
+		}
+	}
+	if len(parts) == 0 {
+		return "无变化"
+	}
+	return strings.Join(parts, "，")
 }
 
-// checkMarkdownContent 检查 Markdown 文件内容
-func checkMarkdownContent(filePath string, report *[]string, fileType string) error {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+// syncStaticFile 把静态文件或目录的当前版本复制到输出目录；所有文件层都没有时说明已删除，从输出目录移除
+func (s *Site) syncStaticFile(name string) error {
+	if s.memory {
+		return nil // 开发模式直接从文件层提供静态文件
 	}
 
-	contentStr := string(content)
+	for _, layer := range s.fileLayers() {
+		info, err := fs.Stat(layer.FS, name)
+		if err != nil {
+			continue
+		}
 
-	// 检查前置数据
-	if !strings.Contains(contentStr, "---") {
-		*report = append(*report, "    ⚠ 缺少前置数据分隔符 ---")
-		return fmt.Errorf("缺少前置数据")
-	}
+		if !info.IsDir() {
+			return s.copyLayerFile(layeredFile{Name: name, Layer: layer}, filepath.Join(s.Config.Destination, filepath.FromSlash(name)))
+		}
 
-	// 解析前置数据
-	fm, _, err := Parse(contentStr)
-	if err != nil {
-		return fmt.Errorf("前置数据解析失败: %w", err)
+		files, err := s.walkLayered(name)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := s.copyLayerFile(f, filepath.Join(s.Config.Destination, filepath.FromSlash(f.Name))); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	// 检查必要字段
-	if title, ok := fm["title"].(string); ok && title != "" {
-		*report = append(*report, "    ✓ 标题: "+title)
-	} else {
-		*report = append(*report, "    ⚠ 缺少标题")
-	}
+	dest := filepath.Join(s.Config.Destination, filepath.FromSlash(name))
+	os.Remove(dest + ".gz")
+	return os.RemoveAll(dest)
+}
 
-	if layout, ok := fm["layout"].(string); ok && layout != "" {
-		*report = append(*report, "    ✓ 布局: "+layout)
-	} else {
-		*report = append(*report, "    ⚠ 缺少布局设置")
+// ==================== 站点管理 ====================
+
+// Site 表示Jekyll站点
+type Site struct {
+	Config         *Config
+	Pages          []*Page
+	Posts          []*Post
+	Layouts        map[string]*Layout
+	Data           map[string]interface{}
+	Converter      *MarkdownConverter
+	Template       *Engine
+	MasterTemplate *template.Template // 存储所有解析后的模板，只用于克隆渲染上下文
+	renderPool     chan *renderContext
+	cache          *buildCache // 增量构建缓存，未启用时为 nil
+
+	mu sync.RWMutex
+
+	// 构建快照：每次构建在新的 Site 上进行，成功后原子替换
+	buildMu  sync.Mutex
+	snapshot atomic.Pointer[Site]
+	watching bool           // 监听模式：始终记录依赖图，使重建只渲染受影响的输出
+	reuse    *snapshotReuse // 定向重建时复用的上一次快照内容
+
+	// 开发模式：快照只加载不渲染，输出在首次请求时渲染并保存在内存中
+	memory   bool
+	sites    []*Site              // 各语言子站点，单语言站点只包含自身
+	index    *siteIndex           // 标签云和搜索树，开发模式下在后台构建完成前为 nil
+	routes   map[string]*devRoute // 开发模式的路由表：规范路径 -> 按需渲染的输出
+	loadedAt time.Time            // 快照加载完成的时间，作为开发模式输出的 Last-Modified
+
+	searchOnce    sync.Once // 开发模式下后台索引完成前，按需构建的搜索索引
+	pendingSearch *searchIndex
+	userDict      []userWord // 数据目录中的 jieba_user.dict
+	synonyms      synonymSet // 数据目录中的 synonyms.yml，搜索时扩展查询
+
+	// 新增分页和归档结构体
+	PagedPosts [][]*Post
+	Archives   map[string][]*Post // "2024-07" => []*Post
+	JiebaTags  []string           // 高频词标签云
+	RouteTree  *treemap.Map       // key: 路由path, value: 主路径
+	URLTree    *URLTree           // URL二叉树，用于搜索
+
+	// RSS 和 Sitemap 相关
+	RSSFeed    string // RSS feed 内容
+	SitemapXML string // Sitemap XML 内容
+
+	// 多语言
+	Lang         string                            // 当前构建的语言代码
+	LangPrefix   string                            // 当前语言的永久链接前缀
+	Translations map[string]map[string]interface{} // 语言代码 -> 翻译字符串
+	mirror       *chineseMirror                    // 繁简镜像子站点的配置，其他站点为 nil
+}
+
+// New 创建新的站点实例
+func New(cfg *Config) *Site {
+	s := &Site{
+		Config:    cfg,
+		Pages:     make([]*Page, 0),
+		Posts:     make([]*Post, 0),
+		Layouts:   make(map[string]*Layout),
+		Data:      make(map[string]interface{}),
+		Converter: NewConverter(cfg),
+		URLTree:   NewURLTree(),
+		Lang:      cfg.DefaultLang,
 	}
+	s.Template = NewEngine(cfg, s) // Pass the site instance to NewEngine
+	return s
+}
 
-	// 检查文章特有字段
-	if fileType == "文章" {
-		if date, ok := fm["date"].(time.Time); ok && !date.IsZero() {
-			*report = append(*report, "    ✓ 日期: "+date.Format("2006-01-02"))
-		} else if dateStr, ok := fm["date"].(string); ok && dateStr != "" {
-			*report = append(*report, "    ✓ 日期: "+dateStr)
-		} else {
-			*report = append(*report, "    ⚠ 缺少日期")
-		}
+// Build 构建站点。每次构建都在新的站点快照上从头加载和渲染，成功后原子替换当前快照；
+// 失败时保留上一次的快照，因此读取方（如服务器）不会看到构建中途或重复累积的状态
+func (s *Site) Build() error {
+	return s.rebuild(nil)
+}
 
-		// 检查文件名格式（仅对文章）
-		filename := filepath.Base(filePath)
-		if !filenameRegex.MatchString(filename) {
-			*report = append(*report, "    ⚠ 文件名格式不正确，应为: YYYY-MM-DD-title.md")
+// rebuild 在新的快照上构建，reuse 不为 nil 时复用上一次快照中未变化的内容
+func (s *Site) rebuild(reuse *snapshotReuse) error {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	return s.swap(reuse)
+}
+
+// swap 构建新的快照并原子替换当前快照，调用方需持有 buildMu。
+// 开发模式下快照只加载不渲染，标签云和搜索树在后台构建
+func (s *Site) swap(reuse *snapshotReuse) error {
+	cfg := s.Config
+	if s.watching && !s.memory && !cfg.Incremental {
+		c := *cfg
+		c.Incremental = true
+		cfg = &c
+	}
+
+	snap := New(cfg)
+	snap.reuse = reuse
+	snap.memory = s.memory
+	if s.memory {
+		if err := snap.load(); err != nil {
+			return err
 		}
+	} else if err := snap.build(); err != nil {
+		return err
 	}
+	snap.reuse = nil
+	snap.loadedAt = time.Now()
+	s.snapshot.Store(snap)
 
+	if snap.memory && snap.index == nil {
+		go s.indexSnapshot(snap)
+	}
 	return nil
 }
 
-// checkStylesheets 检查样式文件
-func checkStylesheets(cfg *Config, report *[]string) error {
-	stylesheetsDir := filepath.Join(cfg.Source, "stylesheets")
-	if _, err := os.Stat(stylesheetsDir); os.IsNotExist(err) {
-		*report = append(*report, "✗ 样式目录不存在: "+stylesheetsDir)
-		return fmt.Errorf("样式目录不存在")
+// indexSnapshot 在后台为开发模式的快照构建标签云和搜索树，完成后换上带索引的快照副本，不重新加载站点；
+// 期间快照已被替换时放弃，由新快照自己的后台任务负责
+func (s *Site) indexSnapshot(snap *Site) {
+	start := time.Now()
+	idx := snap.buildIndex()
+
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if s.Snapshot() != snap {
+		return
 	}
+	s.snapshot.Store(snap.withIndex(idx))
+	log.Printf("标签云和搜索索引已就绪，耗时 %v", time.Since(start))
+}
 
-	// 检查主要样式文件
-	mainStyles := []string{"site.css", "site.scss"}
-	foundStyles := 0
+// withIndex 返回应用了标签云和搜索树的快照副本（写时复制），原快照保持不变。
+// 页面、文章和模板与原快照共享；已按需渲染且不读取标签云的输出沿用原快照的结果
+func (s *Site) withIndex(idx *siteIndex) *Site {
+	c := s.shallowCopy()
+	c.applyIndex(idx)
+	c.sites = make([]*Site, len(s.sites))
+	for i, ls := range s.sites {
+		if ls == s {
+			c.sites[i] = c
+			continue
+		}
+		c.sites[i] = ls.shallowCopy()
+		c.sites[i].applyIndex(idx)
+	}
 
-	for _, style := range mainStyles {
-		stylePath := filepath.Join(stylesheetsDir, style)
-		if _, err := os.Stat(stylePath); err == nil {
-			*report = append(*report, "✓ 样式文件存在: "+style)
-			foundStyles++
+	c.routes = make(map[string]*devRoute, len(s.routes))
+	for _, r := range c.outputRoutes() {
+		if old, ok := s.routes[r.Path]; ok && !r.Tags {
+			c.routes[r.Path] = old
 		} else {
-			*report = append(*report, "✗ 缺少样式文件: "+style)
+			c.routes[r.Path] = &devRoute{render: r.Render}
 		}
 	}
+	c.loadedAt = time.Now()
+	return c
+}
 
-	if foundStyles == 0 {
-		*report = append(*report, "⚠ 警告: 没有找到任何样式文件")
-	}
+// shallowCopy 复制站点快照的字段，不复制锁和按需构建的搜索索引；渲染上下文池和主模板共享
+func (s *Site) shallowCopy() *Site {
+	c := &Site{
+		Config:         s.Config,
+		Pages:          s.Pages,
+		Posts:          s.Posts,
+		Layouts:        s.Layouts,
+		Data:           s.Data,
+		Converter:      s.Converter,
+		MasterTemplate: s.MasterTemplate,
+		renderPool:     s.renderPool,
+		cache:          s.cache,
+		watching:       s.watching,
+		memory:         s.memory,
+		sites:          s.sites,
+		index:          s.index,
+		routes:         s.routes,
+		loadedAt:       s.loadedAt,
+		userDict:       s.userDict,
+		synonyms:       s.synonyms,
+		PagedPosts:     s.PagedPosts,
+		Archives:       s.Archives,
+		JiebaTags:      s.JiebaTags,
+		RouteTree:      s.RouteTree,
+		URLTree:        s.URLTree,
+		RSSFeed:        s.RSSFeed,
+		SitemapXML:     s.SitemapXML,
+		Lang:           s.Lang,
+		LangPrefix:     s.LangPrefix,
+		Translations:   s.Translations,
+		mirror:         s.mirror,
+	}
+	c.Template = NewEngine(c.Config, c)
+	return c
+}
 
-	return nil
+// SetConfig 替换站点配置，下一次构建生效
+func (s *Site) SetConfig(cfg *Config) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	s.Config = cfg
 }
 
-// checkConfigFile 检查配置文件
-func checkConfigFile(cfg *Config, report *[]string) error {
-	configExtensions := []string{".yml", ".yaml", ".toml"}
-	configFound := false
+// Snapshot 返回最近一次成功构建的站点快照，快照构建完成后不再修改；尚未构建时返回 nil
+func (s *Site) Snapshot() *Site {
+	return s.snapshot.Load()
+}
 
-	for _, ext := range configExtensions {
-		configPath := filepath.Join(cfg.Source, "_config"+ext)
-		if _, err := os.Stat(configPath); err == nil {
-			*report = append(*report, "✓ 配置文件存在: _config"+ext)
-			configFound = true
+// build 在当前站点上执行完整的构建流程，只应在新建的快照上调用
+func (s *Site) build() error {
+	log.Println("开始构建站点...")
 
-			// 检查配置文件内容
-			if err := checkConfigContent(configPath, report); err != nil {
-				*report = append(*report, "  ⚠ 配置文件内容有问题: "+err.Error())
+	// 1-6. 加载内容，准备模板、集合、索引和路由
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	// 7. 按语言渲染、写入并生成 RSS Feed
+	for _, ls := range s.sites {
+		if err := ls.buildLanguage(); err != nil {
+			if ls != s {
+				return fmt.Errorf("构建语言 %s 失败: %w", ls.Lang, err)
 			}
-			break
+			return err
 		}
 	}
 
-	if !configFound {
-		*report = append(*report, "⚠ 没有找到配置文件，将使用默认配置")
+	// 9. 生成 Sitemap
+	if err := s.generateSitemap(); err != nil {
+		return fmt.Errorf("生成Sitemap失败: %w", err)
 	}
 
-	return nil
-}
-
-// checkConfigContent 检查配置文件内容
-func checkConfigContent(configPath string, report *[]string) error {
-	content, err := os.ReadFile(configPath)
-	if err != nil {
+	// 10. 生成静态搜索索引
+	if err := s.generateSearchIndex(); err != nil {
 		return err
 	}
 
-	contentStr := string(content)
+	// 11. 复制静态文件
+	if err := s.copyStaticFiles(); err != nil {
+		return fmt.Errorf("复制静态文件失败: %w", err)
+	}
 
-	// 检查基本配置项
-	requiredFields := []string{"title", "description", "author", "url"}
-	for _, field := range requiredFields {
-		if !strings.Contains(contentStr, field+":") {
-			*report = append(*report, "    ⚠ 缺少配置项: "+field)
-		} else {
-			*report = append(*report, "    ✓ 配置项存在: "+field)
-		}
+	// 12. 保存构建缓存
+	if err := s.cache.save(); err != nil {
+		return fmt.Errorf("保存构建缓存失败: %w", err)
 	}
 
+	log.Printf("构建完成: %d 个页面, %d 篇文章", len(s.Pages), len(s.Posts))
 	return nil
 }
 
-func createNewPost(title string, cfg *Config) error {
-	// 生成文件名
-	dir := "_posts"
-	if cfg.PostsDir != "" {
-		dir = cfg.PostsDir
+// load 加载站点内容并准备渲染所需的模板、集合、各语言子站点、索引和路由表，不渲染也不写入
+func (s *Site) load() error {
+	// 1. 读取数据文件，应用自定义分词词典和同义词
+	if err := s.loadData(); err != nil {
+		return fmt.Errorf("加载数据失败: %w", err)
 	}
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+	analyzer.UseUserDict(s.userDict)
+	s.synonyms = parseSynonyms(s.Data[strings.TrimSuffix(synonymsFile, path.Ext(synonymsFile))])
+
+	// 2. 读取布局文件
+	if err := s.loadLayouts(); err != nil {
+		return fmt.Errorf("加载布局失败: %w", err)
 	}
 
-	date := time.Now()
-	slug := strings.ToLower(strings.ReplaceAll(title, " ", "-"))
-	filename := filepath.Join(dir, date.Format("2006-01-02")+"-"+slug+".md")
-	if _, err := os.Stat(filename); err == nil {
-		return fmt.Errorf("文件已存在: %s", filename)
+	// 2.5. 读取包含文件
+	if err := s.loadIncludes(); err != nil {
+		return fmt.Errorf("加载包含文件失败: %w", err)
 	}
 
-	frontMatter := "---\n" +
-		"layout: post\n" +
-		"title: \"" + title + "\"\n" +
-		"date: " + date.Format("2006-01-02 15:04:05 -0700") + "\n" +
-		"categories: []\n" +
-		"tags: []\n" +
-		"comments: true\n" +
-		"---\n\n这里是正文内容。\n"
+	// 2.6. 读取翻译文件
+	if err := s.loadTranslations(); err != nil {
+		return fmt.Errorf("加载翻译失败: %w", err)
+	}
 
-	return os.WriteFile(filename, []byte(frontMatter), 0644)
-}
+	// 3. 读取页面文件
+	if err := s.loadPages(); err != nil {
+		return fmt.Errorf("加载页面失败: %w", err)
+	}
 
-func createNewPage(name string, cfg *Config) error {
-	// 生成文件名
+	// 4. 读取文章文件
+	if err := s.loadPosts(); err != nil {
+		return fmt.Errorf("加载文章失败: %w", err)
+	}
 
-	dir := name
-	if strings.ContainsAny(name, "/\\") {
-		dir = filepath.Dir(name)
-		name = filepath.Base(name)
+	// 4.5. 初始化MasterTemplate
+	if err := s.initMasterTemplate(); err != nil {
+		return fmt.Errorf("初始化主模板失败: %w", err)
 	}
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+
+	// 5. 处理分页、归档、标签、分类数据
+	s.processCollections()
+
+	// 6. 构建Jieba标签云和URL二叉树：定向重建且页面文章都未变化时沿用上一次快照的结果；
+	// 开发模式下留给后台构建，使站点可以立即访问
+	switch r := s.reuse; {
+	case r != nil && !r.contentChanged && r.prev.index != nil:
+		s.applyIndex(r.prev.index)
+	case !s.memory:
+		s.applyIndex(s.buildIndex())
 	}
-	filename := filepath.Join(dir, "index.md")
-	if _, err := os.Stat(filename); err == nil {
-		return fmt.Errorf("文件已存在: %s", filename)
+
+	// 6.5. 关联不同语言的翻译版本
+	s.linkTranslations()
+
+	// 6.6. 增量构建时读取上次的依赖图
+	if s.Config.Incremental && !s.memory {
+		s.cache = openBuildCache(s.Config, s.buildFingerprint())
 	}
-	date := time.Now()
-	frontMatter := "---\n" +
-		"layout: page\n" +
-		"title: \"" + name + "\"\n" +
-		"date: " + date.Format("2006-01-02 15:04:05 -0700") + "\n" +
-		"comments: true\n" +
-		"sharing: true\n" +
-		"footer: true\n" +
-		"---\n\n这里是页面内容。\n"
-	return os.WriteFile(filename, []byte(frontMatter), 0644)
-}
 
-// ==================== 文件监听器 ====================
+	// 6.7. 准备各语言的子站点
+	if err := s.prepareLanguages(); err != nil {
+		return err
+	}
 
-// FileWatcher 增强的文件监听器，支持SHA256哈希值比较
-type FileWatcher struct {
-	watcher    *fsnotify.Watcher
-	site       *Site
-	config     *Config
-	fileHashes map[string]string // 文件路径 -> SHA256哈希值
-	mu         sync.RWMutex
-	debounce   time.Duration
-	timer      *time.Timer
-	rebuildCh  chan struct{}
+	// 6.8. 构建路由树（开发模式下同时建立按需渲染的路由表）
+	s.buildRouteTree()
+	return nil
 }
 
-// NewFileWatcher 创建新的文件监听器
-func NewFileWatcher(site *Site, cfg *Config) (*FileWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, fmt.Errorf("创建文件监听器失败: %w", err)
-	}
-
-	fw := &FileWatcher{
-		watcher:    watcher,
-		site:       site,
-		config:     cfg,
-		fileHashes: make(map[string]string),
-		debounce:   500 * time.Millisecond, // 500ms防抖
-		rebuildCh:  make(chan struct{}, 1),
+// prepareLanguages 创建各语言的子站点和繁简镜像；子站点使用各自的主模板，使 t 和 include 绑定到当前语言
+func (s *Site) prepareLanguages() error {
+	s.sites = s.languageSites()
+	if ms := s.mirrorSite(s.sites[0]); ms != nil {
+		s.sites = append(s.sites, ms)
 	}
-
-	// 初始化文件哈希值
-	if err := fw.initializeFileHashes(); err != nil {
-		watcher.Close()
-		return nil, fmt.Errorf("初始化文件哈希值失败: %w", err)
+	for _, ls := range s.sites {
+		if ls == s {
+			continue
+		}
+		if err := ls.initMasterTemplate(); err != nil {
+			return fmt.Errorf("初始化语言 %s 的主模板失败: %w", ls.Lang, err)
+		}
+		ls.processCollections()
+		if s.index != nil {
+			ls.applyIndex(s.index)
+		}
 	}
-
-	return fw, nil
+	return nil
 }
 
-// initializeFileHashes 初始化所有监听文件的哈希值
-func (fw *FileWatcher) initializeFileHashes() error {
-	dirs := []string{".", "_posts", "_layouts", "_includes", "_data"}
+// buildLanguage 渲染并写入一种语言的内容；单语言站点即站点自身
+func (s *Site) buildLanguage() error {
+	// 渲染所有内容
+	if err := s.render(); err != nil {
+		return fmt.Errorf("渲染失败: %w", err)
+	}
 
-	for _, dir := range dirs {
-		if err := fw.watcher.Add(dir); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("添加监听目录失败 %s: %w", dir, err)
-		}
+	// 写入输出目录
+	if err := s.write(); err != nil {
+		return fmt.Errorf("写入失败: %w", err)
+	}
 
-		// 计算目录下所有文件的哈希值
-		if err := fw.calculateDirHashes(dir); err != nil {
-			return fmt.Errorf("计算目录哈希值失败 %s: %w", dir, err)
-		}
+	// 生成 RSS Feed
+	if err := s.generateRSSFeed(); err != nil {
+		return fmt.Errorf("生成RSS Feed失败: %w", err)
 	}
 
 	return nil
 }
 
-// calculateDirHashes 计算目录下所有文件的哈希值
-func (fw *FileWatcher) calculateDirHashes(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// loadData 加载数据文件（站点和主题的数据文件，站点优先）
+func (s *Site) loadData() error {
+	files, err := s.walkLayered(s.Config.DataDir)
+	if err != nil {
+		return err
+	}
 
-		// 跳过目录和隐藏文件
-		if info.IsDir() || strings.HasPrefix(filepath.Base(path), ".") {
-			return nil
+	for _, f := range files {
+		// 自定义分词词典
+		if f.Name == path.Join(s.Config.DataDir, userDictFile) {
+			data, err := fs.ReadFile(f.Layer.FS, f.Name)
+			if err != nil {
+				return fmt.Errorf("读取分词词典 %s 失败: %w", f.Layer.displayPath(f.Name), err)
+			}
+			s.userDict = parseUserDict(data, f.Layer.displayPath(f.Name))
+			log.Printf("加载分词词典: %s，%d 个词", f.Layer.displayPath(f.Name), len(s.userDict))
+			continue
 		}
 
-		// 跳过_site目录
-		if strings.Contains(path, "_site") {
-			return nil
+		// 只处理YAML文件
+		ext := path.Ext(f.Name)
+		if ext != ".yml" && ext != ".yaml" {
+			continue
 		}
 
-		hash, err := fw.calculateFileHash(path)
+		// 读取并解析数据文件
+		displayPath := f.Layer.displayPath(f.Name)
+		data, err := fs.ReadFile(f.Layer.FS, f.Name)
 		if err != nil {
-			return fmt.Errorf("计算文件哈希值失败 %s: %w", path, err)
+			return fmt.Errorf("读取数据文件 %s 失败: %w", displayPath, err)
 		}
 
-		fw.mu.Lock()
-		fw.fileHashes[path] = hash
-		fw.mu.Unlock()
+		var fileData interface{}
+		if err := yaml.Unmarshal(data, &fileData); err != nil {
+			return fmt.Errorf("解析数据文件 %s 失败: %w", displayPath, err)
+		}
 
-		return nil
-	})
+		// 使用文件名（不含扩展名）作为键
+		key := strings.TrimSuffix(path.Base(f.Name), ext)
+		s.Data[key] = fileData
+
+		log.Printf("加载数据文件: %s", displayPath)
+	}
+	return nil
 }
 
-// calculateFileHash 计算单个文件的SHA256哈希值
-func (fw *FileWatcher) calculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// loadLayouts 加载布局文件（站点、主题和内置主题的布局，站点优先）
+func (s *Site) loadLayouts() error {
+	files, err := s.walkLayered(s.Config.LayoutsDir)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer file.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
+	for _, f := range files {
+		// 只处理HTML文件
+		ext := path.Ext(f.Name)
+		if ext != ".html" && ext != ".htm" {
+			continue
+		}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
+		// 读取布局文件
+		displayPath := f.Layer.displayPath(f.Name)
+		content, err := fs.ReadFile(f.Layer.FS, f.Name)
+		if err != nil {
+			return fmt.Errorf("读取布局文件 %s 失败: %w", displayPath, err)
+		}
 
-// hasFileChanged 检查文件是否发生变化
-func (fw *FileWatcher) hasFileChanged(filePath string) (bool, error) {
-	newHash, err := fw.calculateFileHash(filePath)
-	if err != nil {
-		return false, err
-	}
+		// 创建布局对象
+		layoutName := strings.TrimSuffix(path.Base(f.Name), ext)
+		layout := NewLayout(layoutName, string(content))
+		layout.Path = displayPath
+		layout.Source = string(content)
 
-	fw.mu.RLock()
-	oldHash, exists := fw.fileHashes[filePath]
-	fw.mu.RUnlock()
+		s.mu.Lock()
+		s.Layouts[layoutName] = layout
+		s.mu.Unlock()
 
-	if !exists {
-		// 新文件
-		fw.mu.Lock()
-		fw.fileHashes[filePath] = newHash
-		fw.mu.Unlock()
-		return true, nil
+		log.Printf("加载文件布局: %s (%s)", layoutName, f.Layer.Name)
 	}
+	return nil
+}
 
-	if oldHash != newHash {
-		// 文件内容发生变化
-		fw.mu.Lock()
-		fw.fileHashes[filePath] = newHash
-		fw.mu.Unlock()
-		return true, nil
+// loadIncludes 加载包含文件（站点、主题和内置主题的包含文件，站点优先）
+func (s *Site) loadIncludes() error {
+	files, err := s.walkLayered(s.Config.IncludesDir)
+	if err != nil {
+		return err
 	}
 
-	return false, nil
-}
+	// 正则表达式匹配 {{ define "name" }} 和 {{ end }}
+	defineStartRegex := regexp.MustCompile(`(?sU)^\s*\{\{\s*define\s*"([^"]+)"\s*\}\}\s*`)
+	defineEndRegex := regexp.MustCompile(`\s*\{\{\s*end\s*\}\}\s*$`)
 
-// removeFileHash 移除文件的哈希值记录（文件被删除时）
-func (fw *FileWatcher) removeFileHash(filePath string) {
-	fw.mu.Lock()
-	delete(fw.fileHashes, filePath)
-	fw.mu.Unlock()
-}
+	for _, f := range files {
+		// 只处理HTML文件
+		ext := path.Ext(f.Name)
+		if ext != ".html" && ext != ".htm" {
+			continue
+		}
 
-// debouncedRebuild 防抖重建
-func (fw *FileWatcher) debouncedRebuild() {
-	if fw.timer != nil {
-		fw.timer.Stop()
-	}
+		// 读取包含文件
+		displayPath := f.Layer.displayPath(f.Name)
+		contentBytes, err := fs.ReadFile(f.Layer.FS, f.Name)
+		if err != nil {
+			return fmt.Errorf("读取包含文件 %s 失败: %w", displayPath, err)
+		}
+		content := string(contentBytes)
 
-	fw.timer = time.AfterFunc(fw.debounce, func() {
-		select {
-		case fw.rebuildCh <- struct{}{}:
-		default:
+		// 记录被移除的 define 前缀，以便错误行号映射回源文件
+		lineOffset, colOffset := 0, 0
+		if prefix := defineStartRegex.FindString(content); prefix != "" {
+			lineOffset = strings.Count(prefix, "\n")
+			colOffset = len(prefix) - strings.LastIndex(prefix, "\n") - 1
 		}
-	})
-}
 
-// Start 开始监听文件变化
-func (fw *FileWatcher) Start() error {
-	fmt.Println("[watch] 正在监听文件变化，按 Ctrl+C 退出...")
+		// 移除 {{ define "name" }} 和与之配对的末尾 {{ end }}，保留正文中的其他 {{ end }}
+		if lineOffset > 0 || colOffset > 0 {
+			content = defineStartRegex.ReplaceAllString(content, "")
+			content = defineEndRegex.ReplaceAllString(content, "")
+		}
 
-	// 启动重建协程
-	go fw.rebuildWorker()
+		// 创建布局对象，这里复用Layout结构体，但表示的是include
+		includeName := strings.TrimSuffix(path.Base(f.Name), ext)
+		includeLayout := NewLayout(includeName, content)
+		includeLayout.Path = displayPath
+		includeLayout.Source = string(contentBytes)
+		includeLayout.LineOffset = lineOffset
+		includeLayout.ColOffset = colOffset
 
-	for {
-		select {
-		case event, ok := <-fw.watcher.Events:
-			if !ok {
-				return nil
-			}
-			fw.handleFileEvent(event)
+		s.mu.Lock()
+		s.Layouts[includeName] = includeLayout // 存储在Layouts中，方便统一管理
+		s.mu.Unlock()
 
-		case err, ok := <-fw.watcher.Errors:
-			if !ok {
-				return nil
-			}
-			fmt.Printf("[watch] 错误: %v\n", err)
-		}
+		log.Printf("加载包含: %s (%s)", includeName, f.Layer.Name)
 	}
+	return nil
 }
 
-// handleFileEvent 处理文件事件
-func (fw *FileWatcher) handleFileEvent(event fsnotify.Event) {
-	// 跳过隐藏文件和_site目录
-	if strings.HasPrefix(filepath.Base(event.Name), ".") ||
-		strings.Contains(event.Name, "_site") {
-		return
+// isHTMLPage 判断 HTML 文件是否作为页面处理：以前置数据开头，且不在原样复制的静态资源目录中
+func isHTMLPage(path, relPath string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".html") {
+		return false
+	}
+	if slices.Contains(staticDirs, strings.SplitN(filepath.ToSlash(relPath), "/", 2)[0]) {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
 	}
+	defer f.Close()
+	head := make([]byte, 5)
+	n, _ := io.ReadFull(f, head)
+	return bytes.HasPrefix(head[:n], []byte("---\n")) || bytes.HasPrefix(head[:n], []byte("---\r\n"))
+}
 
-	switch {
-	case event.Op&fsnotify.Write == fsnotify.Write:
-		// 文件写入
-		if changed, err := fw.hasFileChanged(event.Name); err != nil {
-			fmt.Printf("[watch] 检查文件变化失败 %s: %v\n", event.Name, err)
-		} else if changed {
-			fmt.Printf("[watch] 检测到文件变化: %s\n", event.Name)
-			fw.debouncedRebuild()
+// loadPages 加载页面文件
+func (s *Site) loadPages() error {
+	return filepath.Walk(s.Config.Source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
-	case event.Op&fsnotify.Create == fsnotify.Create:
-		// 文件创建
-		if !strings.HasPrefix(filepath.Base(event.Name), ".") {
-			fmt.Printf("[watch] 检测到新文件: %s\n", event.Name)
-			fw.debouncedRebuild()
+		// 跳过排除的目录
+		relPath, _ := filepath.Rel(s.Config.Source, path)
+		if info.IsDir() {
+			if relPath != "." && s.Config.IsExcluded(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-	case event.Op&fsnotify.Remove == fsnotify.Remove:
-		// 文件删除
-		fmt.Printf("[watch] 检测到文件删除: %s\n", event.Name)
-		fw.removeFileHash(event.Name)
-		fw.debouncedRebuild()
+		// 跳过特殊目录、主题目录和排除的文件
+		if strings.HasPrefix(relPath, "_") || strings.HasPrefix(relPath, ".") || s.isThemePath(relPath) || s.Config.IsExcluded(relPath) {
+			return nil
+		}
 
-	case event.Op&fsnotify.Rename == fsnotify.Rename:
-		// 文件重命名
-		fmt.Printf("[watch] 检测到文件重命名: %s\n", event.Name)
-		fw.removeFileHash(event.Name)
-		fw.debouncedRebuild()
-	}
-}
+		// 只处理Markdown文件、带前置数据的HTML文件和 404 页面
+		if !s.Config.IsMarkdownFile(path) && !s.Config.isNotFoundPage(relPath) && !isHTMLPage(path, relPath) {
+			return nil
+		}
 
-// rebuildWorker 重建工作协程
-func (fw *FileWatcher) rebuildWorker() {
-	for range fw.rebuildCh {
-		fmt.Println("[watch] 开始自动重建...")
-		start := time.Now()
+		// 定向重建时复用未变化的页面
+		if p := s.reuse.page(path); p != nil {
+			s.mu.Lock()
+			s.Pages = append(s.Pages, p)
+			s.mu.Unlock()
+			return nil
+		}
 
-		if err := fw.site.Build(); err != nil {
-			fmt.Printf("[watch] 自动重建失败: %v\n", err)
-		} else {
-			duration := time.Since(start)
-			fmt.Printf("[watch] 自动重建完成！耗时: %v\n", duration)
+		// 创建页面对象
+		p, err := NewPage(path, s.Config)
+		if err != nil {
+			log.Printf("警告: 创建页面失败 %s: %v", path, err)
+			return nil // 跳过有问题的文件，继续处理其他文件
 		}
-	}
-}
 
-// Close 关闭文件监听器
-func (fw *FileWatcher) Close() error {
-	if fw.timer != nil {
-		fw.timer.Stop()
+		// 验证Markdown格式
+		if valid, errors := ValidateMarkdown(p.Content); !valid {
+			log.Printf("警告: 页面 %s Markdown格式有问题: %v", filepath.Base(path), errors)
+			// 继续处理，不中断程序
+		}
+
+		s.mu.Lock()
+		s.Pages = append(s.Pages, p)
+		s.mu.Unlock()
+
+		log.Printf("加载页面: %s", relPath)
+		return nil
+	})
+}
+
+// loadPosts 加载文章文件
+func (s *Site) loadPosts() error {
+	postsDir := filepath.Join(s.Config.Source, s.Config.PostsDir)
+	if _, err := os.Stat(postsDir); os.IsNotExist(err) {
+		return nil // 文章目录不存在，跳过
 	}
-	close(fw.rebuildCh)
-	return fw.watcher.Close()
+
+	return filepath.Walk(postsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// 只处理Markdown文件
+		if !s.Config.IsMarkdownFile(path) {
+			return nil
+		}
+
+		// 定向重建时复用未变化的文章（搜索用的简体副本已生成过）
+		if p := s.reuse.post(path); p != nil {
+			s.mu.Lock()
+			s.Posts = append(s.Posts, p)
+			s.mu.Unlock()
+			return nil
+		}
+
+		// 创建文章对象
+		p, err := NewPost(path, s.Config)
+		if err != nil {
+			log.Printf("警告: 创建文章失败 %s: %v", path, err)
+			return nil // 跳过有问题的文件，继续处理其他文件
+		}
+
+		// 验证Markdown格式
+		if valid, errors := ValidateMarkdown(p.Content); !valid {
+			log.Printf("警告: 文章 %s Markdown格式有问题: %v", filepath.Base(path), errors)
+			// 继续处理，不中断程序
+		}
+
+		// 预处理：生成标题的简体副本，用于标签云，显示保持原文；开发模式下跳过以加快启动（标签云构建时会再转换）
+		if !s.memory {
+			p.SearchTitle = toSimplified(p.Title)
+		}
+		if s.Config.simplifyPost(p) {
+			p.Title = toSimplified(p.Title)
+			p.Excerpt = toSimplified(p.Excerpt)
+		}
+
+		s.mu.Lock()
+		s.Posts = append(s.Posts, p)
+		s.mu.Unlock()
+
+		log.Printf("加载文章: %s", filepath.Base(path))
+		return nil
+	})
 }
 
-// ==================== 主程序 ====================
+// siteData 返回模板中 site 变量的内容
+func (s *Site) siteData(archives map[string][]*Post) map[string]interface{} {
+	return map[string]interface{}{
+		"title":         s.Config.Title,
+		"subtitle":      s.Config.Subtitle,
+		"description":   s.Config.Description,
+		"author":        s.Config.Author,
+		"url":           s.Config.URL,
+		"posts":         s.Posts,
+		"pages":         s.Pages,
+		"data":          s.Data,
+		"archives":      archives,
+		"tags":          s.JiebaTags,
+		"JiebaTags":     s.JiebaTags,
+		"lang":          s.Lang,
+		"prefix":        s.LangPrefix,
+		"paginate_path": s.Config.PaginationDir(),
+		"languages":     s.languagesData(),
+	}
+}
 
-func main() {
-	// 解析命令行参数，模仿 Jekyll 的使用方式
-	var (
-		flagServe        = flag.Bool("serve", false, "启动本地服务器")
-		flagWatch        = flag.Bool("watch", false, "监听文件变化自动重建")
-		flagPort         = flag.Int("port", 4000, "服务器端口")
-		flagHost         = flag.String("host", "127.0.0.1", "服务器主机")
-		flagBaseURL      = flag.String("baseurl", "", "站点基础URL")
-		flagConfig       = flag.String("config", "_config.yml", "配置文件路径")
-		flagSource       = flag.String("source", ".", "源目录路径")
-		flagDestination  = flag.String("destination", "_site", "输出目录路径")
-		flagVerbose      = flag.Bool("verbose", false, "详细输出")
-		flagQuiet        = flag.Bool("quiet", false, "静默模式")
-		flagNewPost      = flag.String("new_post", "", "新建文章（标题）")
-		flagNewPage      = flag.String("new_page", "", "新建页面（名称）")
-		flagDoctor       = flag.Bool("doctor", false, "自动修复项目结构和缺失文件")
-		flagTestMarkdown = flag.Bool("test-markdown", false, "测试Markdown格式健壮性")
-		flagHelp         = flag.Bool("help", false, "显示帮助信息")
-		flagVersion      = flag.Bool("version", false, "显示版本信息")
-	)
-	flag.Parse()
+// postBefore 文章排序规则：新的在前，日期相同时按路径排序，保证输出稳定
+func postBefore(a, b *Post) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	return a.Path < b.Path
+}
 
-	// 显示帮助信息
-	if *flagHelp {
-		showHelp()
+// processCollections 处理分页、归档、标签、分类数据
+func (s *Site) processCollections() {
+	// 按日期排序文章
+	sort.Slice(s.Posts, func(i, j int) bool {
+		return postBefore(s.Posts[i], s.Posts[j])
+	})
+
+	// 处理分页
+	s.processPagination()
+
+	// 处理归档
+	s.processArchives()
+}
+
+// processPagination 处理分页
+func (s *Site) processPagination() {
+	if s.Config.Paginate <= 0 {
 		return
 	}
 
-	// 显示版本信息
-	if *flagVersion {
-		showVersion()
-		return
+	s.PagedPosts = make([][]*Post, 0)
+	for i := 0; i < len(s.Posts); i += s.Config.Paginate {
+		end := i + s.Config.Paginate
+		if end > len(s.Posts) {
+			end = len(s.Posts)
+		}
+		s.PagedPosts = append(s.PagedPosts, s.Posts[i:end])
+	}
+}
+
+// processArchives 处理归档
+func (s *Site) processArchives() {
+	s.Archives = make(map[string][]*Post)
+	for _, post := range s.Posts {
+		key := post.Date.Format("2006-01")
+		s.Archives[key] = append(s.Archives[key], post)
+	}
+}
+
+// render 渲染所有内容
+func (s *Site) render() error {
+	// 记录本次依赖的哈希，供判断输出是否需要重新渲染
+	if s.cache != nil {
+		s.cache.addDeps(s.dependencyHashes())
+	}
+
+	// 并发渲染页面和文章（Markdown转换 + 布局），页面在前、文章在后
+	err := runParallel(s.Config.JobCount(), len(s.Pages)+len(s.Posts), func(i int) error {
+		if i < len(s.Pages) {
+			p := s.Pages[i]
+			if err := s.renderPage(p); err != nil {
+				return fmt.Errorf("渲染页面失败 %s: %w", p.Path, err)
+			}
+			return nil
+		}
+
+		p := s.Posts[i-len(s.Pages)]
+		if err := s.renderPost(p); err != nil {
+			return fmt.Errorf("渲染文章失败 %s: %w", p.Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 渲染分页页面
+	if err := s.renderPagination(); err != nil {
+		return fmt.Errorf("渲染分页失败: %w", err)
+	}
+
+	// 渲染归档页面
+	if err := s.renderArchives(); err != nil {
+		return fmt.Errorf("渲染归档失败: %w", err)
+	}
+
+	// 渲染标签页面
+	if err := s.renderTags(); err != nil {
+		return fmt.Errorf("渲染标签失败: %w", err)
+	}
+
+	// 渲染搜索页面
+	if err := s.renderSearch(); err != nil {
+		return fmt.Errorf("渲染搜索页失败: %w", err)
+	}
+
+	return nil
+}
+
+// renderPagination 渲染分页页面
+func (s *Site) renderPagination() error {
+	if len(s.PagedPosts) == 0 {
+		return nil
+	}
+
+	// 渲染布局
+	if _, exists := s.Layouts["index"]; !exists {
+		return fmt.Errorf("布局 index 不存在")
+	}
+
+	// 分页页面路径
+	outputPaths := make([]string, len(s.PagedPosts))
+	for i := range s.PagedPosts {
+		outputPaths[i] = s.routeOutputPath(s.paginationRoute(i))
+	}
+
+	// 增量构建：文章列表和布局都未变化时跳过
+	key := s.collectionDep("pagination")
+	var deps []string
+	if s.cache != nil {
+		deps = s.outputDeps("index", "posts")
+		if s.cache.fresh(key, "", deps) {
+			return nil
+		}
+	}
+
+	err := runParallel(s.Config.JobCount(), len(s.PagedPosts), func(i int) error {
+		content, err := s.renderPaginationPage(i)
+		if err != nil {
+			return err
+		}
+
+		// 写入分页页面
+		if err := s.writeFile(outputPaths[i], []byte(content)); err != nil {
+			return fmt.Errorf("写入分页页面失败: %w", err)
+		}
+
+		log.Printf("写入分页页面: 第 %d 页", i+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.cache.record(key, "", deps, "", outputPaths...)
+	return nil
+}
+
+// renderPaginationPage 渲染第 i 个分页页面（从 0 开始）
+func (s *Site) renderPaginationPage(i int) (string, error) {
+	layout, exists := s.Layouts["index"]
+	if !exists {
+		return "", fmt.Errorf("布局 index 不存在")
+	}
+
+	// 创建分页页面数据
+	alternates := s.listAlternates(s.paginationRoute(i))
+	data := map[string]interface{}{
+		"layout": "index",
+		"title":  s.Config.Title,
+		"posts":  s.PagedPosts[i],
+		"page": map[string]interface{}{
+			"number": i + 1,
+			"total":  len(s.PagedPosts),
+		},
+		"site":       s.siteData(s.Archives),
+		"alternates": alternates,
+	}
+
+	content, err := s.Template.Render(layout, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染分页页面失败: %w", err)
+	}
+	return injectHreflang(content, alternates), nil
+}
+
+// renderArchives 渲染归档页面
+func (s *Site) renderArchives() error {
+	outputPath := s.outputPath("archives", "index.html")
+	key := s.collectionDep("archives")
+	var deps []string
+	if s.cache != nil {
+		deps = s.outputDeps("archive", "posts")
+		if s.cache.fresh(key, "", deps) {
+			return nil
+		}
+	}
+	content, err := s.renderArchivesPage()
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(outputPath, []byte(content)); err != nil {
+		return fmt.Errorf("写入归档页面失败: %w", err)
+	}
+	s.cache.record(key, "", deps, "", outputPath)
+	log.Printf("写入归档页面: %s/archives/", s.LangPrefix)
+	return nil
+}
+
+// renderArchivesPage 渲染归档页面的内容
+func (s *Site) renderArchivesPage() (string, error) {
+	// 如果没有归档，插入友好提示
+	archives := s.Archives
+	if len(archives) == 0 {
+		archives = map[string][]*Post{"": {}}
+	}
+	alternates := s.listAlternates(s.LangPrefix + "/archives/index.html")
+	data := map[string]interface{}{
+		"layout":     "archive",
+		"title":      "归档",
+		"archives":   archives,
+		"site":       s.siteData(archives),
+		"alternates": alternates,
+	}
+	layout, exists := s.Layouts["archive"]
+	if !exists {
+		return "", fmt.Errorf("布局 archive 不存在")
+	}
+	content, err := s.Template.Render(layout, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染归档页面失败: %w", err)
+	}
+	return injectHreflang(content, alternates), nil
+}
+
+// renderTags 渲染标签页面，列出每个智能分类标签下的文章
+func (s *Site) renderTags() error {
+	if _, exists := s.Layouts["tag"]; !exists {
+		return nil // 没有标签布局，跳过
+	}
+	outputPath := s.outputPath("tags", "index.html")
+	key := s.collectionDep("tags")
+	var deps []string
+	if s.cache != nil {
+		deps = s.outputDeps("tag", "posts")
+		if s.cache.fresh(key, "", deps) {
+			return nil
+		}
+	}
+
+	content, err := s.renderTagsPage()
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(outputPath, []byte(content)); err != nil {
+		return fmt.Errorf("写入标签页面失败: %w", err)
+	}
+	s.cache.record(key, "", deps, "", outputPath)
+	log.Printf("写入标签页面: %s/tags/", s.LangPrefix)
+	return nil
+}
+
+// renderTagsPage 渲染标签页面的内容
+func (s *Site) renderTagsPage() (string, error) {
+	layout, exists := s.Layouts["tag"]
+	if !exists {
+		return "", fmt.Errorf("布局 tag 不存在")
+	}
+
+	// 标签来自简体标题（镜像站点转换过字形），统一按简体匹配，显示的标题保持原文
+	titles := make([]string, len(s.Posts))
+	for i, post := range s.Posts {
+		titles[i] = post.normalizedTitle()
+	}
+	tags := make(map[string][]*Post)
+	for _, tag := range s.JiebaTags {
+		word := toSimplified(tag)
+		for i, post := range s.Posts {
+			if strings.Contains(titles[i], word) {
+				tags[tag] = append(tags[tag], post)
+			}
+		}
+	}
+
+	alternates := s.listAlternates(s.LangPrefix + "/tags/index.html")
+	data := map[string]interface{}{
+		"layout":     "tag",
+		"title":      "标签",
+		"tags":       tags,
+		"site":       s.siteData(s.Archives),
+		"alternates": alternates,
+	}
+
+	content, err := s.Template.Render(layout, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染标签页面失败: %w", err)
+	}
+	return injectHreflang(content, alternates), nil
+}
+
+// hasSearchPage 判断是否需要生成搜索页面：有 search 布局且站点没有自己的搜索页面
+func (s *Site) hasSearchPage() bool {
+	searchURL := strings.TrimPrefix(s.LangPrefix+"/search.html", "/")
+	for _, p := range s.Pages {
+		if p.URL == searchURL {
+			return false
+		}
+	}
+	_, exists := s.Layouts["search"]
+	return exists
+}
+
+// renderSearch 渲染搜索页面；站点已有 search 页面时跳过
+func (s *Site) renderSearch() error {
+	if !s.hasSearchPage() {
+		return nil
+	}
+	outputPath := s.outputPath("search.html")
+	key := s.collectionDep("search")
+	var deps []string
+	if s.cache != nil {
+		deps = s.outputDeps("search", "pages")
+		if s.cache.fresh(key, "", deps) {
+			return nil
+		}
+	}
+
+	content, err := s.renderSearchPage()
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(outputPath, []byte(content)); err != nil {
+		return fmt.Errorf("写入搜索页面失败: %w", err)
+	}
+	s.cache.record(key, "", deps, "", outputPath)
+	log.Printf("写入搜索页面: %s/search.html", s.LangPrefix)
+	return nil
+}
+
+// renderSearchPage 渲染搜索页面的内容
+func (s *Site) renderSearchPage() (string, error) {
+	layout, exists := s.Layouts["search"]
+	if !exists {
+		return "", fmt.Errorf("布局 search 不存在")
+	}
+
+	alternates := s.listAlternates(s.LangPrefix + "/search.html")
+	data := map[string]interface{}{
+		"layout":     "search",
+		"title":      "搜索",
+		"site":       s.siteData(s.Archives),
+		"alternates": alternates,
+	}
+
+	content, err := s.Template.Render(layout, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染搜索页面失败: %w", err)
+	}
+	return injectHreflang(content, alternates), nil
+}
+
+// write 写入输出目录
+func (s *Site) write() error {
+	// 创建输出目录
+	if err := os.MkdirAll(s.Config.Destination, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	// 并发写入页面和文章
+	return runParallel(s.Config.JobCount(), len(s.Pages)+len(s.Posts), func(i int) error {
+		if i < len(s.Pages) {
+			p := s.Pages[i]
+			if err := s.writePage(p); err != nil {
+				return fmt.Errorf("写入页面失败 %s: %w", p.Path, err)
+			}
+			return nil
+		}
+
+		p := s.Posts[i-len(s.Pages)]
+		if err := s.writePost(p); err != nil {
+			return fmt.Errorf("写入文章失败 %s: %w", p.Path, err)
+		}
+		return nil
+	})
+}
+
+// writePage 写入单个页面
+func (s *Site) writePage(p *Page) error {
+	// 增量构建中跳过渲染的页面输出已是最新
+	if s.cache.isUnchanged(s.outputKey("page", p.Path)) {
+		return nil
+	}
+
+	// 写入文件
+	outputPath := s.pageOutputPath(p)
+	if err := s.writeFile(outputPath, []byte(p.RenderedContent)); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	log.Printf("写入页面: %s", outputPath)
+	return nil
+}
+
+// pageOutputPath 返回页面的输出路径（URL 已去除语言后缀并包含语言前缀）
+func (s *Site) pageOutputPath(p *Page) string {
+	return filepath.Join(s.Config.Destination, filepath.FromSlash(p.URL))
+}
+
+// postOutputPaths 返回文章的输出路径和归档副本路径 /archives/年/月/日/slug.html
+func (s *Site) postOutputPaths(p *Post) (outputPath, archivePath string) {
+	route, archive := s.postRoutes(p)
+	return s.routeOutputPath(route), s.routeOutputPath(archive)
+}
+
+// writePost 写入单个文章
+func (s *Site) writePost(p *Post) error {
+	// 增量构建中跳过渲染的文章输出已是最新
+	if s.cache.isUnchanged(s.outputKey("post", p.Path)) {
+		return nil
+	}
+
+	outputPath, archivePath := s.postOutputPaths(p)
+
+	// 1. 原有路径
+	if err := s.writeFile(outputPath, []byte(p.RenderedContent)); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	log.Printf("写入文章: %s", outputPath)
+
+	// 2. 归档路径副本
+	if err := s.writeFile(archivePath, []byte(p.RenderedContent)); err != nil {
+		return fmt.Errorf("写入归档副本失败: %w", err)
+	}
+	log.Printf("写入归档副本: %s", archivePath)
+
+	// 已移除分类和标签路径副本，使用jieba分词作为智能分类
+
+	return nil
+}
+
+// copyStaticFiles 复制静态文件（站点、主题和内置主题的静态资源，站点优先）
+func (s *Site) copyStaticFiles() error {
+	for _, dir := range staticDirs {
+		files, err := s.walkLayered(dir)
+		if err != nil {
+			return fmt.Errorf("复制 %s 失败: %w", dir, err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		for _, f := range files {
+			dest := filepath.Join(s.Config.Destination, filepath.FromSlash(f.Name))
+			if err := s.copyLayerFile(f, dest); err != nil {
+				return fmt.Errorf("复制 %s 失败: %w", f.Layer.displayPath(f.Name), err)
+			}
+		}
+		log.Printf("复制 %s 目录", dir)
+	}
+
+	return nil
+}
+
+// copyLayerFile 从文件层复制单个文件
+func (s *Site) copyLayerFile(f layeredFile, dest string) error {
+	data, err := fs.ReadFile(f.Layer.FS, f.Name)
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(dest, data)
+}
+
+// copyDirectory 复制目录
+func (s *Site) copyDirectory(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// 计算相对路径
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(dest, relPath)
+
+		if info.IsDir() {
+			// 创建目录
+			return os.MkdirAll(destPath, 0755)
+		} else {
+			// 复制文件
+			return s.copyFile(path, destPath)
+		}
+	})
+}
+
+// copyFile 复制文件
+func (s *Site) copyFile(src, dest string) error {
+	// 创建目标目录
+	destDir := filepath.Dir(dest)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	// 读取源文件
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	// 写入目标文件
+	return os.WriteFile(dest, data, 0644)
+}
+
+// Watch 构建站点并监听文件变化自动重建，直到监听器关闭
+func (s *Site) Watch() error {
+	s.watching = true
+	if err := s.Build(); err != nil {
+		log.Printf("构建站点失败，修复后将自动重建: %v", err)
+	}
+
+	fw, err := NewFileWatcher(s, s.Config)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	return fw.Start()
+}
+
+// shutdownTimeout 优雅关闭时等待进行中请求的最长时间
+const shutdownTimeout = 10 * time.Second
+
+// Serve 启动本地服务器；watch 为 true 时监听文件变化自动重建，并在浏览器中实时刷新。
+// memory 为 true 时使用开发模式：站点只加载到内存，页面在首次请求时渲染，不写入输出目录
+func (s *Site) Serve(host string, port int, watch, memory bool) error {
+	s.watching = watch
+	s.memory = memory
+	start := time.Now()
+	if err := s.Build(); err != nil {
+		return fmt.Errorf("构建站点失败: %w", err)
+	}
+	if memory {
+		log.Printf("开发模式: 站点已加载到内存，耗时 %v，页面将在首次请求时渲染", time.Since(start))
+	}
+
+	// 监听文件变化，重建结果通过 SSE 推送给页面
+	var (
+		fw  *FileWatcher
+		lr  *LiveReload
+		err error
+	)
+	if watch {
+		fw, err = NewFileWatcher(s, s.Config)
+		if err != nil {
+			return err
+		}
+
+		lr = NewLiveReload()
+		fw.OnRebuild = lr.Notify
+
+		go func() {
+			if err := fw.Start(); err != nil {
+				log.Printf("文件监听失败: %v", err)
+			}
+		}()
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      s.newRouter(lr),
+		ReadTimeout:  s.Config.ReadTimeout,
+		WriteTimeout: s.Config.WriteTimeout,
+		IdleTimeout:  s.Config.IdleTimeout,
+	}
+	if lr != nil {
+		srv.RegisterOnShutdown(lr.Close)
+	}
+
+	scheme := "http"
+	cert, key := s.Config.TLSFiles()
+	if cert != "" {
+		scheme = "https"
+	}
+	log.Printf("启动服务器: %s://%s", scheme, addr)
+	if memory {
+		log.Println("服务内容: 内存（不写入输出目录）")
+	} else {
+		log.Printf("服务目录: %s", s.Config.Destination)
+	}
+	if s.Config.BasicAuth != nil {
+		log.Println("已启用基本认证")
+	}
+	log.Println("按 Ctrl+C 停止服务器")
+
+	// 收到 SIGINT 或 SIGTERM 时停止接受新连接，等待进行中的请求完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		if cert != "" {
+			errCh <- srv.ListenAndServeTLS(cert, key)
+		} else {
+			errCh <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err = <-errCh:
+		// 监听失败（如端口被占用）
+	case <-ctx.Done():
+		log.Println("正在关闭服务器...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err = srv.Shutdown(shutdownCtx); err != nil {
+			err = fmt.Errorf("关闭服务器失败: %w", err)
+		}
+	}
+	if fw != nil {
+		fw.Close()
+	}
+	analyzer.Close()
+	if err == nil {
+		log.Println("服务器已关闭")
+	}
+	return err
+}
+
+// /api/search 每页结果数的默认值和上限，以及片段长度的上限
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+	searchMaxSnippet   = 1000
+)
+
+// queryInt 读取整数查询参数，参数不存在时返回默认值
+func queryInt(c *gin.Context, key string, def int) (int, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// newRouter 创建服务器路由；lr 不为 nil 时提供实时刷新端点，并向 HTML 响应注入客户端脚本
+func (s *Site) newRouter(lr *LiveReload) *gin.Engine {
+	// 使用 Gin 框架
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	// 预览部署：所有请求（包括 API 和实时刷新）都需要认证
+	if auth := s.Config.BasicAuth; auth != nil {
+		r.Use(gin.BasicAuth(gin.Accounts{auth.Username: auth.Password}))
+	}
+
+	if lr != nil {
+		r.GET(liveReloadPath, lr.Handler)
+	}
+
+	// send 返回内容并设置 Content-Type、ETag、Last-Modified 和 Cache-Control，
+	// 条件请求、HEAD 和 Range 请求由 http.ServeContent 处理；开发时向 HTML 注入实时刷新脚本
+	// 文本内容按 Accept-Encoding 压缩，sibling 不为 nil 时优先使用预压缩的 .br/.gz 副本
+	send := func(c *gin.Context, site *Site, name string, modTime time.Time, data []byte, sibling func(ext string) ([]byte, bool)) {
+		isHTML := strings.HasSuffix(name, ".html")
+		if isHTML && lr != nil {
+			data = injectLiveReload(data)
+			sibling = nil // 预压缩副本不含实时刷新脚本
+		}
+		h := c.Writer.Header()
+		if typ := contentType(name); typ != "" {
+			h.Set("Content-Type", typ)
+		}
+		if compressible(name) {
+			h.Add("Vary", "Accept-Encoding")
+			if enc, body := site.encodeResponse(c.GetHeader("Accept-Encoding"), data, sibling); enc != "" {
+				h.Set("Content-Encoding", enc)
+				data = body
+			}
+		}
+		h.Set("ETag", contentETag(data))
+		if cc := site.Config.CacheControlFor(c.Request.URL.Path); cc != "" {
+			h.Set("Cache-Control", cc)
+		} else if isHTML && lr != nil {
+			h.Set("Cache-Control", "no-cache")
+		}
+		http.ServeContent(c.Writer, c.Request, name, modTime, bytes.NewReader(data))
+	}
+
+	// sendPage 返回带状态码的 HTML 页面，如 404 页面和渲染错误，不允许缓存
+	sendPage := func(c *gin.Context, status int, data []byte) {
+		if lr != nil {
+			data = injectLiveReload(data)
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Data(status, "text/html; charset=utf-8", data)
+	}
+
+	// notFound 返回请求所在语言的 404 页面，站点没有 404 页面时返回纯文本
+	notFound := func(c *gin.Context, site *Site) {
+		if data, ok := site.notFoundPage(c.Request.URL.Path); ok {
+			sendPage(c, http.StatusNotFound, data)
+			return
+		}
+		c.String(http.StatusNotFound, "404 - 页面未找到")
+	}
+
+	// API 只对 cors_origins 中的来源开放跨域访问，预检请求直接返回 204
+	api := r.Group("/api", func(c *gin.Context) {
+		site := s.Snapshot()
+		if len(site.Config.CORSOrigins) > 0 {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if origin := site.Config.AllowOrigin(c.GetHeader("Origin")); origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Content-Type")
+		}
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+		}
+	})
+	api.OPTIONS("/*path", func(c *gin.Context) {})
+
+	// 搜索API：与静态索引使用同一个倒排索引和排序规则
+	api.GET("/search", func(c *gin.Context) {
+		query := c.Query("q")
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "查询参数不能为空"})
+			return
+		}
+
+		limit, err := queryInt(c, "limit", searchDefaultLimit)
+		if err != nil || limit < 1 || limit > searchMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit 必须是 1 到 %d 之间的整数", searchMaxLimit)})
+			return
+		}
+		offset, err := queryInt(c, "offset", 0)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset 必须是非负整数"})
+			return
+		}
+
+		opts := searchOptions{Sort: c.DefaultQuery("sort", "relevance"), Collection: c.Query("collection")}
+		if opts.Sort != "relevance" && opts.Sort != "date" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort 只能是 relevance 或 date"})
+			return
+		}
+
+		// 读取当前快照，重建期间继续使用上一次构建的结果
+		site := s.Snapshot()
+		snippetLength, err := queryInt(c, "snippet_length", site.Config.SearchSnippetLength)
+		if err != nil || snippetLength < 1 || snippetLength > searchMaxSnippet {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("snippet_length 必须是 1 到 %d 之间的整数", searchMaxSnippet)})
+			return
+		}
+
+		hits, err := site.searchIndex().search(query, opts)
+		var qerr *queryError
+		if errors.As(err, &qerr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": qerr.Error(), "position": qerr.Pos})
+			return
+		}
+		// 先把 offset 限制在结果数以内再加 limit，避免很大的 offset 相加溢出
+		total := len(hits)
+		lo := min(offset, total)
+		hits = hits[lo : lo+min(limit, total-lo)]
+
+		response := make([]gin.H, 0, len(hits))
+		for _, hit := range hits {
+			response = append(response, gin.H{
+				"id":         hit.Doc.ID,
+				"title":      hit.Doc.Title,
+				"url":        hit.Doc.URL,
+				"date":       hit.Doc.Date,
+				"tags":       hit.Doc.Tags,
+				"type":       hit.Doc.Type,
+				"excerpt":    hit.Doc.excerpt,
+				"score":      hit.Score,
+				"title_html": hit.highlightTitle(),
+				"snippet":    hit.snippet(snippetLength),
+			})
+		}
+
+		body := gin.H{
+			"query":   query,
+			"results": response,
+			"count":   len(response),
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		}
+		if total == 0 {
+			body["did_you_mean"] = site.searchIndex().didYouMean(query)
+		}
+		c.JSON(http.StatusOK, body)
+	})
+
+	api.GET("/search/suggest", func(c *gin.Context) {
+		query := c.Query("q")
+		limit, err := queryInt(c, "limit", searchSuggestLimit)
+		if err != nil || limit < 1 || limit > searchMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit 必须是 1 到 %d 之间的整数", searchMaxLimit)})
+			return
+		}
+
+		suggestions := make([]gin.H, 0, limit)
+		for _, sg := range s.Snapshot().searchIndex().suggest(query, limit) {
+			suggestions = append(suggestions, gin.H{"text": sg.Text, "type": sg.Type, "count": sg.Count})
+		}
+		c.JSON(http.StatusOK, gin.H{"query": query, "suggestions": suggestions})
+	})
+
+	// 兜底路由处理：页面、文章、Feed 和静态文件
+	r.NoRoute(func(c *gin.Context) {
+		site := s.Snapshot()
+		reqPath := path.Clean("/" + c.Request.URL.Path)
+		if strings.HasSuffix(c.Request.URL.Path, "/") && reqPath != "/" {
+			reqPath += "/"
+		}
+
+		// 开发模式：按路由树查找输出，首次请求时渲染；静态文件直接从文件层读取
+		if site.memory {
+			if target, route := site.lookupRoute(reqPath); route != nil {
+				content, err := route.get()
+				if err != nil {
+					log.Printf("渲染 %s 失败: %v", target, err)
+					sendPage(c, http.StatusInternalServerError, renderErrorPage(target, err))
+					return
+				}
+				send(c, site, target, site.loadedAt, content, nil)
+				return
+			}
+			if data, modTime, ok := site.staticFile(reqPath); ok {
+				send(c, site, reqPath, modTime, data, nil)
+				return
+			}
+			notFound(c, site)
+			return
+		}
+
+		// 从输出目录提供文件
+		if filePath, ok := site.outputFile(reqPath); ok {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				notFound(c, site)
+				return
+			}
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "读取文件失败")
+				return
+			}
+			send(c, site, filePath, info.ModTime(), data, func(ext string) ([]byte, bool) {
+				return siblingFile(filePath+ext, info.ModTime())
+			})
+			return
+		}
+
+		notFound(c, site)
+	})
+
+	return r
+}
+
+// ensureProjectStructure 自动初始化项目结构和核心文件
+func ensureProjectStructure() (fixed bool, report []string) {
+	// 只检查目录，不再自动写入嵌入式样式和布局
+	dirs := []string{"_layouts", "_posts", "_data", "_includes", "stylesheets"}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			os.Mkdir(dir, 0755)
+			report = append(report, "已创建目录: "+dir)
+			fixed = true
+		}
+	}
+	return fixed, report
+}
+
+// doctorCheck 检查项目结构和文件格式
+func doctorCheck(cfg *Config) (fixed bool, report []string) {
+	report = append(report, "=== 开始检查项目结构 ===")
+
+	// 1. 检查必要目录（主题或内置主题提供的目录无需在站点中创建）
+	themeDir := cfg.ThemeDir()
+	dirs := []string{"_layouts", "_posts", "_data", "_includes", "stylesheets"}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if dir != "_posts" {
+				if info, err := os.Stat(filepath.Join(themeDir, dir)); themeDir != "" && err == nil && info.IsDir() {
+					report = append(report, "✓ 目录由主题提供: "+dir)
+				} else {
+					report = append(report, "✓ 使用内置主题: "+dir)
+				}
+				continue
+			}
+			os.Mkdir(dir, 0755)
+			report = append(report, "✓ 已创建目录: "+dir)
+			fixed = true
+		} else {
+			report = append(report, "✓ 目录存在: "+dir)
+		}
+	}
+
+	// 2. 检查布局文件
+	report = append(report, "\n=== 检查布局文件 ===")
+	layoutsDir := filepath.Join(cfg.Source, cfg.LayoutsDir)
+	if themeDir != "" {
+		if _, err := os.Stat(layoutsDir); os.IsNotExist(err) {
+			layoutsDir = filepath.Join(themeDir, cfg.LayoutsDir)
+		}
+	}
+	if _, err := os.Stat(layoutsDir); os.IsNotExist(err) {
+		report = append(report, "✓ 使用内置主题布局")
+	} else if err := checkLayouts(layoutsDir, &report); err != nil {
+		report = append(report, "✗ 布局检查失败: "+err.Error())
+	} else {
+		report = append(report, "✓ 布局文件检查完成")
+	}
+
+	// 3. 检查 Markdown 文件
+	report = append(report, "\n=== 检查 Markdown 文件 ===")
+	if err := checkMarkdownFiles(cfg, &report); err != nil {
+		report = append(report, "✗ Markdown 检查失败: "+err.Error())
+	} else {
+		report = append(report, "✓ Markdown 文件检查完成")
+	}
+
+	// 4. 检查样式文件
+	report = append(report, "\n=== 检查样式文件 ===")
+	if err := checkStylesheets(cfg, &report); err != nil {
+		report = append(report, "✗ 样式文件检查失败: "+err.Error())
+	} else {
+		report = append(report, "✓ 样式文件检查完成")
+	}
+
+	// 5. 检查配置文件
+	report = append(report, "\n=== 检查配置文件 ===")
+	if err := checkConfigFile(cfg, &report); err != nil {
+		report = append(report, "✗ 配置文件检查失败: "+err.Error())
+	} else {
+		report = append(report, "✓ 配置文件检查完成")
+	}
+
+	report = append(report, "\n=== 检查完成 ===")
+	return fixed, report
+}
+
+// checkLayouts 检查布局文件
+func checkLayouts(layoutsDir string, report *[]string) error {
+	if _, err := os.Stat(layoutsDir); os.IsNotExist(err) {
+		*report = append(*report, "✗ 布局目录不存在: "+layoutsDir)
+		return fmt.Errorf("布局目录不存在")
+	}
+
+	layouts := []string{"default.html", "post.html", "index.html", "archive.html", "tag.html", "category.html"}
+	foundLayouts := 0
+
+	for _, layout := range layouts {
+		layoutPath := filepath.Join(layoutsDir, layout)
+		if _, err := os.Stat(layoutPath); err == nil {
+			*report = append(*report, "✓ 布局文件存在: "+layout)
+			foundLayouts++
+
+			// 检查布局文件内容
+			if err := checkLayoutContent(layoutPath, report); err != nil {
+				*report = append(*report, "  ⚠ 布局内容有问题: "+err.Error())
+			}
+		} else {
+			*report = append(*report, "✗ 缺少布局文件: "+layout)
+		}
+	}
+
+	if foundLayouts == 0 {
+		*report = append(*report, "⚠ 警告: 没有找到任何布局文件")
+	}
+
+	return nil
+}
+
+// checkLayoutContent 检查布局文件内容
+func checkLayoutContent(layoutPath string, report *[]string) error {
+	content, err := os.ReadFile(layoutPath)
+	if err != nil {
+		return err
+	}
+
+	contentStr := string(content)
+
+	// 检查基本结构
+	if !strings.Contains(contentStr, "<!DOCTYPE html>") {
+		*report = append(*report, "    ⚠ 缺少 DOCTYPE 声明")
+	}
+
+	if !strings.Contains(contentStr, "<html") {
+		*report = append(*report, "    ⚠ 缺少 <html> 标签")
+	}
+
+	if !strings.Contains(contentStr, "<head>") {
+		*report = append(*report, "    ⚠ 缺少 <head> 标签")
+	}
+
+	if !strings.Contains(contentStr, "<body>") {
+		*report = append(*report, "    ⚠ 缺少 <body> 标签")
+	}
+
+	// 检查模板变量
+	if !strings.Contains(contentStr, "{{") {
+		*report = append(*report, "    ⚠ 没有找到模板变量")
+	}
+
+	// 检查内容占位符
+	if !strings.Contains(contentStr, "{{.content}}") && !strings.Contains(contentStr, "{{ content }}") {
+		*report = append(*report, "    ⚠ 没有找到内容占位符 {{.content}}")
+	}
+
+	return nil
+}
+
+// checkMarkdownFiles 检查 Markdown 文件
+func checkMarkdownFiles(cfg *Config, report *[]string) error {
+	// 检查页面文件
+	if err := checkMarkdownInDir(cfg.Source, cfg, report, "页面"); err != nil {
+		return err
+	}
+
+	// 检查文章文件
+	postsDir := filepath.Join(cfg.Source, cfg.PostsDir)
+	if _, err := os.Stat(postsDir); err == nil {
+		if err := checkMarkdownInDir(postsDir, cfg, report, "文章"); err != nil {
+			return err
+		}
+	} else {
+		*report = append(*report, "⚠ 文章目录不存在: "+postsDir)
+	}
+
+	return nil
+}
+
+// checkMarkdownInDir 检查目录中的 Markdown 文件
+func checkMarkdownInDir(dir string, cfg *Config, report *[]string, fileType string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// 跳过特殊目录
+			relPath, _ := filepath.Rel(dir, path)
+			if strings.HasPrefix(relPath, "_") || strings.HasPrefix(relPath, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 只检查 Markdown 文件
+		if !cfg.IsMarkdownFile(path) {
+			return nil
+		}
+
+		// 检查文件内容
+		if err := checkMarkdownContent(path, report, fileType); err != nil {
+			*report = append(*report, "✗ "+fileType+"文件检查失败 "+filepath.Base(path)+": "+err.Error())
+		} else {
+			*report = append(*report, "✓ "+fileType+"文件正常: "+filepath.Base(path))
+		}
+
+		return nil
+	})
+}
+
+// checkMarkdownContent 检查 Markdown 文件内容
+func checkMarkdownContent(filePath string, report *[]string, fileType string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	contentStr := string(content)
+
+	// 检查前置数据
+	if !strings.Contains(contentStr, "---") {
+		*report = append(*report, "    ⚠ 缺少前置数据分隔符 ---")
+		return fmt.Errorf("缺少前置数据")
+	}
+
+	// 解析前置数据
+	fm, _, err := Parse(contentStr)
+	if err != nil {
+		return fmt.Errorf("前置数据解析失败: %w", err)
+	}
+
+	// 检查必要字段
+	if title, ok := fm["title"].(string); ok && title != "" {
+		*report = append(*report, "    ✓ 标题: "+title)
+	} else {
+		*report = append(*report, "    ⚠ 缺少标题")
+	}
+
+	if layout, ok := fm["layout"].(string); ok && layout != "" {
+		*report = append(*report, "    ✓ 布局: "+layout)
+	} else {
+		*report = append(*report, "    ⚠ 缺少布局设置")
+	}
+
+	// 检查文章特有字段
+	if fileType == "文章" {
+		if date, ok := fm["date"].(time.Time); ok && !date.IsZero() {
+			*report = append(*report, "    ✓ 日期: "+date.Format("2006-01-02"))
+		} else if dateStr, ok := fm["date"].(string); ok && dateStr != "" {
+			*report = append(*report, "    ✓ 日期: "+dateStr)
+		} else {
+			*report = append(*report, "    ⚠ 缺少日期")
+		}
+
+		// 检查文件名格式（仅对文章）
+		filename := filepath.Base(filePath)
+		if !filenameRegex.MatchString(filename) {
+			*report = append(*report, "    ⚠ 文件名格式不正确，应为: YYYY-MM-DD-title.md")
+		}
+	}
+
+	return nil
+}
+
+// checkStylesheets 检查样式文件
+func checkStylesheets(cfg *Config, report *[]string) error {
+	stylesheetsDir := filepath.Join(cfg.Source, "stylesheets")
+	if themeDir := cfg.ThemeDir(); themeDir != "" {
+		if _, err := os.Stat(stylesheetsDir); os.IsNotExist(err) {
+			stylesheetsDir = filepath.Join(themeDir, "stylesheets")
+		}
+	}
+	if _, err := os.Stat(stylesheetsDir); os.IsNotExist(err) {
+		*report = append(*report, "✓ 使用内置主题样式")
+		return nil
+	}
+
+	// 检查主要样式文件
+	mainStyles := []string{"site.css", "site.scss"}
+	foundStyles := 0
+
+	for _, style := range mainStyles {
+		stylePath := filepath.Join(stylesheetsDir, style)
+		if _, err := os.Stat(stylePath); err == nil {
+			*report = append(*report, "✓ 样式文件存在: "+style)
+			foundStyles++
+		} else {
+			*report = append(*report, "✗ 缺少样式文件: "+style)
+		}
+	}
+
+	if foundStyles == 0 {
+		*report = append(*report, "⚠ 警告: 没有找到任何样式文件")
+	}
+
+	return nil
+}
+
+// checkConfigFile 检查配置文件
+func checkConfigFile(cfg *Config, report *[]string) error {
+	configExtensions := []string{".yml", ".yaml", ".toml"}
+	configFound := false
+
+	for _, ext := range configExtensions {
+		configPath := filepath.Join(cfg.Source, "_config"+ext)
+		if _, err := os.Stat(configPath); err == nil {
+			*report = append(*report, "✓ 配置文件存在: _config"+ext)
+			configFound = true
+
+			// 检查配置文件内容
+			if err := checkConfigContent(configPath, report); err != nil {
+				*report = append(*report, "  ⚠ 配置文件内容有问题: "+err.Error())
+			}
+			break
+		}
+	}
+
+	if !configFound {
+		*report = append(*report, "⚠ 没有找到配置文件，将使用默认配置")
+	}
+
+	return nil
+}
+
+// checkConfigContent 检查配置文件内容
+func checkConfigContent(configPath string, report *[]string) error {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	contentStr := string(content)
+
+	// 检查基本配置项
+	requiredFields := []string{"title", "description", "author", "url"}
+	for _, field := range requiredFields {
+		if !strings.Contains(contentStr, field+":") {
+			*report = append(*report, "    ⚠ 缺少配置项: "+field)
+		} else {
+			*report = append(*report, "    ✓ 配置项存在: "+field)
+		}
+	}
+
+	return nil
+}
+
+func createNewPost(title string, cfg *Config) error {
+	// 生成文件名
+	dir := "_posts"
+	if cfg.PostsDir != "" {
+		dir = cfg.PostsDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	date := time.Now()
+	slug := strings.ToLower(strings.ReplaceAll(title, " ", "-"))
+	filename := filepath.Join(dir, date.Format("2006-01-02")+"-"+slug+".md")
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("文件已存在: %s", filename)
+	}
+
+	frontMatter := "---\n" +
+		"layout: post\n" +
+		"title: \"" + title + "\"\n" +
+		"date: " + date.Format("2006-01-02 15:04:05 -0700") + "\n" +
+		"categories: []\n" +
+		"tags: []\n" +
+		"comments: true\n" +
+		"---\n\n这里是正文内容。\n"
+
+	return os.WriteFile(filename, []byte(frontMatter), 0644)
+}
+
+func createNewPage(name string, cfg *Config) error {
+	// 生成文件名
+
+	dir := name
+	if strings.ContainsAny(name, "/\\") {
+		dir = filepath.Dir(name)
+		name = filepath.Base(name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, "index.md")
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("文件已存在: %s", filename)
+	}
+	date := time.Now()
+	frontMatter := "---\n" +
+		"layout: page\n" +
+		"title: \"" + name + "\"\n" +
+		"date: " + date.Format("2006-01-02 15:04:05 -0700") + "\n" +
+		"comments: true\n" +
+		"sharing: true\n" +
+		"footer: true\n" +
+		"---\n\n这里是页面内容。\n"
+	return os.WriteFile(filename, []byte(frontMatter), 0644)
+}
+
+// ==================== 文件监听器 ====================
+
+// FileWatcher 增强的文件监听器，支持SHA256哈希值比较
+type FileWatcher struct {
+	watcher    *fsnotify.Watcher
+	site       *Site
+	config     *Config
+	fileHashes map[string]string // 文件路径 -> SHA256哈希值
+	mu         sync.RWMutex
+	debounce   time.Duration
+	timer      *time.Timer // 防抖定时器，由 mu 保护
+	rebuildCh  chan struct{}
+	pending    map[string]bool // 上次重建以来变化的文件
+	running    bool            // 事件循环是否已启动
+	closed     bool            // 已关闭，定时器回调不再发送重建信号
+	loopDone   chan struct{}   // 事件循环退出时关闭
+
+	// OnRebuild 每次重建完成后调用，changed 为触发重建的文件，err 为构建错误
+	OnRebuild func(changed []string, err error)
+}
+
+// NewFileWatcher 创建新的文件监听器
+func NewFileWatcher(site *Site, cfg *Config) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建文件监听器失败: %w", err)
+	}
+
+	fw := &FileWatcher{
+		watcher:    watcher,
+		site:       site,
+		config:     cfg,
+		fileHashes: make(map[string]string),
+		debounce:   500 * time.Millisecond, // 500ms防抖
+		rebuildCh:  make(chan struct{}, 1),
+		pending:    make(map[string]bool),
+		loopDone:   make(chan struct{}),
+	}
+
+	// 初始化文件哈希值
+	if err := fw.initializeFileHashes(); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("初始化文件哈希值失败: %w", err)
+	}
+
+	return fw, nil
+}
+
+// initializeFileHashes 递归监听源目录（以及源目录外的主题目录）并记录所有文件的哈希值
+func (fw *FileWatcher) initializeFileHashes() error {
+	for _, root := range fw.watchRoots() {
+		if err := fw.watchTree(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentConfig 返回当前配置；配置文件修改后会被重建协程替换
+func (fw *FileWatcher) currentConfig() *Config {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.config
+}
+
+// watchRoots 返回需要监听的根目录
+func (fw *FileWatcher) watchRoots() []string {
+	cfg := fw.currentConfig()
+	roots := []string{cfg.Source}
+	if theme := cfg.ThemeDir(); theme != "" && !isWithin(theme, cfg.Source) {
+		roots = append(roots, theme)
+	}
+	return roots
+}
+
+// watchTree 为目录及其所有子目录添加监听，并计算其中文件的哈希值
+func (fw *FileWatcher) watchTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // 遍历期间被删除
+			}
+			return err
+		}
+
+		if path != root && fw.ignored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if err := fw.watcher.Add(path); err != nil {
+				return fmt.Errorf("添加监听目录失败 %s: %w", path, err)
+			}
+			return nil
+		}
+
+		hash, err := fw.calculateFileHash(path)
+		if err != nil {
+			return fmt.Errorf("计算文件哈希值失败 %s: %w", path, err)
+		}
+
+		fw.mu.Lock()
+		fw.fileHashes[path] = hash
+		fw.mu.Unlock()
+
+		return nil
+	})
+}
+
+// ignored 判断路径是否不需要监听：隐藏文件、输出目录、缓存目录和 exclude 排除的路径
+func (fw *FileWatcher) ignored(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
+	cfg := fw.currentConfig()
+	if isWithin(path, cfg.Destination) || isWithin(path, cfg.CachePath()) {
+		return true
+	}
+	if rel, err := filepath.Rel(cfg.Source, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return cfg.IsExcluded(rel)
+	}
+	return false
+}
+
+// isWithin 判断 path 是否是 dir 本身或位于 dir 之下
+func isWithin(path, dir string) bool {
+	absPath, err1 := filepath.Abs(path)
+	absDir, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// calculateFileHash 计算单个文件的SHA256哈希值
+func (fw *FileWatcher) calculateFileHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hasFileChanged 检查文件是否发生变化
+func (fw *FileWatcher) hasFileChanged(filePath string) (bool, error) {
+	newHash, err := fw.calculateFileHash(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	fw.mu.RLock()
+	oldHash, exists := fw.fileHashes[filePath]
+	fw.mu.RUnlock()
+
+	if !exists {
+		// 新文件
+		fw.mu.Lock()
+		fw.fileHashes[filePath] = newHash
+		fw.mu.Unlock()
+		return true, nil
+	}
+
+	if oldHash != newHash {
+		// 文件内容发生变化
+		fw.mu.Lock()
+		fw.fileHashes[filePath] = newHash
+		fw.mu.Unlock()
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// removeFileHash 移除文件的哈希值记录（文件被删除时）；删除目录时一并移除其下文件的记录
+func (fw *FileWatcher) removeFileHash(filePath string) {
+	prefix := filePath + string(filepath.Separator)
+	fw.mu.Lock()
+	delete(fw.fileHashes, filePath)
+	for name := range fw.fileHashes {
+		if strings.HasPrefix(name, prefix) {
+			delete(fw.fileHashes, name)
+		}
+	}
+	fw.mu.Unlock()
+}
+
+// debouncedRebuild 防抖重建；定时器在 mu 保护下创建和触发，关闭后不再发送重建信号
+func (fw *FileWatcher) debouncedRebuild(name string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.closed {
+		return
+	}
+	fw.pending[name] = true
+
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+
+	fw.timer = time.AfterFunc(fw.debounce, func() {
+		fw.mu.Lock()
+		defer fw.mu.Unlock()
+		if fw.closed {
+			return
+		}
+		select {
+		case fw.rebuildCh <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// Start 开始监听文件变化
+func (fw *FileWatcher) Start() error {
+	fmt.Println("[watch] 正在监听文件变化，按 Ctrl+C 退出...")
+
+	fw.mu.Lock()
+	if fw.closed || fw.running {
+		fw.mu.Unlock()
+		return nil
+	}
+	fw.running = true
+	fw.mu.Unlock()
+	defer close(fw.loopDone)
+
+	// 启动重建协程
+	go fw.rebuildWorker()
+
+	for {
+		select {
+		case event, ok := <-fw.watcher.Events:
+			if !ok {
+				return nil
+			}
+			fw.handleFileEvent(event)
+
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("[watch] 错误: %v\n", err)
+		}
+	}
+}
+
+// handleFileEvent 处理文件事件
+func (fw *FileWatcher) handleFileEvent(event fsnotify.Event) {
+	// 跳过隐藏文件、输出目录、缓存目录和排除的路径
+	if fw.ignored(event.Name) {
+		return
+	}
+
+	switch {
+	case event.Op&fsnotify.Write == fsnotify.Write:
+		// 文件写入
+		if changed, err := fw.hasFileChanged(event.Name); err != nil {
+			fmt.Printf("[watch] 检查文件变化失败 %s: %v\n", event.Name, err)
+		} else if changed {
+			fmt.Printf("[watch] 检测到文件变化: %s\n", event.Name)
+			fw.debouncedRebuild(event.Name)
+		}
+
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		// 新建目录时监听其整个子树（fsnotify 不递归），目录中已有的文件一并记录
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := fw.watchTree(event.Name); err != nil {
+				fmt.Printf("[watch] 监听新目录失败 %s: %v\n", event.Name, err)
+			}
+			fmt.Printf("[watch] 检测到新目录: %s\n", event.Name)
+			fw.debouncedRebuild(event.Name)
+			return
+		}
+
+		// 文件创建
+		fmt.Printf("[watch] 检测到新文件: %s\n", event.Name)
+		if hash, err := fw.calculateFileHash(event.Name); err == nil {
+			fw.mu.Lock()
+			fw.fileHashes[event.Name] = hash
+			fw.mu.Unlock()
+		}
+		fw.debouncedRebuild(event.Name)
+
+	case event.Op&fsnotify.Remove == fsnotify.Remove:
+		// 文件删除
+		fmt.Printf("[watch] 检测到文件删除: %s\n", event.Name)
+		fw.removeFileHash(event.Name)
+		fw.debouncedRebuild(event.Name)
+
+	case event.Op&fsnotify.Rename == fsnotify.Rename:
+		// 文件重命名
+		fmt.Printf("[watch] 检测到文件重命名: %s\n", event.Name)
+		fw.removeFileHash(event.Name)
+		fw.debouncedRebuild(event.Name)
+	}
+}
+
+// rebuildWorker 重建工作协程
+func (fw *FileWatcher) rebuildWorker() {
+	for range fw.rebuildCh {
+		fmt.Println("[watch] 开始自动重建...")
+		start := time.Now()
+
+		// 取出本轮变化的文件
+		fw.mu.Lock()
+		changed := make([]string, 0, len(fw.pending))
+		for name := range fw.pending {
+			changed = append(changed, name)
+		}
+		fw.pending = make(map[string]bool)
+		fw.mu.Unlock()
+		sort.Strings(changed)
+
+		// 配置文件变化时先重新加载配置，加载失败则不重建
+		if err := fw.reloadConfig(changed); err != nil {
+			fmt.Printf("[watch] 重新加载配置失败: %v\n", err)
+			if fw.OnRebuild != nil {
+				fw.OnRebuild(changed, err)
+			}
+			continue
+		}
+
+		err := fw.site.Rebuild(changed)
+		if err != nil {
+			fmt.Printf("[watch] 自动重建失败: %v\n", err)
+		} else {
+			duration := time.Since(start)
+			fmt.Printf("[watch] 自动重建完成！耗时: %v\n", duration)
+		}
+
+		if fw.OnRebuild != nil {
+			fw.OnRebuild(changed, err)
+		}
+	}
+}
+
+// reloadConfig 变化的文件中包含配置文件时重新加载配置，并按新配置补充监听目录
+func (fw *FileWatcher) reloadConfig(changed []string) error {
+	cfg := fw.currentConfig()
+	reload := false
+	for _, name := range changed {
+		if cfg.IsConfigFile(name) {
+			reload = true
+			break
+		}
+	}
+	if !reload {
+		return nil
+	}
+
+	newCfg, err := cfg.Reload()
+	if err != nil {
+		return err
+	}
+	fw.mu.Lock()
+	fw.config = newCfg
+	fw.mu.Unlock()
+	fw.site.SetConfig(newCfg)
+	fmt.Println("[watch] 已重新加载配置")
+
+	// 主题等目录可能已变化
+	for _, root := range fw.watchRoots() {
+		if err := fw.watchTree(root); err != nil {
+			fmt.Printf("[watch] 监听目录失败 %s: %v\n", root, err)
+		}
+	}
+	return nil
+}
+
+// Close 关闭文件监听器：先停止事件循环，再停止定时器并关闭重建通道，可重复调用
+func (fw *FileWatcher) Close() error {
+	fw.mu.Lock()
+	if fw.closed {
+		fw.mu.Unlock()
+		return nil
+	}
+	running := fw.running
+	fw.mu.Unlock()
+
+	// 关闭 fsnotify 后事件通道关闭，事件循环随之退出，不会再创建新的定时器
+	err := fw.watcher.Close()
+	if running {
+		<-fw.loopDone
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.closed {
+		return err
+	}
+	fw.closed = true
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+	close(fw.rebuildCh)
+	return err
+}
+
+// ==================== 路由表与内存开发服务器 ====================
+
+// siteRoute 站点的一个输出：规范 URL 路径、指向同一内容的别名路径和渲染函数
+type siteRoute struct {
+	Path    string   // 规范路径，如 /2024/01/02/hello.html
+	Aliases []string // 别名路径，如文章的归档副本
+	Render  func() (string, error)
+	Tags    bool // 输出读取标签云，开发模式下后台索引完成后需要重新渲染
+}
+
+// devRoute 开发模式路由表中的一个输出，首次请求时渲染，结果保存在快照中直到被新快照替换
+type devRoute struct {
+	render  func() (string, error)
+	once    sync.Once
+	content []byte
+	err     error
+}
+
+// get 返回输出内容，并发请求同一输出时只渲染一次
+func (r *devRoute) get() ([]byte, error) {
+	r.once.Do(func() {
+		content, err := r.render()
+		r.content, r.err = []byte(content), err
+	})
+	return r.content, r.err
+}
+
+// outputRoutes 返回站点的全部输出（不含静态文件），后加入的路由覆盖同路径的先加入者，与写入磁盘的顺序一致
+func (s *Site) outputRoutes() []siteRoute {
+	var routes []siteRoute
+	for _, ls := range s.sites {
+		routes = append(routes, ls.languageRoutes()...)
+	}
+	routes = append(routes, siteRoute{Path: "/sitemap.xml", Render: s.renderSitemap})
+	return append(routes, s.searchRoutes()...)
+}
+
+// languageRoutes 返回一种语言的输出：列表页、页面、文章和 RSS Feed
+func (s *Site) languageRoutes() []siteRoute {
+	// 布局是否读取标签云，按布局缓存分析结果
+	readsTags := make(map[string]bool)
+	tags := func(layout string) bool {
+		v, ok := readsTags[layout]
+		if !ok {
+			v = slices.Contains(templateDependencies(s.MasterTemplate, layout), "tags")
+			readsTags[layout] = v
+		}
+		return v
+	}
+
+	var routes []siteRoute
+	for i := range s.PagedPosts {
+		i := i
+		routes = append(routes, siteRoute{Path: s.paginationRoute(i), Tags: tags("index"), Render: func() (string, error) {
+			return s.renderPaginationPage(i)
+		}})
+	}
+	routes = append(routes, siteRoute{Path: s.LangPrefix + "/archives/index.html", Tags: tags("archive"), Render: s.renderArchivesPage})
+	if _, exists := s.Layouts["tag"]; exists {
+		routes = append(routes, siteRoute{Path: s.LangPrefix + "/tags/index.html", Tags: true, Render: s.renderTagsPage})
+	}
+	if s.hasSearchPage() {
+		routes = append(routes, siteRoute{Path: s.LangPrefix + "/search.html", Tags: tags("search"), Render: s.renderSearchPage})
+	}
+
+	// 按需渲染不写回 RenderedContent，快照副本共享的页面和文章不会被修改
+	for _, p := range s.Pages {
+		p := p
+		routes = append(routes, siteRoute{Path: "/" + p.URL, Tags: tags(p.layoutName()), Render: func() (string, error) {
+			return s.pageHTML(p)
+		}})
+	}
+	for _, p := range s.Posts {
+		p := p
+		route, archive := s.postRoutes(p)
+		routes = append(routes, siteRoute{Path: route, Aliases: []string{archive}, Tags: tags(p.layoutName()), Render: func() (string, error) {
+			html, _, err := s.postHTML(p)
+			return html, err
+		}})
+	}
+
+	return append(routes, siteRoute{Path: s.LangPrefix + "/feed.xml", Render: s.renderFeed})
+}
+
+// postRoutes 返回文章的 URL 路径和归档副本路径 /archives/年/月/日/slug.html
+func (s *Site) postRoutes(p *Post) (route, archive string) {
+	// 从绝对URL中提取相对路径
+	route = p.extractRelativeURL()
+	archive = path.Join("/", s.LangPrefix, "archives", p.Date.Format("2006"), p.Date.Format("01"), p.Date.Format("02"), path.Base(route))
+	return route, archive
+}
+
+// paginationRoute 返回第 i 个分页页面（从 0 开始）的 URL 路径，第一页即首页
+func (s *Site) paginationRoute(i int) string {
+	if i == 0 {
+		return path.Join("/", s.LangPrefix, "index.html")
+	}
+	return path.Join("/", s.LangPrefix, s.Config.PaginationDir(), strconv.Itoa(i+1), "index.html")
+}
+
+// routeOutputPath 返回 URL 路径在输出目录中对应的文件
+func (s *Site) routeOutputPath(route string) string {
+	return filepath.Join(s.Config.Destination, filepath.FromSlash(route))
+}
+
+// routeCandidates 返回请求路径可能对应的输出路径：路径本身、补全 .html 和目录下的 index.html，
+// 与静态服务器的解析方式相同
+func routeCandidates(reqPath string) []string {
+	candidates := []string{reqPath}
+	if strings.HasSuffix(reqPath, "/") {
+		candidates = append(candidates, reqPath+"index.html")
+	} else if !strings.HasSuffix(reqPath, ".html") {
+		candidates = append(candidates, reqPath+".html", reqPath+"/index.html")
+	}
+	return candidates
+}
+
+// lookupRoute 按请求路径查找开发模式的输出，返回规范路径，找不到时返回 nil
+func (s *Site) lookupRoute(reqPath string) (string, *devRoute) {
+	for _, candidate := range routeCandidates(reqPath) {
+		if target, ok := s.RouteTree.Get(candidate); ok {
+			name := target.(string)
+			return name, s.routes[name]
+		}
+	}
+	return "", nil
+}
+
+// outputFile 把请求路径解析为输出目录中的文件，文章还可以通过URL二叉树查找
+func (s *Site) outputFile(reqPath string) (string, bool) {
+	candidates := routeCandidates(reqPath)
+	if post := s.URLTree.Search(reqPath); post != nil {
+		candidates = append([]string{post.extractRelativeURL()}, candidates...)
+	}
+	for _, candidate := range candidates {
+		filePath := s.routeOutputPath(candidate)
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			return filePath, true
+		}
+	}
+	return "", false
+}
+
+// staticFile 在文件层中查找静态资源目录下的文件，返回优先级最高一层的内容和修改时间（内置主题没有修改时间）
+func (s *Site) staticFile(reqPath string) ([]byte, time.Time, bool) {
+	name := strings.TrimPrefix(reqPath, "/")
+	if !fs.ValidPath(name) || !slices.Contains(staticDirs, strings.SplitN(name, "/", 2)[0]) {
+		return nil, time.Time{}, false
+	}
+	for _, layer := range s.fileLayers() {
+		info, err := fs.Stat(layer.FS, name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		data, err := fs.ReadFile(layer.FS, name)
+		if err != nil {
+			return nil, time.Time{}, false
+		}
+		return data, info.ModTime(), true
+	}
+	return nil, time.Time{}, false
+}
+
+// notFoundPage 返回请求路径所在语言的 404 页面，没有时回退到默认语言的 404 页面
+func (s *Site) notFoundPage(reqPath string) ([]byte, bool) {
+	var candidates []string
+	for _, code := range s.Config.LanguageCodes() {
+		if prefix := s.Config.LanguagePrefix(code); prefix != "" && (reqPath == prefix || strings.HasPrefix(reqPath, prefix+"/")) {
+			candidates = append(candidates, prefix+"/404.html")
+		}
+	}
+	candidates = append(candidates, "/404.html")
+
+	for _, name := range candidates {
+		if s.memory {
+			if _, route := s.lookupRoute(name); route != nil {
+				if data, err := route.get(); err == nil {
+					return data, true
+				}
+			}
+			continue
+		}
+		if data, err := os.ReadFile(s.routeOutputPath(name)); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// webMIMETypes 常见网页资源的 Content-Type，补充并统一标准库在不同系统上的类型表
+var webMIMETypes = map[string]string{
+	".html":        "text/html; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".json":        "application/json; charset=utf-8",
+	".map":         "application/json; charset=utf-8",
+	".xml":         "application/xml; charset=utf-8",
+	".txt":         "text/plain; charset=utf-8",
+	".md":          "text/markdown; charset=utf-8",
+	".svg":         "image/svg+xml",
+	".png":         "image/png",
+	".jpg":         "image/jpeg",
+	".jpeg":        "image/jpeg",
+	".gif":         "image/gif",
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".ico":         "image/x-icon",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".webmanifest": "application/manifest+json",
+	".pdf":         "application/pdf",
+	".wasm":        "application/wasm",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".mp3":         "audio/mpeg",
+	".gz":          "application/gzip",
+	".br":          "application/x-brotli",
+}
+
+// contentType 根据扩展名返回 Content-Type；未知类型返回空字符串，由 http.ServeContent 根据内容判断
+func contentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if typ, ok := webMIMETypes[ext]; ok {
+		return typ
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// contentETag 返回内容的强 ETag；压缩后的内容有各自的 ETag
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// compressibleExts 值得压缩的文本输出
+var compressibleExts = []string{".html", ".css", ".js", ".xml", ".json"}
+
+// compressible 判断文件是否是值得压缩的文本输出
+func compressible(name string) bool {
+	return slices.Contains(compressibleExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// gzipBytes 以最高压缩率压缩内容；gzip 头不含文件名和时间，相同内容的压缩结果相同
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// acceptsEncoding 判断 Accept-Encoding 是否接受某种编码；q=0 表示拒绝，* 匹配未列出的编码
+func acceptsEncoding(header, enc string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != enc && name != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name == enc {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// encodeResponse 按 Accept-Encoding 选择响应的编码：优先使用预压缩的 .br 或 .gz 副本（没有网络依赖的
+// brotli 编码器，因此 br 只来自预压缩副本），否则对不小于 gzip_min_length 的内容即时 gzip 压缩。
+// 不压缩时返回空编码和原内容
+func (s *Site) encodeResponse(acceptEncoding string, data []byte, sibling func(ext string) ([]byte, bool)) (string, []byte) {
+	if sibling != nil {
+		for _, enc := range []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+			if !acceptsEncoding(acceptEncoding, enc.name) {
+				continue
+			}
+			if body, ok := sibling(enc.ext); ok {
+				return enc.name, body
+			}
+		}
+	}
+	if len(data) < s.Config.GzipMinLength || !acceptsEncoding(acceptEncoding, "gzip") {
+		return "", data
+	}
+	return "gzip", gzipBytes(data)
+}
+
+// siblingFile 读取输出文件的预压缩副本；副本比原文件旧时视为过期
+func siblingFile(path string, modTime time.Time) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.ModTime().Before(modTime) {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// renderErrorPage 开发模式下输出渲染失败时返回的页面，修复后实时刷新会重新加载
+func renderErrorPage(route string, err error) []byte {
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>渲染失败</title></head>
+<body>
+<h1>渲染 %s 失败</h1>
+<pre>%s</pre>
+</body>
+</html>
+`, template.HTMLEscapeString(route), template.HTMLEscapeString(err.Error())))
+}
+
+// ==================== 实时刷新 ====================
+
+// liveReloadPath 实时刷新的 Server-Sent Events 端点
+const liveReloadPath = "/__jacky/livereload"
+
+// liveReloadScript 开发服务器注入到 HTML 页面中的客户端脚本：
+// 重建成功后刷新页面，只有样式表变化时只重新加载样式，构建失败时显示错误浮层
+const liveReloadScript = `<script>
+(function () {
+  var source = new EventSource("` + liveReloadPath + `");
+  var lost = false;
+  source.onopen = function () { if (lost) location.reload(); };
+  source.onerror = function () { lost = true; };
+  source.onmessage = function (e) {
+    var ev = JSON.parse(e.data);
+    var overlay = document.getElementById("__jacky-error");
+    if (ev.type === "error") {
+      if (!overlay) {
+        overlay = document.createElement("div");
+        overlay.id = "__jacky-error";
+        overlay.style.cssText = "position:fixed;inset:0;z-index:2147483647;overflow:auto;margin:0;padding:2em;" +
+          "background:rgba(24,24,24,.94);color:#ff8a8a;font:14px/1.5 monospace;white-space:pre-wrap";
+        document.body.appendChild(overlay);
+      }
+      overlay.textContent = "构建失败\n\n" + ev.error;
+      return;
+    }
+    if (overlay) overlay.remove();
+    if (ev.type === "css") {
+      document.querySelectorAll('link[rel="stylesheet"]').forEach(function (link) {
+        var url = new URL(link.href);
+        url.searchParams.set("livereload", Date.now());
+        link.href = url.href;
+      });
+      return;
+    }
+    location.reload();
+  };
+})();
+</script>
+`
+
+// liveReloadEvent 推送给浏览器的重建结果
+type liveReloadEvent struct {
+	Type  string `json:"type"`            // reload、css 或 error
+	Error string `json:"error,omitempty"` // 构建错误信息
+}
+
+// LiveReload 通过 Server-Sent Events 把重建结果广播给所有打开的页面
+type LiveReload struct {
+	mu      sync.Mutex
+	clients map[chan liveReloadEvent]struct{}
+	failed  *liveReloadEvent // 最近一次构建失败的错误，新打开的页面也需要显示
+	done    chan struct{}    // 关闭后所有 SSE 连接结束，服务器才能完成优雅关闭
+	once    sync.Once
+}
+
+// NewLiveReload 创建实时刷新广播器
+func NewLiveReload() *LiveReload {
+	return &LiveReload{clients: make(map[chan liveReloadEvent]struct{}), done: make(chan struct{})}
+}
+
+// Close 结束所有 SSE 连接，可以重复调用
+func (lr *LiveReload) Close() {
+	lr.once.Do(func() { close(lr.done) })
+}
+
+// Notify 根据重建结果通知浏览器：失败时显示错误浮层，只有样式表变化时只刷新样式，否则刷新页面
+func (lr *LiveReload) Notify(changed []string, err error) {
+	ev := liveReloadEvent{Type: "reload"}
+	switch {
+	case err != nil:
+		ev = liveReloadEvent{Type: "error", Error: err.Error()}
+	case len(changed) > 0:
+		ev.Type = "css"
+		for _, name := range changed {
+			if !strings.EqualFold(filepath.Ext(name), ".css") {
+				ev.Type = "reload"
+				break
+			}
+		}
+	}
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if err != nil {
+		lr.failed = &ev
+	} else {
+		lr.failed = nil
+	}
+	for ch := range lr.clients {
+		select {
+		case ch <- ev:
+		default: // 页面处理不过来时丢弃，下一次事件仍会刷新
+		}
+	}
+}
+
+// subscribe 注册一个页面连接；上次构建失败时立即发送错误
+func (lr *LiveReload) subscribe() chan liveReloadEvent {
+	ch := make(chan liveReloadEvent, 4)
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.failed != nil {
+		ch <- *lr.failed
+	}
+	lr.clients[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe 移除页面连接
+func (lr *LiveReload) unsubscribe(ch chan liveReloadEvent) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	delete(lr.clients, ch)
+}
+
+// Handler 处理 SSE 连接，直到浏览器断开或服务器关闭
+func (lr *LiveReload) Handler(c *gin.Context) {
+	// 长连接不受服务器 write_timeout 限制
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	ch := lr.subscribe()
+	defer lr.unsubscribe(ch)
+
+	// 断线后一秒重连
+	fmt.Fprint(c.Writer, "retry: 1000\n\n")
+	c.Writer.Flush()
+
+	// 定期发送注释行，避免代理或浏览器关闭空闲连接
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-lr.done:
+			return
+		case ev := <-ch:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// injectLiveReload 在 </body> 前插入实时刷新脚本，没有 </body> 时追加到末尾；
+// 总是返回新的切片，传入的可能是多个请求共享的缓存内容
+func injectLiveReload(html []byte) []byte {
+	idx := bytes.LastIndex(bytes.ToLower(html), []byte("</body>"))
+	if idx < 0 {
+		idx = len(html)
+	}
+	out := make([]byte, 0, len(html)+len(liveReloadScript))
+	out = append(out, html[:idx]...)
+	out = append(out, liveReloadScript...)
+	return append(out, html[idx:]...)
+}
+
+// ==================== 主程序 ====================
+
+func main() {
+	// 解析命令行参数，模仿 Jekyll 的使用方式
+	var (
+		flagServe        = flag.Bool("serve", false, "启动本地服务器")
+		flagWatch        = flag.Bool("watch", false, "监听文件变化自动重建")
+		flagNoWatch      = flag.Bool("no-watch", false, "服务器模式下不监听文件变化")
+		flagDev          = flag.Bool("dev", false, "开发模式：服务器在内存中按需渲染页面，不写入输出目录")
+		flagPort         = flag.Int("port", 4000, "服务器端口")
+		flagHost         = flag.String("host", "127.0.0.1", "服务器主机")
+		flagBaseURL      = flag.String("baseurl", "", "站点基础URL")
+		flagConfig       = flag.String("config", "_config.yml", "配置文件路径")
+		flagSource       = flag.String("source", ".", "源目录路径")
+		flagDestination  = flag.String("destination", "_site", "输出目录路径")
+		flagJobs         = flag.Int("jobs", 0, "并发渲染和写入的工作协程数 (默认: GOMAXPROCS)")
+		flagIncremental  = flag.Bool("incremental", false, "增量构建：只重新渲染受影响的输出")
+		flagGzipStatic   = flag.Bool("gzip-static", false, "为文本输出写入 .gz 预压缩副本")
+		flagVerbose      = flag.Bool("verbose", false, "详细输出")
+		flagQuiet        = flag.Bool("quiet", false, "静默模式")
+		flagNewPost      = flag.String("new_post", "", "新建文章（标题）")
+		flagNewPage      = flag.String("new_page", "", "新建页面（名称）")
+		flagDoctor       = flag.Bool("doctor", false, "自动修复项目结构和缺失文件")
+		flagTestMarkdown = flag.Bool("test-markdown", false, "测试Markdown格式健壮性")
+		flagHelp         = flag.Bool("help", false, "显示帮助信息")
+		flagVersion      = flag.Bool("version", false, "显示版本信息")
+	)
+	flag.Parse()
+
+	// 显示帮助信息
+	if *flagHelp {
+		showHelp()
+		return
+	}
+
+	// 显示版本信息
+	if *flagVersion {
+		showVersion()
+		return
+	}
+
+	// 设置日志级别
+	if *flagQuiet {
+		log.SetOutput(os.Stderr)
+	} else if *flagVerbose {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	}
+
+	// 加载配置
+	cfg, err := Load(*flagConfig, *flagSource, *flagDestination)
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 应用命令行参数到配置（监听模式重新加载配置后再次应用）
+	cfg.overrides = func(c *Config) {
+		c.Port = *flagPort
+		c.Host = *flagHost
+		if *flagBaseURL != "" {
+			c.BaseURL = *flagBaseURL
+		}
+		if *flagJobs > 0 {
+			c.Jobs = *flagJobs
+		}
+		if *flagIncremental {
+			c.Incremental = true
+		}
+		if *flagGzipStatic {
+			c.GzipStatic = true
+		}
+	}
+	cfg.overrides(cfg)
+
+	// 处理新建文章
+	if *flagNewPost != "" {
+		err := createNewPost(*flagNewPost, cfg)
+		if err != nil {
+			log.Fatalf("新建文章失败: %v", err)
+		}
+		fmt.Printf("新建文章成功: %s\n", *flagNewPost)
+		return
+	}
+
+	// 处理新建页面
+	if *flagNewPage != "" {
+		err := createNewPage(*flagNewPage, cfg)
+		if err != nil {
+			log.Fatalf("新建页面失败: %v", err)
+		}
+		fmt.Printf("新建页面成功: %s\n", *flagNewPage)
+		return
+	}
+
+	// 处理项目结构修复
+	if *flagDoctor {
+		fixed, report := doctorCheck(cfg)
+		for _, r := range report {
+			fmt.Println(r)
+		}
+		if fixed {
+			fmt.Println("\n项目结构已修复，请重新构建。")
+		} else {
+			fmt.Println("\n项目结构检查完成。")
+		}
+		return
+	}
+
+	// 处理Markdown格式测试
+	if *flagTestMarkdown {
+		testMarkdownRobustness(cfg)
+		return
+	}
+
+	// 处理子命令
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "theme":
+			if len(args) < 3 || args[1] != "new" {
+				log.Fatalf("用法: jacky theme new <名称>")
+			}
+			if err := createNewTheme(args[2], cfg); err != nil {
+				log.Fatalf("新建主题失败: %v", err)
+			}
+			fmt.Printf("新建主题成功: %s\n", filepath.Join(cfg.Source, "themes", args[2]))
+			fmt.Printf("在 _config.yml 中设置 theme: %s 以启用该主题\n", args[2])
+			return
+		case "eject":
+			if err := ejectDefaultTheme(cfg); err != nil {
+				log.Fatalf("导出内置主题失败: %v", err)
+			}
+			return
+		default:
+			log.Fatalf("未知命令: %s", args[0])
+		}
+	}
+
+	// 创建站点实例；分词和繁简转换词典在退出前释放
+	site := New(cfg)
+	defer analyzer.Close()
+
+	// 处理服务器模式（默认监听文件变化并实时刷新浏览器）
+	if *flagServe {
+		if err := site.Serve(cfg.Host, cfg.Port, !*flagNoWatch, *flagDev); err != nil {
+			log.Fatalf("服务器启动失败: %v", err)
+		}
+		return
+	}
+
+	// 处理监听模式
+	if *flagWatch {
+		if err := site.Watch(); err != nil {
+			log.Fatalf("监听失败: %v", err)
+		}
+		return
+	}
+
+	// 默认构建模式
+	// 构建前先 doctor 检查
+	fixed, report := doctorCheck(cfg)
+	for _, r := range report {
+		fmt.Println(r)
+	}
+	if fixed {
+		fmt.Println("\n项目结构已修复，请重新构建。")
+		return
+	}
+	// 检查通过才继续构建
+	if err := site.Build(); err != nil {
+		log.Fatalf("构建失败: %v", err)
+	}
+	fmt.Println("构建完成！")
+}
+
+// showHelp 显示帮助信息
+func showHelp() {
+	fmt.Println(`Jekyll-like Static Site Generator
+
+用法:
+  main [命令] [选项]
+
+命令:
+  build             构建站点 (默认)
+  serve             启动本地服务器，监听文件变化并实时刷新浏览器
+  watch             监听文件变化自动重建
+  new_post          新建文章
+  new_page          新建页面
+  doctor            自动修复项目结构
+  test-markdown     测试Markdown格式健壮性
+  theme new NAME    在 themes/NAME 下生成主题骨架
+  eject             将内置默认主题导出到站点目录以便自定义
+
+选项:
+  --config PATH     配置文件路径 (默认: _config.yml)
+  --source PATH     源目录路径 (默认: .)
+  --destination PATH 输出目录路径 (默认: _site)
+  --port PORT       服务器端口 (默认: 4000)
+  --host HOST       服务器主机 (默认: 127.0.0.1)
+  --baseurl URL     站点基础URL
+  --no-watch        服务器模式下不监听文件变化、不实时刷新浏览器
+  --dev             开发模式：服务器在内存中按需渲染页面，启动更快且不写入输出目录
+  --jobs N          并发渲染和写入的工作协程数 (默认: GOMAXPROCS)
+  --incremental     增量构建，缓存保存在 cache_dir (默认: .jekyll-cache)
+  --gzip-static     为不小于 gzip_min_length (默认: 1024) 字节的 HTML/CSS/JS/XML/JSON
+                    输出写入 .gz 副本，供 nginx gzip_static 直接使用
+  --draft           构建草稿文章
+  --future          构建未来日期的文章
+  --limit N         限制构建的文章数量
+  --safe            安全模式（禁用插件）
+  --verbose         详细输出
+  --quiet           静默模式
+  --help            显示帮助信息
+  --version         显示版本信息
+
+示例:
+  main                    # 构建站点
+  main serve              # 启动服务器
+  main serve --port 8080  # 在端口8080启动服务器
+  main serve --dev        # 在内存中按需渲染，不写入 _site
+  main watch              # 监听文件变化
+  main new_post "我的文章"  # 新建文章
+  main new_page "关于"     # 新建页面
+  main doctor             # 修复项目结构
+  main theme new house    # 新建主题 themes/house
+  main --incremental      # 只重新渲染受修改影响的页面
+
+主题:
+  在 _config.yml 中设置 theme: house（或主题目录路径）即可启用主题。
+  主题可提供 _layouts、_includes、_data、stylesheets 及 images/js/fonts/assets，
+  站点中的同名文件会覆盖主题文件。未提供的文件由内置默认主题补齐，
+  因此只包含 _posts 的目录也可以直接构建。
+
+多语言:
+  在 _config.yml 中配置 default_lang 和 languages（每种语言可设置 name、title、
+  description、prefix）。内容语言由文件名后缀（post.en.md）或前置数据 lang 决定，
+  模板中使用 {{ t "key" }} 读取 _i18n/<语言>.yml 中的翻译。
+  chinese_mirror: zh-hant 额外生成默认语言内容的繁体镜像，输出到 /zh-hant/
+  （zh-hans 生成简体镜像，auto 按默认语言选择另一种字形）。镜像转换标题、摘要和
+  渲染后的页面文本，代码块和 URL 保持原样；原页面和镜像页面互相带有 hreflang 链接。
+  布局中的 alternates 变量列出当前页面的各语言和镜像版本（Lang、Name、URL），用于语言切换。
+  文章标题和摘要按原文显示，标签云使用标题的简体副本，搜索索引自行归一为简体并按原文高亮；
+  simplify_titles: true 把所有文章的标题和摘要转为简体显示，前置数据 simplify 按文章覆盖。
+
+搜索:
+  构建时生成静态搜索索引 search.json（文章较多时词项分到 search-<n>.json），
+  默认搜索页面直接在浏览器中查询，部署到静态托管也能使用；
+  服务器的 /api/search 使用同一个索引和排序规则。索引包含标题、标签、描述和
+  正文，按 BM25 加权排序；/api/search 支持 limit 和 offset 分页，每个结果带有
+  <mark> 高亮的标题和正文片段，片段长度由 search_snippet_length 或 snippet_length
+  参数设置，繁体原文的高亮位置与简体查询对应。
+  /api/search/suggest?q= 返回以输入开头的词项、标题和标签，按文档数排序，
+  不含汉字的输入按拼音匹配（bo ke 提示 博客）；搜索没有结果时 did_you_mean
+  给出编辑距离最近的词项改写的查询。候选同时写入 search-suggest.json。
+  文章和页面（Markdown 和 HTML，HTML 页面只索引标签之外的文本）都参与搜索，结果的 type 为 post 或 page；
+  search_collections: {pages: false} 关闭整个集合，前置数据 search: false
+  排除单篇文档。
+  查询语法：空格分隔的条件同时满足，OR 连接多组条件，"短语" 要求连续出现，
+  -词 排除，title:词 只查标题，tag:go、date:2024..2025（可省略一端）和
+  lang:en 按标签、日期和语言筛选；语法错误返回 400 和出错位置。
+  /api/search 的 sort=date 按日期排序，collection 参数只返回指定集合。
+  中文词项同时按全拼和首字母索引，拼音查询（boke、bk、bókè、bo2ke4）也能命中
+  中文内容，并排在字面命中的英文单词前面。
+  _data/jieba_user.dict 是分词用户词典（每行“词 [词频] [词性]”），
+  _data/synonyms.yml 列出同义词组（- [k8s, kubernetes]），查询时按同义词扩展，
+  修改这两个文件后开发服务器会重建索引。
+
+服务器:
+  源目录根下的 404.md 或 404.html 经过布局渲染，作为 404 页面返回。
+  响应带有 ETag 和 Last-Modified，支持条件请求；在 _config.yml 中按路径模式
+  设置 Cache-Control（第一条匹配的规则生效）:
+    cache_control:
+      - pattern: stylesheets
+        value: public, max-age=31536000, immutable
+      - pattern: "*.html"
+        value: no-cache
+  文本响应按 Accept-Encoding 压缩：优先使用输出目录中的 .br/.gz 预压缩副本，
+  否则即时 gzip 压缩不小于 gzip_min_length 字节的内容。
+  read_timeout、write_timeout、idle_timeout 设置连接超时（如 30s）；收到 Ctrl+C 或
+  SIGTERM 时等待进行中的请求完成后退出。/api 默认不允许跨域，cors_origins 列出
+  允许的来源。预览部署可设置 basic_auth（username、password）要求认证，
+  设置 tls_cert 和 tls_key 后以 HTTPS 提供服务。
+
+更多信息请访问: https://github.com/your-repo/jekyll-go`)
+}
+
+// showVersion 显示版本信息
+func showVersion() {
+	fmt.Println("Jekyll-like Static Site Generator v1.0.0")
+	fmt.Println("Go version: go1.21+")
+	fmt.Println("License: MIT")
+}
+
+// testMarkdownRobustness 测试Markdown格式的健壮性
+func testMarkdownRobustness(cfg *Config) {
+	fmt.Println("=== 测试Markdown格式健壮性 ===")
+
+	// 测试用例
+	testCases := []struct {
+		name    string
+		content string
+		expect  bool
+	}{
+		{
+			name: "正常Markdown",
+			content: `---
+title: "测试文章"
+date: 2024-01-01
+layout: post
+---
+
+# 标题1
+
+这是一段正常的内容。
+
+## 标题2
+
+- 列表项1
+- 列表项2
+
+` + "```go\nfunc main() {\n    fmt.Println(\"Hello, World!\")\n}\n```" + `
+`,
+			expect: true,
+		},
+		{
+			name: "缺少前置数据",
+			content: `# 标题
+
+这是没有前置数据的内容。
+
+- 列表项
+`,
+			expect: true,
+		},
+		{
+			name: "格式错误的标题",
+			content: `---
+title: "测试"
+---
+
+#标题1
+##标题2
+
+正常内容
+`,
+			expect: false,
+		},
+		{
+			name: "格式错误的列表",
+			content: `---
+title: "测试"
+---
+
+-列表项1
+*列表项2
++列表项3
+`,
+			expect: false,
+		},
+		{
+			name: "未闭合的代码块",
+			content: `---
+title: "测试"
+---
+
+` + "```go\nfunc main() {\n    fmt.Println(\"Hello\")\n// 缺少结束标记" + `
+`,
+			expect: false,
+		},
+		{
+			name:    "空内容",
+			content: "",
+			expect:  false,
+		},
+		{
+			name:    "只有空白字符",
+			content: "   \n\t\n  ",
+			expect:  false,
+		},
+		{
+			name: "YAML格式错误",
+			content: `---
+title: "测试"
+date: 2024-01-01
+layout: post
+invalid: yaml: format
+---
+
+正常内容
+`,
+			expect: true, // YAML错误应该被捕获但不导致崩溃
+		},
+	}
+
+	// 验证Markdown格式
+	for i, testCase := range testCases {
+		valid, errors := ValidateMarkdown(testCase.content)
+
+		fmt.Printf("测试 %d (%s): ", i+1, testCase.name)
+		if valid == testCase.expect {
+			fmt.Printf("✓ 通过")
+		} else {
+			fmt.Printf("✗ 失败")
+		}
+
+		if !valid && len(errors) > 0 {
+			fmt.Printf(" (错误: %s)", strings.Join(errors, ", "))
+		}
+		fmt.Println()
+	}
+
+	// 测试Markdown转换
+	fmt.Println("\n=== 测试Markdown转换 ===")
+	converter := NewConverter(cfg)
+
+	for i, testCase := range testCases {
+		fmt.Printf("转换测试 %d (%s): ", i+1, testCase.name)
+
+		html, err := converter.Convert(testCase.content)
+		if err != nil {
+			fmt.Printf("✗ 转换失败 - %v\n", err)
+		} else {
+			fmt.Printf("✓ 转换成功 (长度: %d)\n", len(html))
+		}
+	}
+
+	fmt.Println("\n=== Markdown健壮性测试完成 ===")
+}
+
+// ==================== 文本分析 ====================
+
+// textAnalyzer 共享的文本分析服务：Jieba 分词和关键词提取、OpenCC 繁简转换。
+// 词典在首次使用时加载一次，由构建和服务器的各个 goroutine 同时使用；Close 释放词典，
+// 之后再次使用时重新加载
+type textAnalyzer struct {
+	mu       sync.RWMutex // 读锁保护一次调用，写锁用于加载和释放
+	jieba    *gojieba.Jieba
+	opencc   bool         // OpenCC 词典已加载
+	t2s      *gocc.OpenCC // 加载失败时为 nil，转换返回原文
+	s2t      *gocc.OpenCC
+	userDict []userWord // 站点的用户词典，加载 Jieba 后加入
+}
+
+// userWord 用户词典中的一个词；Freq 为 0 时使用 Jieba 的默认权重
+type userWord struct {
+	Word string
+	Freq int
+	Tag  string
+}
+
+// 站点数据目录中的自定义分词词典和同义词
+const (
+	userDictFile = "jieba_user.dict"
+	synonymsFile = "synonyms.yml"
+)
+
+// analyzer 进程内共享的文本分析服务
+var analyzer = &textAnalyzer{}
+
+// acquire 在词典加载后持有读锁返回，调用方负责 RUnlock
+func (a *textAnalyzer) acquire() {
+	for {
+		a.mu.RLock()
+		if a.jieba != nil {
+			return
+		}
+		a.mu.RUnlock()
+
+		a.mu.Lock()
+		if a.jieba == nil {
+			start := time.Now()
+			if !a.opencc {
+				var err error
+				if a.t2s, err = gocc.New("t2s"); err != nil {
+					log.Printf("繁简转换初始化失败: %v", err)
+				}
+				if a.s2t, err = gocc.New("s2t"); err != nil {
+					log.Printf("繁简转换初始化失败: %v", err)
+				}
+				a.opencc = true
+			}
+			// 分词在简体文本上进行，用户词也转为简体
+			a.jieba = gojieba.NewJieba()
+			for _, w := range a.userDict {
+				if w.Freq > 0 {
+					a.jieba.AddWordEx(convertText(a.t2s, w.Word), w.Freq, w.Tag)
+				} else {
+					a.jieba.AddWord(convertText(a.t2s, w.Word))
+				}
+			}
+			log.Printf("加载分词和繁简转换词典（用户词 %d 个），耗时 %v", len(a.userDict), time.Since(start))
+		}
+		a.mu.Unlock()
+	}
+}
+
+// UseUserDict 设置用户词典；与当前词典不同时释放已加载的分词器，下次使用时带上新词典重新加载
+func (a *textAnalyzer) UseUserDict(words []userWord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if slices.Equal(words, a.userDict) {
+		return
+	}
+	a.userDict = words
+	if a.jieba != nil {
+		a.jieba.Free()
+		a.jieba = nil
+	}
+}
+
+// Close 等待进行中的调用结束后释放词典
+func (a *textAnalyzer) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.jieba != nil {
+		a.jieba.Free()
+		a.jieba = nil
+	}
+	a.t2s, a.s2t, a.opencc = nil, nil, false
+}
+
+// parseUserDict 解析 Jieba 用户词典：每行“词 [词频] [词性]”，空行和 # 开头的行忽略，格式无效的行给出警告
+func parseUserDict(data []byte, name string) []userWord {
+	var words []userWord
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		w, rest := userWord{Word: fields[0]}, fields[1:]
+		if len(rest) > 0 {
+			if n, err := strconv.Atoi(rest[0]); err == nil && n > 0 {
+				w.Freq, rest = n, rest[1:]
+			}
+		}
+		if len(rest) > 0 {
+			w.Tag, rest = rest[0], rest[1:]
+		}
+		if len(rest) > 0 || !utf8.ValidString(w.Word) {
+			log.Printf("警告: %s 第 %d 行格式无效，已忽略: %s", name, i+1, strings.TrimSpace(line))
+			continue
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+// synonymSet 同义词：词 -> 所在组的全部词（包括自身），词已转为简体和小写
+type synonymSet map[string][]string
+
+// parseSynonyms 读取 synonyms.yml：同义词组的列表（[[k8s, kubernetes], [博客, 部落格]]），
+// 或者词到同义词的映射（kubernetes: [k8s, kube]）；同一个词出现在多个组中时合并这些组
+func parseSynonyms(v interface{}) synonymSet {
+	var groups [][]string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if list, ok := item.([]interface{}); ok {
+				groups = append(groups, stringList(list))
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			group := []string{key}
+			switch alts := v[key].(type) {
+			case []interface{}:
+				group = append(group, stringList(alts)...)
+			case string:
+				group = append(group, alts)
+			}
+			groups = append(groups, group)
+		}
+	}
+
+	set := make(synonymSet)
+	for _, group := range groups {
+		var merged []string
+		add := func(word string) {
+			if word != "" && !slices.Contains(merged, word) {
+				merged = append(merged, word)
+			}
+		}
+		for _, word := range group {
+			word = strings.ToLower(strings.TrimSpace(toSimplified(word)))
+			add(word)
+			for _, other := range set[word] {
+				add(other)
+			}
+		}
+		if len(merged) < 2 {
+			continue
+		}
+		for _, word := range merged {
+			set[word] = merged
+		}
+	}
+	return set
+}
+
+// stringList 把 YAML 列表中的元素转为字符串
+func stringList(list []interface{}) []string {
+	var out []string
+	for _, item := range list {
+		if item != nil {
+			out = append(out, fmt.Sprint(item))
+		}
+	}
+	return out
+}
+
+// Tokenize 用搜索模式切分文本，返回的词带有字节偏移
+func (a *textAnalyzer) Tokenize(text string) []gojieba.Word {
+	a.acquire()
+	defer a.mu.RUnlock()
+	return a.jieba.Tokenize(text, gojieba.SearchMode, true)
+}
+
+// CutForSearch 用搜索模式切分文本，长词会再切出其中的短词
+func (a *textAnalyzer) CutForSearch(text string) []string {
+	a.acquire()
+	defer a.mu.RUnlock()
+	return a.jieba.CutForSearch(text, true)
+}
+
+// Keywords 按 TF-IDF 返回文本中最重要的 topK 个关键词
+func (a *textAnalyzer) Keywords(text string, topK int) []string {
+	a.acquire()
+	defer a.mu.RUnlock()
+	return a.jieba.Extract(text, topK)
+}
+
+// ToSimplified 繁体转简体，失败时返回原文
+func (a *textAnalyzer) ToSimplified(s string) string {
+	a.acquire()
+	defer a.mu.RUnlock()
+	return convertText(a.t2s, s)
+}
+
+// ToTraditional 简体转繁体，失败时返回原文
+func (a *textAnalyzer) ToTraditional(s string) string {
+	a.acquire()
+	defer a.mu.RUnlock()
+	return convertText(a.s2t, s)
+}
+
+// convertText 用 OpenCC 转换文本，转换器不可用或转换失败时返回原文
+func convertText(cc *gocc.OpenCC, s string) string {
+	if cc == nil {
+		return s
+	}
+	result, err := cc.Convert(s)
+	if err != nil {
+		log.Printf("繁简转换失败: %v", err)
+		return s
+	}
+	return result
+}
+
+// ==================== 搜索索引 ====================
+
+// searchIndexVersion 静态搜索索引的格式版本
+const searchIndexVersion = 7
+
+// searchShardDocs 静态索引每个分片大约对应的文档数，文档更多时词项按哈希分到多个文件
+const searchShardDocs = 500
+
+// searchMaxTermRunes 查询中的 CJK 连续文本按不超过该长度的子串查找词项
+const searchMaxTermRunes = 8
+
+// searchPinyinBoost 拼音查询命中汉字词项时的得分倍数，使汉字内容排在字面命中的英文单词前面
+const searchPinyinBoost = 1.5
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// 索引的字段，编号即倒排列表中的字段编号
+const (
+	fieldTitle = iota
+	fieldTags
+	fieldDescription
+	fieldBody
+	searchFieldCount
+)
+
+// searchFields 字段名；searchBoosts 字段权重，标题命中比正文命中重要
+var (
+	searchFields = [searchFieldCount]string{"title", "tags", "description", "body"}
+	searchBoosts = [searchFieldCount]float64{3, 2, 1.5, 1}
+)
+
+// searchDoc 搜索索引中的一篇文档，编号即在索引中的下标，按日期从新到旧排列
+type searchDoc struct {
+	ID    int      `json:"id"`
+	Type  string   `json:"type"` // post 或 page
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Date  string   `json:"date"`
+	Tags  []string `json:"tags,omitempty"`
+
+	Lang       string `json:"lang,omitempty"`
+	Collection string `json:"collection"`
+
+	Lengths [searchFieldCount]int `json:"len"` // 各字段的词项数，用于 BM25 的长度归一化
+
+	excerpt string
+	text    [searchFieldCount]searchText // 各字段的原文，用于生成摘要片段
+	tagKeys []string                     // 转为简体和小写的标签，用于 tag: 条件
+}
+
+// searchSource 参与搜索的一篇文章或页面
+type searchSource struct {
+	Type        string // post 或 page
+	Collection  string // posts 或 pages
+	Path        string // 源文件路径，日期相同时按它排序
+	Title       string
+	URL         string
+	Date        time.Time
+	Tags        []string
+	Lang        string
+	Description string
+	Content     string // Markdown 源文本，HTML 为 true 时是 HTML 源文本
+	Excerpt     string
+	HTML        bool // .html 页面
+}
+
+// searchCollections 可以在 search_collections 中设置是否参与搜索的集合
+var searchCollections = []string{"posts", "pages"}
+
+// searchText 字段的原文，以及简体文本（索引中的位置所基于的文本）的字符偏移到原文字符偏移的映射
+type searchText struct {
+	runes  []rune
+	toOrig []int // 长度为简体字符数 + 1；繁简转换不改变字符数时为 nil，表示逐字对应
+}
+
+// origin 把简体文本中的字符偏移换算为原文中的字符偏移
+func (t searchText) origin(pos int) int {
+	if t.toOrig == nil {
+		return min(pos, len(t.runes))
+	}
+	return t.toOrig[min(pos, len(t.toOrig)-1)]
+}
+
+// posting 词项在一篇文档某个字段中的全部出现位置，位置为该字段简体文本中的字符偏移，词频即位置数
+type posting struct {
+	Doc       int
+	Field     int
+	Positions []int
+}
+
+// MarshalJSON 把 posting 编码为紧凑的 [文档编号, 字段编号, 位置...]
+func (p posting) MarshalJSON() ([]byte, error) {
+	return json.Marshal(append([]int{p.Doc, p.Field}, p.Positions...))
+}
+
+// searchIndex 文章的倒排索引：简体、小写的 Jieba 词项 -> 出现该词项的文档和字段，按文档编号排列
+type searchIndex struct {
+	Docs     []*searchDoc
+	Terms    map[string][]posting
+	Variants map[string]string   // 繁体字 -> 简体字，客户端用它转换查询
+	Synonyms synonymSet          // 查询时扩展的同义词
+	Pinyin   map[string][]string // 不带声调的全拼和首字母 -> 汉字词项，使拼音查询能命中中文
+
+	Suggestions []*searchSuggestion // 输入提示的候选，按 suggestionBefore 排列
+
+	avgLen [searchFieldCount]float64 // 各字段的平均长度
+
+	filesOnce sync.Once         // 静态索引文件只序列化一次，开发模式下各分片路由共用
+	fileData  map[string][]byte // files 的结果
+}
+
+// searchHit 一篇命中的文档及其 BM25 得分
+type searchHit struct {
+	Doc   *searchDoc
+	Score float64
+
+	matches []searchMatch // 命中的词项及其位置，用于高亮
+}
+
+// searchMatch 命中的一个词项在某个字段中的位置
+type searchMatch struct {
+	posting
+	Runes int // 词项的字符数
+}
+
+// searchToken 文本中的一个词项及其字符偏移
+type searchToken struct {
+	Term string
+	Pos  int
+}
+
+// buildSearchIndex 为文章和页面的标题、标签、描述和正文建立倒排索引；各字段先转为简体再用 Jieba 搜索模式分词
+func buildSearchIndex(conv *MarkdownConverter, sources []*searchSource, synonyms synonymSet) *searchIndex {
+	sorted := make([]*searchSource, len(sources))
+	copy(sorted, sources)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.After(sorted[j].Date)
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	idx := &searchIndex{Terms: make(map[string][]posting), Variants: make(map[string]string), Synonyms: synonyms}
+	var total [searchFieldCount]int
+	for i, p := range sorted {
+		doc := &searchDoc{
+			ID:    i,
+			Type:  p.Type,
+			Title: p.Title,
+			URL:   p.URL,
+			Date:  p.Date.Format("2006-01-02"),
+			Tags:  p.Tags,
+
+			Lang:       p.Lang,
+			Collection: p.Collection,
+			excerpt:    p.Excerpt,
+		}
+		if p.HTML {
+			doc.excerpt = htmlPlainText(p.Excerpt)
+		}
+		idx.Docs = append(idx.Docs, doc)
+
+		var fields [searchFieldCount]string
+		fields[fieldTitle] = p.Title
+		fields[fieldTags] = strings.Join(doc.Tags, "\n")
+		fields[fieldDescription] = p.Description
+		if p.HTML {
+			fields[fieldBody] = htmlPlainText(p.Content)
+		} else {
+			fields[fieldBody] = conv.plainText(p.Content)
+		}
+		for _, tag := range doc.Tags {
+			key, _ := simplifyAligned(tag)
+			doc.tagKeys = append(doc.tagKeys, strings.ToLower(key))
+		}
+		for field, original := range fields {
+			text, toOrig := simplifyAligned(original)
+			doc.text[field] = searchText{runes: []rune(original), toOrig: toOrig}
+			positions := make(map[string][]int)
+			var terms []string
+			for _, tok := range searchTokens(text) {
+				if _, seen := positions[tok.Term]; !seen {
+					terms = append(terms, tok.Term)
+				}
+				positions[tok.Term] = append(positions[tok.Term], tok.Pos)
+				doc.Lengths[field]++
+			}
+			for _, term := range terms {
+				idx.Terms[term] = append(idx.Terms[term], posting{Doc: i, Field: field, Positions: positions[term]})
+			}
+			total[field] += doc.Lengths[field]
+		}
+	}
+	for field, n := range total {
+		if len(idx.Docs) > 0 {
+			idx.avgLen[field] = float64(n) / float64(len(idx.Docs))
+		}
+	}
+	idx.collectVariants()
+	idx.collectPinyin()
+	idx.collectSuggestions()
+	return idx
+}
+
+// simplifyAligned 把文本转为简体，并返回简体字符偏移到原文字符偏移的映射。
+// 转换通常逐字进行，字符数不变时映射为 nil；个别词组转换改变了字符数时，按标点和空白分段转换，
+// 段内按比例对应，词组不会跨越分段
+func simplifyAligned(text string) (string, []int) {
+	simplified := analyzer.ToSimplified(text)
+	orig := []rune(text)
+	if utf8.RuneCountInString(simplified) == len(orig) {
+		return simplified, nil
+	}
+
+	var buf strings.Builder
+	toOrig := make([]int, 0, len(orig)+1)
+	for start := 0; start < len(orig); {
+		end := start
+		for end < len(orig) && isWordRune(orig[end]) {
+			end++
+		}
+		if end == start {
+			end++ // 标点或空白单独成段
+		}
+		segment := analyzer.ToSimplified(string(orig[start:end]))
+		n := utf8.RuneCountInString(segment)
+		for i := 0; i < n; i++ {
+			toOrig = append(toOrig, start+i*(end-start)/n)
+		}
+		buf.WriteString(segment)
+		start = end
+	}
+	return buf.String(), append(toOrig, len(orig))
+}
+
+// searchTokens 用 Jieba 搜索模式切分简体文本，返回小写词项和字符偏移；与原有规则一致，忽略单字和标点
+func searchTokens(text string) []searchToken {
+	// 字节偏移 -> 字符偏移
+	runeAt := make([]int, len(text)+1)
+	n := 0
+	for i := range text {
+		runeAt[i] = n
+		n++
+	}
+	runeAt[len(text)] = n
+	for i := len(text) - 1; i >= 0; i-- {
+		if !utf8.RuneStart(text[i]) {
+			runeAt[i] = runeAt[i+1]
+		}
+	}
+
+	var tokens []searchToken
+	for _, w := range analyzer.Tokenize(text) {
+		term := strings.ToLower(w.Str)
+		if utf8.RuneCountInString(term) < 2 || !strings.ContainsFunc(term, isWordRune) {
+			continue
+		}
+		tokens = append(tokens, searchToken{Term: term, Pos: runeAt[w.Start]})
+	}
+	return tokens
+}
+
+// isWordRune 判断字符是否属于词项：字母（包括汉字）或数字
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// collectVariants 为词项和同义词中的每个简体字记录对应的繁体字，使客户端不依赖 OpenCC 也能转换查询
+func (idx *searchIndex) collectVariants() {
+	words := make([]string, 0, len(idx.Terms)+len(idx.Synonyms))
+	for term := range idx.Terms {
+		words = append(words, term)
+	}
+	for word := range idx.Synonyms {
+		words = append(words, word)
+	}
+	seen := make(map[rune]bool)
+	for _, term := range words {
+		for _, r := range term {
+			if seen[r] || !unicode.Is(unicode.Han, r) {
+				continue
+			}
+			seen[r] = true
+			trad := analyzer.ToTraditional(string(r))
+			if utf8.RuneCountInString(trad) != 1 || trad == string(r) {
+				continue
+			}
+			idx.Variants[trad] = string(r)
+		}
+	}
+}
+
+// collectPinyin 为每个全部由汉字组成的词项记录不带声调的全拼（博客 -> boke）和首字母（bk），
+// 同一个拼音对应的词项按文本排序
+func (idx *searchIndex) collectPinyin() {
+	idx.Pinyin = make(map[string][]string)
+	add := func(key, term string) {
+		if !slices.Contains(idx.Pinyin[key], term) {
+			idx.Pinyin[key] = append(idx.Pinyin[key], term)
+		}
+	}
+	for term := range idx.Terms {
+		if strings.IndexFunc(term, func(r rune) bool { return !isHan(r) }) >= 0 {
+			continue
+		}
+		full := pinyinKey(term)
+		if full == term {
+			continue // 没有拼音的生僻字
+		}
+		add(full, term)
+		add(pinyinInitials(term), term)
+	}
+	for _, terms := range idx.Pinyin {
+		sort.Strings(terms)
+	}
+}
+
+// pinyinInitials 返回词中每个汉字拼音的首字母
+func pinyinInitials(term string) string {
+	args := pinyin.NewArgs()
+	var b strings.Builder
+	for _, r := range term {
+		if py := pinyin.SinglePinyin(r, args); len(py) > 0 && py[0] != "" {
+			b.WriteByte(py[0][0])
+		}
+	}
+	return b.String()
+}
+
+// pinyinTones 带声调的拼音字母对应的不带声调的字母，ü 与 go-pinyin 一致写作 v
+var pinyinTones = map[rune]rune{
+	'ā': 'a', 'á': 'a', 'ǎ': 'a', 'à': 'a',
+	'ē': 'e', 'é': 'e', 'ě': 'e', 'è': 'e',
+	'ī': 'i', 'í': 'i', 'ǐ': 'i', 'ì': 'i',
+	'ō': 'o', 'ó': 'o', 'ǒ': 'o', 'ò': 'o',
+	'ū': 'u', 'ú': 'u', 'ǔ': 'u', 'ù': 'u',
+	'ü': 'v', 'ǖ': 'v', 'ǘ': 'v', 'ǚ': 'v', 'ǜ': 'v',
+}
+
+// pinyinQueryKey 把查询中的单词转为不带声调的拼音键：去掉声调符号（bókè）和音节末尾的声调数字（bo2ke4）。
+// 单词含有其他字符，或者数字不在音节末尾（mp3）时不是拼音
+func pinyinQueryKey(word string) (string, bool) {
+	var b strings.Builder
+	var prev rune
+	for _, r := range word {
+		if plain, ok := pinyinTones[r]; ok {
+			r = plain
+		}
+		switch {
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+		case r >= '1' && r <= '5' && strings.ContainsRune("aeiouvngr", prev):
+		default:
+			return "", false
+		}
+		prev = r
+	}
+	if b.Len() < 2 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// queryRuns 把查询文本切分为连续的汉字和连续的字母数字，其余字符作为分隔
+func queryRuns(runes []rune, fn func(start, end int, han bool)) {
+	for i := 0; i < len(runes); {
+		j := i + 1
+		switch {
+		case unicode.Is(unicode.Han, runes[i]):
+			for j < len(runes) && unicode.Is(unicode.Han, runes[j]) {
+				j++
+			}
+			fn(i, j, true)
+		case isWordRune(runes[i]):
+			for j < len(runes) && isLatinWordRune(runes[j]) {
+				j++
+			}
+			fn(i, j, false)
+		}
+		i = j
+	}
+}
+
+// queryTerms 返回文本中出现在索引里的词项，用于评分，按首次出现的顺序去重。
+// 文本已转为简体和小写；字母数字按单词整体匹配，汉字取长度 2 到 searchMaxTermRunes 的全部子串。
+// 客户端查询引擎使用完全相同的规则，静态索引和 /api/search 的结果因此一致
+func (idx *searchIndex) queryTerms(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if !seen[term] && len(idx.Terms[term]) > 0 {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	runes := []rune(text)
+	queryRuns(runes, func(start, end int, han bool) {
+		if !han {
+			add(string(runes[start:end]))
+			return
+		}
+		for i := start; i < end; i++ {
+			for j := i + 2; j <= end && j-i <= searchMaxTermRunes; j++ {
+				add(string(runes[i:j]))
+			}
+		}
+	})
+	return terms
+}
+
+// querySegment 文本按索引词典切分出的一个词项及其字符偏移
+type querySegment struct {
+	Term string
+	Pos  int
+}
+
+// segment 用正向最大匹配把文本切分为索引中存在的词项，用于判断条件是否满足：
+// 字母数字按整个单词，汉字优先取最长的词项，不属于任何词项的字符被跳过
+func (idx *searchIndex) segment(text string) []querySegment {
+	var segs []querySegment
+	runes := []rune(text)
+	queryRuns(runes, func(start, end int, han bool) {
+		if !han {
+			if term := string(runes[start:end]); len(idx.Terms[term]) > 0 {
+				segs = append(segs, querySegment{term, start})
+			}
+			return
+		}
+		for i := start; i < end; {
+			j := min(end, i+searchMaxTermRunes)
+			for ; j >= i+2; j-- {
+				if len(idx.Terms[string(runes[i:j])]) > 0 {
+					break
+				}
+			}
+			if j < i+2 {
+				i++
+				continue
+			}
+			segs = append(segs, querySegment{string(runes[i:j]), i})
+			i = j
+		}
+	})
+	return segs
+}
+
+// postingsOf 返回词项在一篇文档中的倒排列表，每个出现的字段一条
+func (idx *searchIndex) postingsOf(term string, doc int) []posting {
+	postings := idx.Terms[term]
+	i := sort.Search(len(postings), func(i int) bool { return postings[i].Doc >= doc })
+	j := i
+	for j < len(postings) && postings[j].Doc == doc {
+		j++
+	}
+	return postings[i:j]
+}
+
+// hasPhrase 判断文档的某个字段中是否按查询中的间隔连续出现全部词项；field 为 -1 时检查所有字段
+func (idx *searchIndex) hasPhrase(doc int, segs []querySegment, field int) bool {
+	for _, first := range idx.postingsOf(segs[0].Term, doc) {
+		if field >= 0 && first.Field != field {
+			continue
+		}
+	next:
+		for _, pos := range first.Positions {
+			for _, seg := range segs[1:] {
+				want := pos + seg.Pos - segs[0].Pos
+				found := false
+				for _, p := range idx.postingsOf(seg.Term, doc) {
+					if p.Field == first.Field && slices.Contains(p.Positions, want) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue next
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// queryClause 查询中的一个条件
+type queryClause struct {
+	Field    string // 为空表示全文，否则为 title、tag、date、lang
+	Value    string // 已转为简体和小写
+	Phrase   bool   // 用引号括起的短语，要求词项连续出现
+	Negate   bool   // 以 - 开头的排除条件
+	From, To string // date: 的范围，为空表示不限
+	Pinyin   bool   // 由拼音查询扩展出的汉字词项条件
+
+	Start, End int // 值在转为简体的查询中的字符范围，用于生成纠错建议
+}
+
+// queryError 查询语法错误，Pos 为出错的字符偏移
+type queryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("查询语法错误（第 %d 个字符）: %s", e.Pos+1, e.Msg)
+}
+
+// queryFields 查询中可以使用的字段
+var queryFields = map[string]bool{"title": true, "tag": true, "date": true, "lang": true}
+
+// dateBoundRegex date: 范围的一端：年、年-月或年-月-日
+var dateBoundRegex = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// parseSearchQuery 解析查询，返回以 OR 连接的条件组，组内的条件需要同时满足。
+// 条件以空白分隔，可以是单词、"短语"、title:、tag:、date:、lang: 字段条件，前面加 - 表示排除；
+// date: 接受 2024、2024-03、2024..2025、..2023、2024-01.. 等写法
+func parseSearchQuery(query string) ([][]queryClause, error) {
+	runes := []rune(toSimplified(query))
+	var groups [][]queryClause
+	var group []queryClause
+	for i := 0; ; {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i >= len(runes) {
+			break
+		}
+		start := i
+		if i+2 <= len(runes) && string(runes[i:i+2]) == "OR" && (i+2 == len(runes) || unicode.IsSpace(runes[i+2])) {
+			if len(group) == 0 {
+				return nil, &queryError{start, "OR 前面缺少条件"}
+			}
+			groups, group = append(groups, group), nil
+			i += 2
+			continue
+		}
+
+		var c queryClause
+		if runes[i] == '-' {
+			c.Negate = true
+			i++
+			if i == len(runes) || unicode.IsSpace(runes[i]) {
+				return nil, &queryError{start, "- 后面缺少要排除的内容"}
+			}
+		}
+		if colon := slices.Index(runes[i:], ':'); colon > 0 && queryFields[strings.ToLower(string(runes[i:i+colon]))] {
+			c.Field = strings.ToLower(string(runes[i : i+colon]))
+			i += colon + 1
+			if i == len(runes) || unicode.IsSpace(runes[i]) {
+				return nil, &queryError{start, c.Field + ": 缺少值"}
+			}
+		}
+		if runes[i] == '"' {
+			end := slices.Index(runes[i+1:], '"')
+			if end < 0 {
+				return nil, &queryError{i, "引号没有闭合"}
+			}
+			c.Value, c.Phrase = string(runes[i+1:i+1+end]), true
+			c.Start, c.End = i+1, i+1+end
+			i += end + 2
+			if strings.TrimSpace(c.Value) == "" {
+				return nil, &queryError{start, "短语为空"}
+			}
+		} else {
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) {
+				j++
+			}
+			c.Value = string(runes[i:j])
+			c.Start, c.End = i, j
+			i = j
+		}
+		c.Value = strings.ToLower(strings.TrimSpace(c.Value))
+
+		if c.Field == "date" {
+			from, to, found := strings.Cut(c.Value, "..")
+			if !found {
+				to = from
+			}
+			if from == "" && to == "" || from != "" && !dateBoundRegex.MatchString(from) || to != "" && !dateBoundRegex.MatchString(to) {
+				return nil, &queryError{start, "date: 的格式应为 2024、2024-03 或 2024..2025"}
+			}
+			if from != "" && to != "" && from > to {
+				return nil, &queryError{start, "date: 的起始日期晚于结束日期"}
+			}
+			c.From, c.To = from, to
+		}
+		group = append(group, c)
+	}
+
+	if len(group) == 0 {
+		if len(groups) > 0 {
+			return nil, &queryError{len(runes), "OR 后面缺少条件"}
+		}
+		return nil, &queryError{0, "查询为空"}
+	}
+	return append(groups, group), nil
+}
+
+// expand 返回条件的同义词和拼音扩展：不带引号的单词条件与某个同义词完全相同时，换成组内每个词的条件；
+// 条件是拼音或拼音首字母时，再加上对应汉字词项的条件，这些条件的得分乘以 searchPinyinBoost
+func (idx *searchIndex) expand(c queryClause) []queryClause {
+	if c.Phrase || c.Field != "" && c.Field != "title" {
+		return []queryClause{c}
+	}
+	out := []queryClause{c}
+	if alts := idx.Synonyms[c.Value]; len(alts) > 0 {
+		out = out[:0]
+		for _, alt := range alts {
+			c := c
+			c.Value = alt
+			out = append(out, c)
+		}
+	}
+	if key, ok := pinyinQueryKey(c.Value); ok {
+		for _, term := range idx.Pinyin[key] {
+			c := c
+			c.Value, c.Pinyin = term, true
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// matchExpanded 返回满足条件或其任一同义词的文档编号
+func (idx *searchIndex) matchExpanded(c queryClause) map[int]bool {
+	docs := make(map[int]bool)
+	for _, alt := range idx.expand(c) {
+		for doc := range idx.matchClause(alt) {
+			docs[doc] = true
+		}
+	}
+	return docs
+}
+
+// matchClause 返回满足条件的文档编号
+func (idx *searchIndex) matchClause(c queryClause) map[int]bool {
+	docs := make(map[int]bool)
+	switch c.Field {
+	case "tag", "date", "lang":
+		for _, doc := range idx.Docs {
+			if doc.matchFilter(c) {
+				docs[doc.ID] = true
+			}
+		}
+		return docs
+	}
+
+	field := -1
+	if c.Field == "title" {
+		field = fieldTitle
+	}
+	segs := idx.segment(c.Value)
+	if len(segs) == 0 {
+		return docs
+	}
+	for i, seg := range segs {
+		found := make(map[int]bool)
+		for _, p := range idx.Terms[seg.Term] {
+			if (field < 0 || p.Field == field) && (i == 0 || docs[p.Doc]) {
+				found[p.Doc] = true
+			}
+		}
+		docs = found
+	}
+	if c.Phrase && len(segs) > 1 {
+		for doc := range docs {
+			if !idx.hasPhrase(doc, segs, field) {
+				delete(docs, doc)
+			}
+		}
+	}
+	return docs
+}
+
+// matchFilter 判断文档是否满足 tag:、date: 或 lang: 条件
+func (doc *searchDoc) matchFilter(c queryClause) bool {
+	switch c.Field {
+	case "tag":
+		return slices.Contains(doc.tagKeys, c.Value)
+	case "date":
+		return doc.Date >= c.From && (c.To == "" || doc.Date[:min(len(c.To), len(doc.Date))] <= c.To)
+	case "lang":
+		return strings.EqualFold(doc.Lang, c.Value)
 	}
+	return false
+}
 
-	// 设置日志级别
-	if *flagQuiet {
-		log.SetOutput(os.Stderr)
-	} else if *flagVerbose {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-	}
+// searchOptions /api/search 的排序方式和集合过滤
+type searchOptions struct {
+	Sort       string // relevance（默认）或 date
+	Collection string // 为空表示不限
+}
 
-	// 加载配置
-	cfg, err := Load(*flagConfig, *flagSource, *flagDestination)
+// search 返回满足查询的文档。每个条件组先按条件筛选文档，再用组内单词、短语和 title: 条件的词项计算 BM25 得分，
+// 文档满足多个组时得分相加；每个字段单独计算 BM25 后乘以字段权重。
+// 按得分从高到低排列（得分保留四位小数，客户端的浮点误差不会影响排序），得分相同或按日期排序时从新到旧
+func (idx *searchIndex) search(query string, opts searchOptions) ([]searchHit, error) {
+	groups, err := parseSearchQuery(query)
 	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
+		return nil, err
 	}
 
-	// 应用命令行参数到配置
-	cfg.Port = *flagPort
-	cfg.Host = *flagHost
-	if *flagBaseURL != "" {
-		cfg.BaseURL = *flagBaseURL
-	}
+	n := float64(len(idx.Docs))
+	hits := make(map[int]*searchHit)
+	for _, group := range groups {
+		// 筛选：满足全部肯定条件（没有肯定条件时为全部文档），且不满足任何排除条件
+		var docs map[int]bool
+		for _, c := range group {
+			if c.Negate {
+				continue
+			}
+			matched := idx.matchExpanded(c)
+			if docs != nil {
+				for doc := range docs {
+					if !matched[doc] {
+						delete(docs, doc)
+					}
+				}
+			} else {
+				docs = matched
+			}
+		}
+		if docs == nil {
+			docs = make(map[int]bool)
+			for _, doc := range idx.Docs {
+				docs[doc.ID] = true
+			}
+		}
+		for _, c := range group {
+			if c.Negate {
+				for doc := range idx.matchExpanded(c) {
+					delete(docs, doc)
+				}
+			}
+		}
+		if opts.Collection != "" {
+			for doc := range docs {
+				if idx.Docs[doc].Collection != opts.Collection {
+					delete(docs, doc)
+				}
+			}
+		}
 
-	// 处理新建文章
-	if *flagNewPost != "" {
-		err := createNewPost(*flagNewPost, cfg)
-		if err != nil {
-			log.Fatalf("新建文章失败: %v", err)
+		for doc := range docs {
+			if hits[doc] == nil {
+				hits[doc] = &searchHit{Doc: idx.Docs[doc]}
+			}
 		}
-		fmt.Printf("新建文章成功: %s\n", *flagNewPost)
-		return
-	}
 
-	// 处理新建页面
-	if *flagNewPage != "" {
-		err := createNewPage(*flagNewPage, cfg)
-		if err != nil {
-			log.Fatalf("新建页面失败: %v", err)
+		// 评分
+		seen := make(map[string]bool)
+		for _, c := range group {
+			if c.Negate || c.Field != "" && c.Field != "title" {
+				continue
+			}
+			for _, alt := range idx.expand(c) {
+				for _, term := range idx.queryTerms(alt.Value) {
+					if key := c.Field + ":" + term; !seen[key] {
+						seen[key] = true
+						idx.score(hits, docs, term, c.Field == "title", alt.Pinyin, n)
+					}
+				}
+			}
 		}
-		fmt.Printf("新建页面成功: %s\n", *flagNewPage)
-		return
 	}
 
-	// 处理项目结构修复
-	if *flagDoctor {
-		fixed, report := doctorCheck(cfg)
-		for _, r := range report {
-			fmt.Println(r)
+	results := make([]searchHit, 0, len(hits))
+	for _, hit := range hits {
+		hit.Score = math.Round(hit.Score*1e4) / 1e4
+		results = append(results, *hit)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if opts.Sort != "date" && results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
 		}
-		if fixed {
-			fmt.Println("\n项目结构已修复，请重新构建。")
-		} else {
-			fmt.Println("\n项目结构检查完成。")
+		return results[i].Doc.ID < results[j].Doc.ID
+	})
+	return results, nil
+}
+
+// score 把词项的 BM25 得分累加到 docs 中的文档上；titleOnly 为 true 时只计算标题字段，
+// fromPinyin 为 true 时得分乘以 searchPinyinBoost
+func (idx *searchIndex) score(hits map[int]*searchHit, docs map[int]bool, term string, titleOnly, fromPinyin bool, n float64) {
+	postings := idx.Terms[term]
+	df := 0
+	for i, p := range postings {
+		if i == 0 || postings[i-1].Doc != p.Doc {
+			df++
 		}
-		return
+	}
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	if fromPinyin {
+		idf *= searchPinyinBoost
 	}
 
-	// 处理Markdown格式测试
-	if *flagTestMarkdown {
-		testMarkdownRobustness(cfg)
-		return
+	for _, p := range postings {
+		if !docs[p.Doc] || titleOnly && p.Field != fieldTitle {
+			continue
+		}
+		hit := hits[p.Doc]
+		tf := float64(len(p.Positions))
+		norm := 1 - bm25B + bm25B*float64(hit.Doc.Lengths[p.Field])/idx.avgLen[p.Field]
+		hit.Score += searchBoosts[p.Field] * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		hit.matches = append(hit.matches, searchMatch{posting: p, Runes: utf8.RuneCountInString(term)})
 	}
+}
 
-	// 创建站点实例
-	site := New(cfg)
+// 片段边界：句子结束的标点，以及向外寻找标点的最大距离
+const (
+	snippetBreaks = "。！？；!?;\n"
+	snippetSlack  = 12
+)
 
-	// 处理监听模式
-	if *flagWatch {
-		fileWatcher, err := NewFileWatcher(site, cfg)
-		if err != nil {
-			log.Fatalf("创建文件监听器失败: %v", err)
+// highlightTitle 返回标题的 HTML，命中的词项用 <mark> 标出
+func (hit searchHit) highlightTitle() string {
+	text := hit.Doc.text[fieldTitle]
+	return markText(text.runes, 0, len(text.runes), hit.spans(fieldTitle))
+}
+
+// snippet 返回正文中命中词项最密集、约 length 个字符的片段的 HTML，命中处用 <mark> 标出，
+// 位置换算到原文，因此繁体原文中的词也能正确高亮。片段尽量从句子边界开始和结束，不截断英文单词；
+// 正文没有命中时返回正文开头
+func (hit searchHit) snippet(length int) string {
+	runes := hit.Doc.text[fieldBody].runes
+	if len(runes) <= length {
+		return markText(runes, 0, len(runes), hit.spans(fieldBody))
+	}
+	spans := hit.spans(fieldBody)
+
+	// 选择包含最多命中的窗口，命中相同时取靠前的
+	start, end := 0, length
+	if len(spans) > 0 {
+		best, bestCount := 0, 0
+		for i := range spans {
+			count := 1
+			for j := i + 1; j < len(spans) && spans[j][1]-spans[i][0] <= length; j++ {
+				count++
+			}
+			if count > bestCount {
+				best, bestCount = i, count
+			}
 		}
-		defer fileWatcher.Close()
+		last := spans[best+bestCount-1][1]
+		start = max(0, spans[best][0]-(length-(last-spans[best][0]))/2)
+		end = min(len(runes), start+length)
+		start = max(0, end-length)
+	}
 
-		if err := fileWatcher.Start(); err != nil {
-			log.Fatalf("监听失败: %v", err)
+	// 开头在附近寻找句子边界，找不到时不截断英文单词
+	first, lastEnd := end, start
+	for _, sp := range spans {
+		if sp[0] >= start && sp[1] <= end {
+			first, lastEnd = min(first, sp[0]), max(lastEnd, sp[1])
+		}
+	}
+	if start > 0 {
+		moved := false
+		for i := start; i > 0 && start-i <= snippetSlack; i-- {
+			if strings.ContainsRune(snippetBreaks, runes[i-1]) {
+				start, moved = i, true
+				break
+			}
+		}
+		for i := start; !moved && i < first && i-start < snippetSlack; i++ {
+			if strings.ContainsRune(snippetBreaks, runes[i]) {
+				start, moved = i+1, true
+			}
+		}
+		for !moved && start < first && isLatinWordRune(runes[start-1]) && isLatinWordRune(runes[start]) {
+			start++
+		}
+		// 不以标点开头
+		for start < first && !isWordRune(runes[start]) {
+			start++
+		}
+	}
+	// 结尾向后寻找句子结束的标点
+	if end < len(runes) {
+		moved := false
+		for i := end; i < len(runes) && i-end < snippetSlack; i++ {
+			if strings.ContainsRune(snippetBreaks, runes[i]) {
+				end, moved = i+1, true
+				break
+			}
+		}
+		for !moved && end > lastEnd && isLatinWordRune(runes[end-1]) && isLatinWordRune(runes[end]) {
+			end--
 		}
-		return
 	}
 
-	// 处理服务器模式
-	if *flagServe {
-		if err := site.Serve(cfg.Host, cfg.Port); err != nil {
-			log.Fatalf("服务器启动失败: %v", err)
+	html := markText(runes, start, end, spans)
+	if start > 0 {
+		html = "…" + html
+	}
+	if end < len(runes) {
+		html += "…"
+	}
+	return html
+}
+
+// spans 返回字段中命中词项在原文中的字符区间，按起点排序，重叠的区间已合并
+func (hit searchHit) spans(field int) [][2]int {
+	text := hit.Doc.text[field]
+	var spans [][2]int
+	for _, m := range hit.matches {
+		if m.Field != field {
+			continue
+		}
+		for _, pos := range m.Positions {
+			spans = append(spans, [2]int{text.origin(pos), text.origin(pos + m.Runes)})
 		}
-		return
 	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
 
-	// 默认构建模式
-	// 构建前先 doctor 检查
-	fixed, report := doctorCheck(cfg)
-	for _, r := range report {
-		fmt.Println(r)
+	merged := spans[:0]
+	for _, sp := range spans {
+		if n := len(merged); n > 0 && sp[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], sp[1])
+			continue
+		}
+		merged = append(merged, sp)
 	}
-	if fixed {
-		fmt.Println("\n项目结构已修复，请重新构建。")
-		return
+	return merged
+}
+
+// markText 转义 runes[start:end] 并用 <mark> 标出其中的区间，连续的空白合并为一个空格
+func markText(runes []rune, start, end int, spans [][2]int) string {
+	var buf strings.Builder
+	marked, space := false, false
+	next := 0
+	for i := start; i < end; i++ {
+		if unicode.IsSpace(runes[i]) {
+			space = buf.Len() > 0
+			continue
+		}
+		for next < len(spans) && spans[next][1] <= i {
+			next++
+		}
+		inSpan := next < len(spans) && spans[next][0] <= i
+		if marked && !inSpan {
+			buf.WriteString("</mark>")
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		if inSpan && !marked {
+			buf.WriteString("<mark>")
+		}
+		marked = inSpan
+		buf.WriteString(template.HTMLEscapeString(string(runes[i])))
 	}
-	// 检查通过才继续构建
-	if err := site.Build(); err != nil {
-		log.Fatalf("构建失败: %v", err)
+	if marked {
+		buf.WriteString("</mark>")
 	}
-	fmt.Println("构建完成！")
+	return buf.String()
 }
 
-// showHelp 显示帮助信息
-func showHelp() {
-	fmt.Println(`Jekyll-like Static Site Generator
+// isLatinWordRune 判断字符是否属于英文等以空格分词的单词
+func isLatinWordRune(r rune) bool {
+	return isWordRune(r) && !isHan(r)
+}
 
-用法:
-  main [命令] [选项]
+// isHan 判断字符是否为汉字
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
 
-命令:
-  build             构建站点 (默认)
-  serve             启动本地服务器
-  watch             监听文件变化自动重建
-  new_post          新建文章
-  new_page          新建页面
-  doctor            自动修复项目结构
-  test-markdown     测试Markdown格式健壮性
+// 输入提示和纠错建议的数量
+const (
+	searchSuggestLimit  = 10
+	searchMaxDidYouMean = 3
+)
 
-选项:
-  --config PATH     配置文件路径 (默认: _config.yml)
-  --source PATH     源目录路径 (默认: .)
-  --destination PATH 输出目录路径 (默认: _site)
-  --port PORT       服务器端口 (默认: 4000)
-  --host HOST       服务器主机 (默认: 127.0.0.1)
-  --baseurl URL     站点基础URL
-  --draft           构建草稿文章
-  --future          构建未来日期的文章
-  --limit N         限制构建的文章数量
-  --safe            安全模式（禁用插件）
-  --verbose         详细输出
-  --quiet           静默模式
-  --help            显示帮助信息
-  --version         显示版本信息
+// searchSuggestion 输入提示的一个候选：索引中的词项、文档标题或标签。
+// Key 为转为简体和小写、只保留字母数字的文本，Pinyin 为 Key 的拼音，用于匹配不含汉字的输入
+type searchSuggestion struct {
+	Text   string
+	Type   string // term、title 或 tag
+	Count  int    // 包含它的文档数
+	Key    string
+	Pinyin string
+}
 
-示例:
-  main                    # 构建站点
-  main serve              # 启动服务器
-  main serve --port 8080  # 在端口8080启动服务器
-  main watch              # 监听文件变化
-  main new_post "我的文章"  # 新建文章
-  main new_page "关于"     # 新建页面
-  main doctor             # 修复项目结构
+// MarshalJSON 把候选编码为紧凑的 [文本, 类型, 文档数, 键, 拼音]，拼音与键相同时省略
+func (s *searchSuggestion) MarshalJSON() ([]byte, error) {
+	if s.Pinyin == s.Key {
+		return json.Marshal([]any{s.Text, s.Type, s.Count, s.Key})
+	}
+	return json.Marshal([]any{s.Text, s.Type, s.Count, s.Key, s.Pinyin})
+}
 
-更多信息请访问: https://github.com/your-repo/jekyll-go`)
+// suggestionTypes 文档数相同时候选的先后：标题、标签、词项
+var suggestionTypes = map[string]int{"title": 0, "tag": 1, "term": 2}
+
+// suggestionBefore 候选的顺序：文档数从多到少，其次按类型、键和文本
+func suggestionBefore(a, b *searchSuggestion) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	if a.Type != b.Type {
+		return suggestionTypes[a.Type] < suggestionTypes[b.Type]
+	}
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.Text < b.Text
 }
 
-// showVersion 显示版本信息
-func showVersion() {
-	fmt.Println("Jekyll-like Static Site Generator v1.0.0")
-	fmt.Println("Go version: go1.21+")
-	fmt.Println("License: MIT")
+// collectSuggestions 收集全部词项、标题和标签作为输入提示的候选；标题和标签相同的文档合并计数，显示最新文档中的写法
+func (idx *searchIndex) collectSuggestions() {
+	byKey := make(map[string]*searchSuggestion)
+	add := func(typ, text, key string) {
+		if key == "" {
+			return
+		}
+		if s := byKey[typ+":"+key]; s != nil {
+			s.Count++
+			return
+		}
+		s := &searchSuggestion{Text: text, Type: typ, Count: 1, Key: key, Pinyin: pinyinKey(key)}
+		byKey[typ+":"+key] = s
+		idx.Suggestions = append(idx.Suggestions, s)
+	}
+	for _, doc := range idx.Docs {
+		title := analyzer.ToSimplified(doc.Title)
+		add("title", doc.Title, compactKey(title))
+		seen := make(map[string]bool)
+		for i, tag := range doc.Tags {
+			if key := compactKey(doc.tagKeys[i]); !seen[key] {
+				seen[key] = true
+				add("tag", tag, key)
+			}
+		}
+	}
+	for term, postings := range idx.Terms {
+		s := &searchSuggestion{Text: term, Type: "term", Key: compactKey(term), Pinyin: pinyinKey(term)}
+		for i, p := range postings {
+			if i == 0 || postings[i-1].Doc != p.Doc {
+				s.Count++
+			}
+		}
+		if s.Key != "" {
+			idx.Suggestions = append(idx.Suggestions, s)
+		}
+	}
+	sort.Slice(idx.Suggestions, func(i, j int) bool {
+		return suggestionBefore(idx.Suggestions[i], idx.Suggestions[j])
+	})
 }
 
-// testMarkdownRobustness 测试Markdown格式的健壮性
-func testMarkdownRobustness(cfg *Config) {
-	fmt.Println("=== 测试Markdown格式健壮性 ===")
+// compactKey 只保留字母数字并转为小写，输入 "Deploy g" 可以匹配标题 Deploy guide
+func compactKey(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if isWordRune(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
 
-	// 测试用例
-	testCases := []struct {
-		name    string
-		content string
-		expect  bool
-	}{
-		{
-			name: "正常Markdown",
-			content: `---
-title: "测试文章"
-date: 2024-01-01
-layout: post
----
+// pinyinKey 把 compactKey 得到的文本中的汉字转为不带声调的拼音（多音字取最常用的读音），其余字符不变
+func pinyinKey(key string) string {
+	args := pinyin.NewArgs()
+	var b strings.Builder
+	for _, r := range key {
+		if py := pinyin.SinglePinyin(r, args); unicode.Is(unicode.Han, r) && len(py) > 0 {
+			b.WriteString(py[0])
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
 
-# 标题1
+// suggest 返回以输入开头的候选，最多 limit 个，键相同的候选只取第一个。
+// 输入含有汉字时匹配简体文本，否则匹配拼音（字母数字的拼音就是自身），输入 bo ke 可以得到 博客
+func (idx *searchIndex) suggest(query string, limit int) []*searchSuggestion {
+	prefix := compactKey(toSimplified(query))
+	if prefix == "" {
+		return nil
+	}
+	han := strings.ContainsFunc(prefix, isHan)
+	var out []*searchSuggestion
+	seen := make(map[string]bool)
+	for _, s := range idx.Suggestions {
+		key := s.Pinyin
+		if han {
+			key = s.Key
+		}
+		if strings.HasPrefix(key, prefix) && !seen[s.Key] {
+			seen[s.Key] = true
+			if out = append(out, s); len(out) == limit {
+				break
+			}
+		}
+	}
+	return out
+}
 
-这是一段正常的内容。
+// didYouMean 查询没有结果时给出改写建议。只由单词组成、连起来恰好是某个词项拼音的查询（bo ke）先建议该词项；
+// 然后把全文和 title: 条件中不能完全切分为索引词项的词换成编辑距离最近的词项，第 k 个建议使用每个词的第 k 个候选
+func (idx *searchIndex) didYouMean(query string) []string {
+	groups, err := parseSearchQuery(query)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	if key, ok := pinyinQuery(groups); ok {
+		for _, s := range idx.Suggestions {
+			if s.Type == "term" && s.Pinyin == key && s.Key != key {
+				out = append(out, s.Text)
+				break
+			}
+		}
+	}
+
+	runes := []rune(toSimplified(query))
+	type fix struct {
+		start, end int
+		terms      []string
+	}
+	var fixes []fix
+	for _, group := range groups {
+		for _, c := range group {
+			if c.Field != "" && c.Field != "title" {
+				continue
+			}
+			queryRuns(runes[c.Start:c.End], func(start, end int, han bool) {
+				word := strings.ToLower(string(runes[c.Start+start : c.Start+end]))
+				if end-start < 2 || idx.covers(word) {
+					return
+				}
+				if terms := idx.closestTerms(word, han); len(terms) > 0 {
+					fixes = append(fixes, fix{c.Start + start, c.Start + end, terms})
+				}
+			})
+		}
+	}
+
+	for k := 0; len(out) < searchMaxDidYouMean && k < searchMaxDidYouMean && len(fixes) > 0; k++ {
+		var b strings.Builder
+		pos := 0
+		for _, f := range fixes {
+			b.WriteString(string(runes[pos:f.start]))
+			b.WriteString(f.terms[min(k, len(f.terms)-1)])
+			pos = f.end
+		}
+		b.WriteString(string(runes[pos:]))
+		if alt := b.String(); !slices.Contains(out, alt) {
+			out = append(out, alt)
+		}
+	}
+	return out
+}
+
+// pinyinQuery 查询只有一组不带字段、引号和排除的条件，且不含汉字时，返回各条件连起来的 compactKey
+func pinyinQuery(groups [][]queryClause) (string, bool) {
+	if len(groups) != 1 {
+		return "", false
+	}
+	var b strings.Builder
+	for _, c := range groups[0] {
+		if c.Field != "" || c.Negate || c.Phrase {
+			return "", false
+		}
+		b.WriteString(compactKey(c.Value))
+	}
+	key := b.String()
+	return key, key != "" && !strings.ContainsFunc(key, isHan)
+}
 
-## 标题2
+// covers 判断词能否完全切分为索引中的词项
+func (idx *searchIndex) covers(word string) bool {
+	n := 0
+	for _, seg := range idx.segment(word) {
+		n += utf8.RuneCountInString(seg.Term)
+	}
+	return n == utf8.RuneCountInString(word)
+}
 
-- 列表项1
-- 列表项2
+// closestTerms 返回与词编辑距离最近的词项，最多 searchMaxDidYouMean 个，距离相同时按候选顺序（文档数从多到少）。
+// 汉字词和四个字符以内的词最多相差一个字符，更长的词最多相差两个
+func (idx *searchIndex) closestTerms(word string, han bool) []string {
+	w := []rune(word)
+	limit := 1
+	if !han && len(w) > 4 {
+		limit = 2
+	}
+	type candidate struct {
+		term string
+		dist int
+	}
+	var found []candidate
+	for _, s := range idx.Suggestions {
+		if s.Type != "term" {
+			continue
+		}
+		t := []rune(s.Text)
+		if d := len(t) - len(w); d > limit || -d > limit {
+			continue
+		}
+		if d := editDistance(w, t); d <= limit {
+			found = append(found, candidate{s.Text, d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	var terms []string
+	for _, c := range found[:min(len(found), searchMaxDidYouMean)] {
+		terms = append(terms, c.term)
+	}
+	return terms
+}
 
-` + "```go\nfunc main() {\n    fmt.Println(\"Hello, World!\")\n}\n```" + `
-`,
-			expect: true,
-		},
-		{
-			name: "缺少前置数据",
-			content: `# 标题
+// editDistance 返回两个字符序列的 Levenshtein 距离
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
 
-这是没有前置数据的内容。
+// searchShardCount 返回静态索引的分片数，只取决于文档数，开发模式在索引建立前就能确定路由
+func searchShardCount(docs int) int {
+	if docs <= searchShardDocs {
+		return 1
+	}
+	return (docs + searchShardDocs - 1) / searchShardDocs
+}
 
-- 列表项
-`,
-			expect: true,
-		},
-		{
-			name: "格式错误的标题",
-			content: `---
-title: "测试"
----
+// searchShard 返回词项所在的分片：UTF-8 字节的 FNV-1a 哈希对分片数取模
+func searchShard(term string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(term))
+	return int(h.Sum32() % uint32(shards))
+}
 
-#标题1
-##标题2
+// files 返回静态索引文件：search.json 包含文档和繁简对照，只有一个分片时也直接包含词项；
+// 否则词项按 searchShard 写入 search-<n>.json。输入提示的候选单独写入 search-suggest.json，输入时才加载；
+// 索引建成后不再修改，结果在第一次调用时缓存
+func (idx *searchIndex) files() map[string][]byte {
+	idx.filesOnce.Do(func() { idx.fileData = idx.marshalFiles() })
+	return idx.fileData
+}
 
-正常内容
-`,
-			expect: false,
-		},
-		{
-			name: "格式错误的列表",
-			content: `---
-title: "测试"
----
+// marshalFiles 序列化静态索引文件
+func (idx *searchIndex) marshalFiles() map[string][]byte {
+	shards := searchShardCount(len(idx.Docs))
+	manifest := struct {
+		Version     int                       `json:"version"`
+		Shards      int                       `json:"shards"`
+		MaxTerm     int                       `json:"max_term"`
+		Fields      [searchFieldCount]string  `json:"fields"`
+		Boosts      [searchFieldCount]float64 `json:"boosts"`
+		K1          float64                   `json:"k1"`
+		B           float64                   `json:"b"`
+		PinyinBoost float64                   `json:"pinyin_boost"`
+		Docs        []*searchDoc              `json:"docs"`
+		Variants    map[string]string         `json:"variants"`
+		Synonyms    synonymSet                `json:"synonyms,omitempty"`
+		searchShardData
+	}{searchIndexVersion, shards, searchMaxTermRunes, searchFields, searchBoosts, bm25K1, bm25B, searchPinyinBoost, idx.Docs, idx.Variants, idx.Synonyms, searchShardData{}}
+	if manifest.Docs == nil {
+		manifest.Docs = []*searchDoc{}
+	}
+
+	files := make(map[string][]byte)
+	if shards == 1 {
+		manifest.Terms, manifest.Pinyin = idx.Terms, idx.Pinyin
+	} else {
+		parts := make([]searchShardData, shards)
+		for i := range parts {
+			parts[i] = searchShardData{Terms: make(map[string][]posting), Pinyin: make(map[string][]string)}
+		}
+		for term, postings := range idx.Terms {
+			parts[searchShard(term, shards)].Terms[term] = postings
+		}
+		for key, terms := range idx.Pinyin {
+			parts[searchShard(key, shards)].Pinyin[key] = terms
+		}
+		for i, part := range parts {
+			data, _ := json.Marshal(part)
+			files[searchShardName(i)] = data
+		}
+	}
+	files["search.json"], _ = json.Marshal(manifest)
+	files["search-suggest.json"], _ = json.Marshal(struct {
+		Version     int                 `json:"version"`
+		Suggestions []*searchSuggestion `json:"suggestions"`
+	}{searchIndexVersion, idx.Suggestions})
+	return files
+}
 
--列表项1
-*列表项2
-+列表项3
-`,
-			expect: false,
-		},
-		{
-			name: "未闭合的代码块",
-			content: `---
-title: "测试"
----
+// searchShardData 一个分片中的词项和拼音；只有一个分片时直接写在 search.json 中
+type searchShardData struct {
+	Terms  map[string][]posting `json:"terms,omitempty"`
+	Pinyin map[string][]string  `json:"pinyin,omitempty"`
+}
 
-` + "```go\nfunc main() {\n    fmt.Println(\"Hello\")\n// 缺少结束标记" + `
-`,
-			expect: false,
-		},
-		{
-			name:    "空内容",
-			content: "",
-			expect:  false,
-		},
-		{
-			name:    "只有空白字符",
-			content: "   \n\t\n  ",
-			expect:  false,
-		},
-		{
-			name: "YAML格式错误",
-			content: `---
-title: "测试"
-date: 2024-01-01
-layout: post
-invalid: yaml: format
----
+// searchShardName 返回第 i 个分片的文件名
+func searchShardName(i int) string {
+	return fmt.Sprintf("search-%d.json", i)
+}
 
-正常内容
-`,
-			expect: true, // YAML错误应该被捕获但不导致崩溃
-		},
+// searchIndex 返回快照的搜索索引；开发模式下后台索引尚未完成时在此同步构建
+func (s *Site) searchIndex() *searchIndex {
+	if s.index != nil {
+		return s.index.search
 	}
+	s.searchOnce.Do(func() { s.pendingSearch = buildSearchIndex(s.Converter, s.searchSources(), s.synonyms) })
+	return s.pendingSearch
+}
 
-	// 验证Markdown格式
-	for i, testCase := range testCases {
-		valid, errors := ValidateMarkdown(testCase.content)
+// searchSources 返回参与搜索的文章和页面（Markdown 和 HTML，不包括 404 页面）；search_collections 中关闭的集合整体跳过，
+// 前置数据 search: false 的文档单独跳过
+func (s *Site) searchSources() []*searchSource {
+	excluded := func(fm map[string]interface{}) bool {
+		v, ok := fm["search"].(bool)
+		return ok && !v
+	}
+	var sources []*searchSource
+	if s.Config.Searchable("posts") {
+		for _, p := range s.Posts {
+			if excluded(p.FrontMatter) {
+				continue
+			}
+			sources = append(sources, &searchSource{
+				Type: "post", Collection: "posts", Path: p.Path,
+				Title: p.Title, URL: p.extractRelativeURL(), Date: p.Date,
+				Tags: frontMatterStrings(p.FrontMatter, "tags"), Lang: p.Lang,
+				Description: p.Description, Content: p.Content, Excerpt: p.Excerpt,
+			})
+		}
+	}
+	if s.Config.Searchable("pages") {
+		for _, p := range s.Pages {
+			rel, _ := filepath.Rel(s.Config.Source, p.Path)
+			if excluded(p.FrontMatter) || s.Config.isNotFoundPage(rel) {
+				continue
+			}
+			sources = append(sources, &searchSource{
+				Type: "page", Collection: "pages", Path: p.Path,
+				Title: p.Title, URL: "/" + p.URL, Date: p.Date,
+				Tags: frontMatterStrings(p.FrontMatter, "tags"), Lang: p.Lang,
+				Description: p.Description, Content: p.Content, Excerpt: p.Excerpt, HTML: p.isHTML(),
+			})
+		}
+	}
+	return sources
+}
 
-		fmt.Printf("测试 %d (%s): ", i+1, testCase.name)
-		if valid == testCase.expect {
-			fmt.Printf("✓ 通过")
-		} else {
-			fmt.Printf("✗ 失败")
+// searchRoutes 返回静态搜索索引的路由
+func (s *Site) searchRoutes() []siteRoute {
+	file := func(name string) func() (string, error) {
+		return func() (string, error) { return string(s.searchIndex().files()[name]), nil }
+	}
+	routes := []siteRoute{
+		{Path: "/search.json", Render: file("search.json")},
+		{Path: "/search-suggest.json", Render: file("search-suggest.json")},
+	}
+	if shards := searchShardCount(len(s.searchSources())); shards > 1 {
+		for i := 0; i < shards; i++ {
+			routes = append(routes, siteRoute{Path: "/" + searchShardName(i), Render: file(searchShardName(i))})
 		}
+	}
+	return routes
+}
 
-		if !valid && len(errors) > 0 {
-			fmt.Printf(" (错误: %s)", strings.Join(errors, ", "))
+// generateSearchIndex 写入静态搜索索引，部署到静态托管时搜索页面不依赖 /api/search
+func (s *Site) generateSearchIndex() error {
+	files := s.searchIndex().files()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.writeFile(filepath.Join(s.Config.Destination, name), files[name]); err != nil {
+			return fmt.Errorf("写入搜索索引失败: %w", err)
 		}
-		fmt.Println()
 	}
+	log.Printf("生成搜索索引: %d 篇文档, %d 个词项, %d 个文件", len(s.searchIndex().Docs), len(s.searchIndex().Terms), len(files))
+	return nil
+}
 
-	// 测试Markdown转换
-	fmt.Println("\n=== 测试Markdown转换 ===")
-	converter := NewConverter(cfg)
+// frontMatterStrings 读取前置数据中的字符串列表，兼容 YAML 列表和以空格分隔的字符串
+func frontMatterStrings(fm map[string]interface{}, key string) []string {
+	switch v := fm[key].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if item != nil {
+				list = append(list, fmt.Sprint(item))
+			}
+		}
+		return list
+	}
+	return nil
+}
 
-	for i, testCase := range testCases {
-		fmt.Printf("转换测试 %d (%s): ", i+1, testCase.name)
+// siteIndex 标签云和搜索树；页面和文章都未变化时可以在快照之间复用
+type siteIndex struct {
+	tags    map[string][]string // 语言代码 -> Jieba 标签云
+	urlTree *URLTree
+	search  *searchIndex // 全部语言文章的搜索索引
+}
 
-		html, err := converter.Convert(testCase.content)
-		if err != nil {
-			fmt.Printf("✗ 转换失败 - %v\n", err)
-		} else {
-			fmt.Printf("✓ 转换成功 (长度: %d)\n", len(html))
+// buildIndex 为每种语言构建标签云，并为全部文章构建URL二叉树和搜索索引；只读取文章，可在后台执行
+func (s *Site) buildIndex() *siteIndex {
+	idx := &siteIndex{tags: make(map[string][]string), urlTree: NewURLTree()}
+	if s.Config.IsMultilingual() {
+		for _, code := range s.Config.LanguageCodes() {
+			var posts []*Post
+			for _, p := range s.Posts {
+				if p.Lang == code {
+					posts = append(posts, p)
+				}
+			}
+			idx.tags[code] = jiebaTags(posts)
 		}
+	} else {
+		idx.tags[s.Lang] = jiebaTags(s.Posts)
 	}
+	idx.urlTree.insertPosts(s.Posts)
+	idx.search = buildSearchIndex(s.Converter, s.searchSources(), s.synonyms)
+	return idx
+}
 
-	fmt.Println("\n=== Markdown健壮性测试完成 ===")
+// applyIndex 使用索引中当前语言的标签云和共享的URL二叉树
+func (s *Site) applyIndex(idx *siteIndex) {
+	s.index = idx
+	s.JiebaTags = idx.tags[s.Lang]
+	if m := s.mirror; m != nil {
+		// 镜像使用被镜像语言的标签云，转换字形
+		s.JiebaTags = nil
+		for _, tag := range idx.tags[m.SourceLang] {
+			s.JiebaTags = append(s.JiebaTags, m.convert(tag))
+		}
+	}
+	s.URLTree = idx.urlTree
 }
 
-func (s *Site) buildJiebaTags() {
-	x := gojieba.NewJieba()
-	defer x.Free()
+// jiebaTags 统计文章标题中出现最多的词作为标签云
+func jiebaTags(posts []*Post) []string {
 	freq := map[string]int{}
-	for _, post := range s.Posts {
-		words := x.CutForSearch(post.Title, true)
+	for _, post := range posts {
+		words := analyzer.CutForSearch(post.normalizedTitle())
 		for _, w := range words {
 			if len([]rune(w)) < 2 {
 				continue
@@ -2929,69 +8363,82 @@ func (s *Site) buildJiebaTags() {
 	for k, v := range freq {
 		arr = append(arr, kv{k, v})
 	}
-	sort.Slice(arr, func(i, j int) bool { return arr[i].V > arr[j].V })
-	s.JiebaTags = nil
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].V != arr[j].V {
+			return arr[i].V > arr[j].V
+		}
+		return arr[i].K < arr[j].K
+	})
+	var tags []string
 	for i, kv := range arr {
 		if i >= 20 {
 			break
 		}
-		s.JiebaTags = append(s.JiebaTags, kv.K)
+		tags = append(tags, kv.K)
 	}
-	if len(s.JiebaTags) == 0 {
-		s.JiebaTags = append(s.JiebaTags, "无标签")
+	if len(tags) == 0 {
+		tags = append(tags, "无标签")
 	}
+	return tags
 }
 
+// buildRouteTree 构建路由树：每个输出的 URL 路径（包括文章的归档副本）映射到规范路径。
+// 开发模式下同时为每个规范路径建立按需渲染的路由
 func (s *Site) buildRouteTree() {
 	s.RouteTree = treemap.NewWith(utils.StringComparator)
-	for _, post := range s.Posts {
-		relativeURL := post.extractRelativeURL()
-		s.RouteTree.Put(relativeURL, relativeURL)
-		archivePath := fmt.Sprintf("/archives/%04d/%02d/%02d/%s", post.Date.Year(), post.Date.Month(), post.Date.Day(), filepath.Base(relativeURL))
-		s.RouteTree.Put(archivePath, relativeURL)
-		// 已移除分类和标签路径，使用jieba分词作为智能分类
+	if s.memory {
+		s.routes = make(map[string]*devRoute)
+	}
+	for _, r := range s.outputRoutes() {
+		s.RouteTree.Put(r.Path, r.Path)
+		for _, alias := range r.Aliases {
+			s.RouteTree.Put(alias, r.Path)
+		}
+		if s.routes != nil {
+			s.routes[r.Path] = &devRoute{render: r.Render}
+		}
 	}
 }
 
-// buildURLTree 构建URL二叉树
-func (s *Site) buildURLTree() {
-	// 标题分词插入
-	x := gojieba.NewJieba()
-	defer x.Free()
-	for _, post := range s.Posts {
+// insertPosts 把文章的URL和归档路径插入URL二叉树
+func (t *URLTree) insertPosts(posts []*Post) {
+	for _, post := range posts {
 		relativeURL := post.extractRelativeURL()
-		s.URLTree.Insert(relativeURL, post)
+		t.Insert(relativeURL, post)
 
 		// 也插入归档路径
 		archivePath := fmt.Sprintf("/archives/%04d/%02d/%02d/%s", post.Date.Year(), post.Date.Month(), post.Date.Day(), filepath.Base(relativeURL))
-		s.URLTree.Insert(archivePath, post)
-
-		// 新增：整篇文章分词全部插入二元树（先转简体）
-		title := toSimplified(post.Title)
-		excerpt := toSimplified(post.Excerpt)
-		titleWords := x.CutForSearch(title, true)
-		contentWords := x.CutForSearch(excerpt, true)
-		allWords := append(titleWords, contentWords...)
-		for _, word := range allWords {
-			word = toSimplified(word)
-			if len([]rune(word)) < 2 {
-				continue
-			}
-			path := "/content/" + word
-			s.URLTree.Insert(path, post)
-		}
+		t.Insert(archivePath, post)
 	}
 
-	log.Printf("URL二叉树构建完成，包含 %d 个文章节点", len(s.Posts))
+	log.Printf("URL二叉树构建完成，包含 %d 个文章节点", len(posts))
 }
 
 // generateRSSFeed 生成 RSS Feed
 func (s *Site) generateRSSFeed() error {
+	content, err := s.renderFeed()
+	if err != nil {
+		return err
+	}
+	s.RSSFeed = content
+
+	// 写入 RSS 文件
+	rssPath := s.outputPath("feed.xml")
+	if err := s.writeFile(rssPath, []byte(s.RSSFeed)); err != nil {
+		return fmt.Errorf("写入RSS文件失败: %w", err)
+	}
+
+	log.Printf("生成RSS Feed: %s", rssPath)
+	return nil
+}
+
+// renderFeed 渲染 RSS Feed 的内容
+func (s *Site) renderFeed() (string, error) {
 	// 按日期排序文章（最新的在前）
 	sortedPosts := make([]*Post, len(s.Posts))
 	copy(sortedPosts, s.Posts)
 	sort.Slice(sortedPosts, func(i, j int) bool {
-		return sortedPosts[i].Date.After(sortedPosts[j].Date)
+		return postBefore(sortedPosts[i], sortedPosts[j])
 	})
 
 	// 只取最新的20篇文章
@@ -3005,14 +8452,14 @@ func (s *Site) generateRSSFeed() error {
     <title>{{ .Title }}</title>
     <link>{{ .URL }}</link>
     <description>{{ .Description }}</description>
-    <language>zh-CN</language>
+    <language>{{ .Language }}</language>
     <lastBuildDate>{{ .LastBuildDate }}</lastBuildDate>
     <atom:link href="{{ .URL }}/feed.xml" rel="self" type="application/rss+xml" />
     {{ range .Posts }}
     <item>
       <title>{{ .Title }}</title>
-      <link>{{ $.URL }}/{{ .URL }}</link>
-      <guid>{{ $.URL }}/{{ .URL }}</guid>
+      <link>{{ .URL }}</link>
+      <guid>{{ .URL }}</guid>
       <pubDate>{{ .Date.Format "Mon, 02 Jan 2006 15:04:05 -0700" }}</pubDate>
       <description><![CDATA[{{ .Excerpt }}]]></description>
     </item>
@@ -3025,6 +8472,7 @@ func (s *Site) generateRSSFeed() error {
 		"Title":         s.Config.Title,
 		"URL":           s.Config.URL,
 		"Description":   s.Config.Description,
+		"Language":      s.Lang,
 		"LastBuildDate": time.Now().Format("Mon, 02 Jan 2006 15:04:05 -0700"),
 		"Posts":         sortedPosts,
 	}
@@ -3032,40 +8480,50 @@ func (s *Site) generateRSSFeed() error {
 	// 渲染 RSS
 	tmpl, err := template.New("rss").Parse(rssTemplate)
 	if err != nil {
-		return fmt.Errorf("解析RSS模板失败: %w", err)
+		return "", fmt.Errorf("解析RSS模板失败: %w", err)
 	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("渲染RSS失败: %w", err)
+		return "", fmt.Errorf("渲染RSS失败: %w", err)
 	}
 
 	// 手动添加 XML 声明
-	s.RSSFeed = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + buf.String()
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + buf.String(), nil
+}
 
-	// 写入 RSS 文件
-	rssPath := filepath.Join(s.Config.Destination, "feed.xml")
-	if err := os.WriteFile(rssPath, []byte(s.RSSFeed), 0644); err != nil {
-		return fmt.Errorf("写入RSS文件失败: %w", err)
+// generateSitemap 生成 Sitemap
+func (s *Site) generateSitemap() error {
+	content, err := s.renderSitemap()
+	if err != nil {
+		return err
 	}
+	s.SitemapXML = content
 
-	log.Printf("生成RSS Feed: %s", rssPath)
+	// 写入 Sitemap 文件
+	sitemapPath := filepath.Join(s.Config.Destination, "sitemap.xml")
+	if err := s.writeFile(sitemapPath, []byte(s.SitemapXML)); err != nil {
+		return fmt.Errorf("写入Sitemap文件失败: %w", err)
+	}
+
+	log.Printf("生成Sitemap: %s", sitemapPath)
 	return nil
 }
 
-// generateSitemap 生成 Sitemap
-func (s *Site) generateSitemap() error {
+// renderSitemap 渲染 Sitemap 的内容
+func (s *Site) renderSitemap() (string, error) {
 	// 收集所有URL
 	var urls []string
 
 	// 添加首页
 	urls = append(urls, "/")
 
-	// 添加页面
+	// 添加页面（404 页面不需要收录）
 	for _, page := range s.Pages {
-		relPath, _ := filepath.Rel(s.Config.Source, page.Path)
-		url := strings.TrimSuffix(relPath, filepath.Ext(relPath)) + ".html"
-		urls = append(urls, "/"+strings.ReplaceAll(url, string(filepath.Separator), "/"))
+		if rel, _ := filepath.Rel(s.Config.Source, page.Path); s.Config.isNotFoundPage(rel) {
+			continue
+		}
+		urls = append(urls, "/"+page.URL)
 	}
 
 	// 添加文章
@@ -3078,6 +8536,29 @@ func (s *Site) generateSitemap() error {
 		urls = append(urls, "/"+relativeURL)
 	}
 
+	// 添加其他语言的首页
+	for _, code := range s.Config.LanguageCodes() {
+		if prefix := s.Config.LanguagePrefix(code); prefix != "" {
+			urls = append(urls, prefix+"/")
+		}
+	}
+
+	// 添加繁简镜像的首页、页面和文章
+	for _, ls := range s.sites {
+		if ls.mirror == nil {
+			continue
+		}
+		urls = append(urls, ls.LangPrefix+"/")
+		for _, page := range ls.Pages {
+			if rel, _ := filepath.Rel(s.Config.Source, page.Path); !s.Config.isNotFoundPage(rel) {
+				urls = append(urls, "/"+page.URL)
+			}
+		}
+		for _, post := range ls.Posts {
+			urls = append(urls, post.extractRelativeURL())
+		}
+	}
+
 	// 添加归档页面
 	urls = append(urls, "/archives/")
 
@@ -3109,69 +8590,114 @@ func (s *Site) generateSitemap() error {
 	// 渲染 Sitemap
 	tmpl, err := template.New("sitemap").Parse(sitemapTemplate)
 	if err != nil {
-		return fmt.Errorf("解析Sitemap模板失败: %w", err)
+		return "", fmt.Errorf("解析Sitemap模板失败: %w", err)
 	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("渲染Sitemap失败: %w", err)
+		return "", fmt.Errorf("渲染Sitemap失败: %w", err)
 	}
 
 	// 手动添加 XML 声明
-	s.SitemapXML = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + buf.String()
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + buf.String(), nil
+}
 
-	// 写入 Sitemap 文件
-	sitemapPath := filepath.Join(s.Config.Destination, "sitemap.xml")
-	if err := os.WriteFile(sitemapPath, []byte(s.SitemapXML), 0644); err != nil {
-		return fmt.Errorf("写入Sitemap文件失败: %w", err)
+// layoutName 返回页面使用的布局，未指定时为 default
+func (p *Page) layoutName() string {
+	if p.Layout == "" {
+		return "default"
 	}
+	return p.Layout
+}
 
-	log.Printf("生成Sitemap: %s", sitemapPath)
-	return nil
+// layoutName 返回文章使用的布局，未指定或为 default 时强制使用 post
+func (p *Post) layoutName() string {
+	if p.Layout != "" && p.Layout != "default" {
+		return p.Layout
+	}
+	return "post"
 }
 
 // renderPage 渲染单个页面
 func (s *Site) renderPage(p *Page) error {
+	// 增量构建：源内容和依赖都未变化时跳过
+	key := s.outputKey("page", p.Path)
+	var source string
+	var deps []string
+	if s.cache != nil {
+		source, deps = p.fingerprint(), s.outputDeps(p.layoutName())
+		if s.cache.fresh(key, source, deps) {
+			return nil
+		}
+	}
+
+	// 其他协程可能在布局中读取本页面，因此只在最后写回 RenderedContent
+	html, err := s.pageHTML(p)
+	if err != nil {
+		return err
+	}
+	p.RenderedContent = html
+	s.cache.record(key, source, deps, p.Content, s.pageOutputPath(p))
+	return nil
+}
+
+// pageHTML 渲染页面并返回结果，不修改页面
+func (s *Site) pageHTML(p *Page) (string, error) {
+	layoutName := p.layoutName()
+
 	// 转换Markdown内容
-	htmlContent, _ := s.Converter.Convert(p.Content)
-	p.RenderedContent = htmlContent
+	htmlContent := p.Content
+	if !p.isHTML() {
+		htmlContent, _ = s.cache.convert(s.Converter, p.Content)
+	}
 
 	// 应用布局
-	layoutName := p.Layout
-	if layoutName == "" {
-		layoutName = "default"
-	}
 	layout, exists := s.Layouts[layoutName]
 	if !exists {
-		return fmt.Errorf("布局不存在: %s", layoutName)
+		return "", fmt.Errorf("布局不存在: %s", layoutName)
 	}
 	data := map[string]interface{}{
-		"page": p,
-		"site": map[string]interface{}{
-			"title":       s.Config.Title,
-			"subtitle":    s.Config.Subtitle,
-			"description": s.Config.Description,
-			"author":      s.Config.Author,
-			"url":         s.Config.URL,
-			"posts":       s.Posts,
-			"pages":       s.Pages,
-			"data":        s.Data,
-			"archives":    s.Archives,
-			"JiebaTags":   s.JiebaTags,
-		},
-		"content": template.HTML(p.RenderedContent),
+		"page":       p,
+		"site":       s.siteData(s.Archives),
+		"content":    template.HTML(htmlContent),
+		"alternates": p.Alternates,
 	}
 
 	html, err := s.Template.Render(layout, data)
 	if err != nil {
-		return fmt.Errorf("应用布局失败: %w", err)
+		return "", fmt.Errorf("应用布局失败: %w", err)
 	}
-	p.RenderedContent = html
-	return nil
+	return injectHreflang(html, p.Alternates), nil
 }
 
 // renderPost 渲染单个文章
 func (s *Site) renderPost(p *Post) error {
+	// 增量构建：源内容和依赖都未变化时跳过
+	key := s.outputKey("post", p.Path)
+	var source string
+	var deps []string
+	if s.cache != nil {
+		source, deps = p.fingerprint(), s.outputDeps(p.layoutName())
+		if s.cache.fresh(key, source, deps) {
+			return nil
+		}
+	}
+
+	// 其他协程可能在布局中读取本文章，因此只在最后写回 RenderedContent
+	html, markdown, err := s.postHTML(p)
+	if err != nil {
+		return err
+	}
+	p.RenderedContent = html
+	outputPath, archivePath := s.postOutputPaths(p)
+	s.cache.record(key, source, deps, markdown, outputPath, archivePath)
+	return nil
+}
+
+// postHTML 渲染文章并返回结果和去除一级标题后的 Markdown，不修改文章
+func (s *Site) postHTML(p *Post) (html, markdown string, err error) {
+	layoutName := p.layoutName()
+
 	// 自动去除正文开头的一级标题，避免和页面主标题重复
 	lines := strings.Split(p.Content, "\n")
 	newLines := make([]string, 0, len(lines))
@@ -3187,64 +8713,32 @@ func (s *Site) renderPost(p *Post) error {
 	contentNoH1 := strings.Join(newLines, "\n")
 
 	// 转换Markdown内容
-	htmlContent, err := s.Converter.Convert(contentNoH1)
+	htmlContent, err := s.cache.convert(s.Converter, contentNoH1)
 	if err != nil {
-		return fmt.Errorf("转换Markdown失败: %w", err)
+		return "", "", fmt.Errorf("转换Markdown失败: %w", err)
 	}
-	p.RenderedContent = htmlContent
 
-	// 强制使用 post.html 布局
-	layoutName := "post"
-	if p.Layout != "" && p.Layout != "default" {
-		layoutName = p.Layout
-	}
 	layout, exists := s.Layouts[layoutName]
 	if !exists {
-		return fmt.Errorf("布局不存在: %s", layoutName)
+		return "", "", fmt.Errorf("布局不存在: %s", layoutName)
 	}
 
 	// 准备渲染数据
 	data := map[string]interface{}{
-		"post":    p,
-		"content": template.HTML(p.RenderedContent),
-		"site": map[string]interface{}{
-			"title":       s.Config.Title,
-			"subtitle":    s.Config.Subtitle,
-			"description": s.Config.Description,
-			"author":      s.Config.Author,
-			"url":         s.Config.URL,
-			"posts":       s.Posts,
-			"pages":       s.Pages,
-			"data":        s.Data,
-			"archives":    s.Archives,
-			"JiebaTags":   s.JiebaTags,
-		},
+		"post":       p,
+		"content":    template.HTML(htmlContent),
+		"site":       s.siteData(s.Archives),
+		"alternates": p.Alternates,
 	}
 
-	html, err := s.Template.Render(layout, data)
+	html, err = s.Template.Render(layout, data)
 	if err != nil {
-		return fmt.Errorf("应用布局失败: %w", err)
+		return "", "", fmt.Errorf("应用布局失败: %w", err)
 	}
-	p.RenderedContent = html
-	return nil
+	return injectHreflang(html, p.Alternates), contentNoH1, nil
 }
 
 // toSimplified 将字符串转为简体
 func toSimplified(s string) string {
-	// 使用 gocc 进行繁简转换
-	cc, err := gocc.New("t2s") // 繁体转简体
-	if err != nil {
-		// 如果转换失败，返回原字符串
-		log.Printf("繁简转换初始化失败: %v", err)
-		return s
-	}
-
-	result, err := cc.Convert(s)
-	if err != nil {
-		// 如果转换失败，返回原字符串
-		log.Printf("繁简转换失败: %v", err)
-		return s
-	}
-
-	return result
+	return analyzer.ToSimplified(s)
 }
@@ -0,0 +1,2413 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liuzl/gocc"
+)
+
+// TestMain 丢弃构建过程的日志，测试失败时只输出断言信息
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// generateSite 在 dir 下生成包含 n 篇文章和若干页面的测试站点
+func generateSite(tb testing.TB, dir string, n int) {
+	tb.Helper()
+
+	postsDir := filepath.Join(dir, "_posts")
+	if err := os.MkdirAll(postsDir, 0755); err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf(`---
+title: "测试文章 %d"
+layout: post
+description: "第 %d 篇文章"
+---
+
+# 测试文章 %d
+
+这是第 %d 篇文章的摘要，介绍静态网站生成器的渲染流程。
+
+## 小节
+
+- 列表项一
+- 列表项二
+
+`+"```go\nfunc main() {\n\tfmt.Println(%d)\n}\n```"+`
+
+正文段落包含**强调**、*斜体*和[链接](https://example.com/%d)。
+
+| 列 | 值 |
+|----|----|
+| a  | %d |
+`, i, i, i, i, i, i, i)
+		name := fmt.Sprintf("2024-%02d-%02d-post-%d.md", i%12+1, i%28+1, i)
+		if err := os.WriteFile(filepath.Join(postsDir, name), []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	for i := 0; i < n/10+1; i++ {
+		content := fmt.Sprintf("---\ntitle: \"页面 %d\"\nlayout: page\n---\n\n页面 %d 的内容。\n", i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("page-%d.md", i)), []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// newTestSite 创建指向 src 和 dest 的站点
+func newTestSite(tb testing.TB, src, dest string, jobs int) *Site {
+	tb.Helper()
+
+	cfg, err := Load("", src, dest)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg.Jobs = jobs
+	return New(cfg)
+}
+
+// readTree 读取目录下所有文件内容，键为相对路径
+func readTree(tb testing.TB, root string) map[string][]byte {
+	tb.Helper()
+
+	files := make(map[string][]byte)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[rel] = data
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return files
+}
+
+// writeFiles 在 dir 下写入测试文件，键为相对路径
+func writeFiles(tb testing.TB, dir string, files map[string]string) {
+	tb.Helper()
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// buildTimeRegex 匹配随构建时间变化的字段
+var buildTimeRegex = regexp.MustCompile(`<lastBuildDate>[^<]*</lastBuildDate>|<lastmod>[^<]*</lastmod>`)
+
+func TestParallelBuildMatchesSerial(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 30)
+
+	serialDest := filepath.Join(t.TempDir(), "serial")
+	if err := newTestSite(t, src, serialDest, 1).Build(); err != nil {
+		t.Fatalf("串行构建失败: %v", err)
+	}
+
+	parallelDest := filepath.Join(t.TempDir(), "parallel")
+	if err := newTestSite(t, src, parallelDest, 8).Build(); err != nil {
+		t.Fatalf("并发构建失败: %v", err)
+	}
+
+	serial := readTree(t, serialDest)
+	parallel := readTree(t, parallelDest)
+	if len(serial) != len(parallel) {
+		t.Fatalf("输出文件数量不同: 串行 %d, 并发 %d", len(serial), len(parallel))
+	}
+	for name, want := range serial {
+		got, ok := parallel[name]
+		if !ok {
+			t.Errorf("并发构建缺少文件: %s", name)
+			continue
+		}
+		want = buildTimeRegex.ReplaceAll(want, nil)
+		got = buildTimeRegex.ReplaceAll(got, nil)
+		if !bytes.Equal(want, got) {
+			t.Errorf("文件内容不同: %s", name)
+		}
+	}
+}
+
+func TestRenderErrorsAreDeterministic(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 20)
+
+	// 让所有文章都引用不存在的布局
+	posts, _ := filepath.Glob(filepath.Join(src, "_posts", "*.md"))
+	for _, p := range posts {
+		data, _ := os.ReadFile(p)
+		data = bytes.Replace(data, []byte("layout: post"), []byte("layout: missing"), 1)
+		os.WriteFile(p, data, 0644)
+	}
+
+	var first string
+	for i := 0; i < 3; i++ {
+		err := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 8).Build()
+		if err == nil {
+			t.Fatal("期望构建失败")
+		}
+		if got := strings.Count(err.Error(), "布局不存在: missing"); got != len(posts) {
+			t.Fatalf("期望报告 %d 个错误，实际 %d 个", len(posts), got)
+		}
+		if i == 0 {
+			first = err.Error()
+		} else if err.Error() != first {
+			t.Fatalf("错误顺序不确定:\n%s\n---\n%s", first, err.Error())
+		}
+	}
+}
+
+// prepareRenderBenchmark 加载生成的站点，跳过分词和繁简转换，只为渲染和写入做准备
+func prepareRenderBenchmark(b *testing.B, n, jobs int) *Site {
+	b.Helper()
+
+	src := b.TempDir()
+	generateSite(b, src, n)
+	s := newTestSite(b, src, filepath.Join(b.TempDir(), "out"), jobs)
+
+	if err := s.loadLayouts(); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.loadIncludes(); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.loadTranslations(); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.loadPages(); err != nil {
+		b.Fatal(err)
+	}
+	posts, _ := filepath.Glob(filepath.Join(src, "_posts", "*.md"))
+	for _, path := range posts {
+		p, err := NewPost(path, s.Config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.Posts = append(s.Posts, p)
+	}
+	if err := s.initMasterTemplate(); err != nil {
+		b.Fatal(err)
+	}
+	s.processCollections()
+	return s
+}
+
+// BenchmarkRenderAndWrite 在生成的大型站点上比较串行与并发渲染、写入的耗时
+func BenchmarkRenderAndWrite(b *testing.B) {
+	seen := map[int]bool{}
+	for _, jobs := range []int{1, 4, runtime.GOMAXPROCS(0)} {
+		if seen[jobs] {
+			continue
+		}
+		seen[jobs] = true
+		b.Run(fmt.Sprintf("posts=1000/jobs=%d", jobs), func(b *testing.B) {
+			s := prepareRenderBenchmark(b, 1000, jobs)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.render(); err != nil {
+					b.Fatal(err)
+				}
+				if err := s.write(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBuild 完整构建 200 篇文章，包括标签云和搜索索引
+func BenchmarkBuild(b *testing.B) {
+	src := b.TempDir()
+	generateSite(b, src, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := newTestSite(b, src, filepath.Join(b.TempDir(), "out"), runtime.GOMAXPROCS(0))
+		if err := s.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearch /api/search 的查询延迟，查询需要繁简转换和分词
+func BenchmarkSearch(b *testing.B) {
+	defer func(w io.Writer) { gin.DefaultWriter = w }(gin.DefaultWriter)
+	gin.DefaultWriter = io.Discard
+
+	src := b.TempDir()
+	generateSite(b, src, 200)
+	s := newTestSite(b, src, filepath.Join(b.TempDir(), "out"), runtime.GOMAXPROCS(0))
+	if err := s.Build(); err != nil {
+		b.Fatal(err)
+	}
+	router := s.newRouter(nil)
+	queries := []string{"静态网站", "測試文章 渲染流程", "列表 OR 链接 -强调"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape(queries[i%len(queries)]), nil))
+		if w.Code != http.StatusOK {
+			b.Fatalf("查询返回 %d", w.Code)
+		}
+	}
+}
+
+// BenchmarkToSimplified 繁简转换：每次调用新建转换器（原来的做法）与共享的文本分析服务
+func BenchmarkToSimplified(b *testing.B) {
+	const text = "繁體中文的靜態網站生成器"
+	b.Run("new-per-call", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cc, err := gocc.New("t2s")
+			if err != nil {
+				b.Fatal(err)
+			}
+			cc.Convert(text)
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		toSimplified(text)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			toSimplified(text)
+		}
+	})
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 10)
+	dest := filepath.Join(t.TempDir(), "out")
+
+	build := func() *Site {
+		t.Helper()
+		s := newTestSite(t, src, dest, 4)
+		s.Config.Incremental = true
+		if err := s.Build(); err != nil {
+			t.Fatalf("增量构建失败: %v", err)
+		}
+		return s.Snapshot()
+	}
+
+	first := build()
+	if first.cache.skipped != 0 {
+		t.Fatalf("首次构建不应跳过输出，跳过了 %d 个", first.cache.skipped)
+	}
+
+	postFile, _ := first.postOutputPaths(first.Posts[0])
+	before, err := os.Stat(postFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未修改时全部跳过
+	second := build()
+	if second.cache.rendered != 0 {
+		t.Fatalf("未修改时不应重新渲染，重新渲染了 %d 个", second.cache.rendered)
+	}
+
+	// 修改页面正文只影响该页面和依赖页面集合的输出
+	pagePath := filepath.Join(src, "page-0.md")
+	data, _ := os.ReadFile(pagePath)
+	if err := os.WriteFile(pagePath, append(data, []byte("\n新增的段落。\n")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := build()
+	if third.cache.isUnchanged("page:page-0.md") {
+		t.Fatal("修改后的页面应重新渲染")
+	}
+	if !third.cache.isUnchanged(third.outputKey("post", third.Posts[0].Path)) {
+		t.Fatal("未修改的文章不应重新渲染")
+	}
+	if out, _ := os.ReadFile(filepath.Join(dest, "page-0.html")); !bytes.Contains(out, []byte("新增的段落。")) {
+		t.Fatal("页面输出没有更新")
+	}
+	if after, _ := os.Stat(postFile); !after.ModTime().Equal(before.ModTime()) {
+		t.Fatal("内容未变化的文件不应重写")
+	}
+
+	// 增量构建的结果与完整构建一致
+	fullDest := filepath.Join(t.TempDir(), "full")
+	if err := newTestSite(t, src, fullDest, 4).Build(); err != nil {
+		t.Fatalf("完整构建失败: %v", err)
+	}
+	incremental := readTree(t, dest)
+	for name, want := range readTree(t, fullDest) {
+		want = buildTimeRegex.ReplaceAll(want, nil)
+		got := buildTimeRegex.ReplaceAll(incremental[name], nil)
+		if !bytes.Equal(want, got) {
+			t.Errorf("增量构建输出与完整构建不同: %s", name)
+		}
+	}
+
+	// 删除源文件后移除对应输出
+	if err := os.Remove(pagePath); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if _, err := os.Stat(filepath.Join(dest, "page-0.html")); !os.IsNotExist(err) {
+		t.Fatal("已删除页面的输出应被移除")
+	}
+}
+
+func TestIncrementalCollectionContent(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_layouts/index.html":    "{{ range .posts }}<article>{{ .Content }}</article>{{ end }}",
+		"_layouts/full.html":     "{{ range $p := .site.posts }}<article>{{ $p.Content }}</article>{{ end }}",
+		"_layouts/list.html":     "{{ range .site.posts }}<li>{{ .Title }}</li>{{ end }}",
+		"full.md":                "---\ntitle: 全文\nlayout: full\n---\n",
+		"list.md":                "---\ntitle: 列表\nlayout: list\n---\n",
+		"_posts/2024-01-01-a.md": "---\ntitle: 甲\n---\n摘要\n\n旧的正文\n",
+		"_posts/2024-01-02-b.md": "---\ntitle: 乙\n---\n另一篇\n",
+	})
+	dest := filepath.Join(t.TempDir(), "out")
+	build := func() *Site {
+		t.Helper()
+		s := newTestSite(t, src, dest, 2)
+		s.Config.Paginate = 10
+		s.Config.Incremental = true
+		if err := s.Build(); err != nil {
+			t.Fatal(err)
+		}
+		return s.Snapshot()
+	}
+	build()
+
+	// 只修改正文（摘要、标题和日期不变，文章日期取自文件时间）：
+	// 显示全文的列表页更新，只读取元数据的页面和其他文章跳过
+	postPath := filepath.Join(src, "_posts", "2024-01-01-a.md")
+	info, err := os.Stat(postPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(postPath, []byte("---\ntitle: 甲\n---\n摘要\n\n新的正文\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(postPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	s := build()
+	for _, name := range []string{"index.html", "full.html"} {
+		if out, _ := os.ReadFile(filepath.Join(dest, name)); !bytes.Contains(out, []byte("新的正文")) || bytes.Contains(out, []byte("旧的正文")) {
+			t.Errorf("%s 没有更新: %s", name, out)
+		}
+	}
+	if !s.cache.isUnchanged("page:list.md") {
+		t.Error("只读取标题的页面不应重新渲染")
+	}
+	other := s.Posts[slices.IndexFunc(s.Posts, func(p *Post) bool { return p.Title == "乙" })]
+	if !s.cache.isUnchanged(s.outputKey("post", other.Path)) {
+		t.Error("未修改的文章不应重新渲染")
+	}
+
+	// 与完整构建一致
+	fullDest := filepath.Join(t.TempDir(), "full")
+	full := newTestSite(t, src, fullDest, 2)
+	full.Config.Paginate = 10
+	if err := full.Build(); err != nil {
+		t.Fatal(err)
+	}
+	incremental := readTree(t, dest)
+	for name, want := range readTree(t, fullDest) {
+		if !bytes.Equal(buildTimeRegex.ReplaceAll(want, nil), buildTimeRegex.ReplaceAll(incremental[name], nil)) {
+			t.Errorf("增量构建输出与完整构建不同: %s", name)
+		}
+	}
+}
+
+func TestRebuildUsesFreshSnapshot(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 5)
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 4)
+
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	first := s.Snapshot()
+
+	// 重复构建不会累积文章
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.Snapshot().Posts); got != 5 {
+		t.Fatalf("重复构建后应有 5 篇文章，实际 %d 篇", got)
+	}
+	if len(first.Posts) != 5 {
+		t.Fatal("旧快照不应被修改")
+	}
+
+	// 删除的文章从新快照中消失
+	posts, _ := filepath.Glob(filepath.Join(src, "_posts", "*.md"))
+	removed := first.Posts[0]
+	if err := os.Remove(removed.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	snap := s.Snapshot()
+	if got := len(snap.Posts); got != len(posts)-1 {
+		t.Fatalf("删除后应有 %d 篇文章，实际 %d 篇", len(posts)-1, got)
+	}
+	if snap.URLTree.Search(removed.extractRelativeURL()) != nil {
+		t.Fatal("已删除的文章仍可在URL树中找到")
+	}
+
+	// 构建失败时保留上一次的快照
+	if err := os.WriteFile(filepath.Join(src, "page-0.md"), []byte("---\nlayout: missing\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(); err == nil {
+		t.Fatal("期望构建失败")
+	}
+	if s.Snapshot() != snap {
+		t.Fatal("构建失败时不应替换快照")
+	}
+}
+
+func TestLiveReloadNotify(t *testing.T) {
+	lr := NewLiveReload()
+	ch := lr.subscribe()
+	defer lr.unsubscribe(ch)
+
+	cases := []struct {
+		changed []string
+		err     error
+		want    string
+	}{
+		{[]string{"stylesheets/site.css"}, nil, "css"},
+		{[]string{"stylesheets/site.css", "_posts/a.md"}, nil, "reload"},
+		{nil, nil, "reload"},
+		{[]string{"_layouts/post.html"}, fmt.Errorf("模板解析失败"), "error"},
+	}
+	for _, tc := range cases {
+		lr.Notify(tc.changed, tc.err)
+		if ev := <-ch; ev.Type != tc.want {
+			t.Errorf("Notify(%v, %v) = %s, 期望 %s", tc.changed, tc.err, ev.Type, tc.want)
+		}
+	}
+
+	// 构建失败后新打开的页面立即收到错误
+	late := lr.subscribe()
+	defer lr.unsubscribe(late)
+	if ev := <-late; ev.Type != "error" || ev.Error != "模板解析失败" {
+		t.Fatalf("新连接应收到上次的构建错误，实际 %+v", ev)
+	}
+
+	html := injectLiveReload([]byte("<html><body><p>正文</p></BODY></html>"))
+	if !bytes.Contains(html, []byte(liveReloadScript+"</BODY>")) {
+		t.Fatalf("脚本应插入到 </body> 之前: %s", html)
+	}
+}
+
+func TestConfigIsExcluded(t *testing.T) {
+	cfg := Defaults()
+	cfg.Exclude = []string{"drafts/", "*.tmp", "notes/private.md"}
+
+	cases := map[string]bool{
+		"drafts":            true,
+		"drafts/a.md":       true,
+		"a/b.tmp":           true,
+		"notes/private.md":  true,
+		"notes/public.md":   false,
+		"draftsman.md":      false,
+		"_posts/2024/x.md":  false,
+		"stylesheets/a.css": false,
+	}
+	for rel, want := range cases {
+		if got := cfg.IsExcluded(rel); got != want {
+			t.Errorf("IsExcluded(%q) = %v, 期望 %v", rel, got, want)
+		}
+	}
+}
+
+func TestFileWatcherWatchesSourceRecursively(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(src, "_site")
+	for _, name := range []string{
+		"_posts/2024/2024-01-01-a.md",
+		"stylesheets/site.css",
+		"drafts/b.md",
+		"_site/index.html",
+		".jekyll-cache/manifest.json",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(name), 0644)
+	}
+
+	cfg, err := Load("", src, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Exclude = []string{"drafts"}
+	fw, err := NewFileWatcher(New(cfg), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	watched := map[string]bool{}
+	for _, dir := range fw.watcher.WatchList() {
+		rel, _ := filepath.Rel(src, dir)
+		watched[filepath.ToSlash(rel)] = true
+	}
+	for _, dir := range []string{".", "_posts", "_posts/2024", "stylesheets"} {
+		if !watched[dir] {
+			t.Errorf("应监听目录 %s", dir)
+		}
+	}
+	for _, dir := range []string{"drafts", "_site", ".jekyll-cache"} {
+		if watched[dir] {
+			t.Errorf("不应监听目录 %s", dir)
+		}
+	}
+
+	if !cfg.IsConfigFile(filepath.Join(src, "_config.yml")) || cfg.IsConfigFile(filepath.Join(src, "_posts", "_config.yml")) {
+		t.Error("IsConfigFile 判断错误")
+	}
+}
+
+func TestFileWatcherCloseStopsRebuilds(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{"_posts/2024-01-01-a.md": "---\ntitle: a\n---\n正文\n"})
+	cfg, err := Load("", src, filepath.Join(src, "_site"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := NewFileWatcher(New(cfg), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.debounce = time.Millisecond
+	started := make(chan error, 1)
+	go func() { started <- fw.Start() }()
+
+	// 关闭期间和关闭之后仍有事件触发防抖，定时器回调不能向已关闭的通道发送
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				fw.debouncedRebuild(fmt.Sprintf("f%d-%d", i, j))
+			}
+		}(i)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	fw.debouncedRebuild("late")
+	time.Sleep(20 * time.Millisecond)
+
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	if fw.Close() != nil {
+		t.Error("重复关闭应直接返回")
+	}
+}
+
+func TestClassifyChange(t *testing.T) {
+	src := t.TempDir()
+	cfg, err := Load("", src, filepath.Join(src, "_site"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]changeKind{
+		"_config.yml":                 changeConfig,
+		"_i18n/en.yml":                changeConfig,
+		"_posts/2024-01-01-a.md":      changeContent,
+		"_posts/2024":                 changeContent,
+		"about.md":                    changeContent,
+		"404.html":                    changeContent,
+		"docs/404.html":               changeOther,
+		"_layouts/post.html":          changeLayout,
+		"_includes/sidebar.html":      changeLayout,
+		"_data/nav.yml":               changeData,
+		"stylesheets/site.css":        changeStatic,
+		"images/logo.png":             changeStatic,
+		"README.txt":                  changeOther,
+		"_drafts/2024-01-01-draft.md": changeOther,
+	}
+	for name, want := range cases {
+		if got, _ := cfg.classifyChange(filepath.Join(src, filepath.FromSlash(name))); got != want {
+			t.Errorf("classifyChange(%s) = %s, 期望 %s", name, got, want)
+		}
+	}
+}
+
+func TestTargetedRebuild(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 5)
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 4)
+	s.watching = true
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改页面：只渲染该页面和依赖页面集合的搜索页
+	pagePath := filepath.Join(src, "page-0.md")
+	if err := os.WriteFile(pagePath, []byte("---\ntitle: \"页面 0\"\nlayout: page\n---\n\n修改后的内容。\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rebuild([]string{pagePath}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"page:page-0.md", "search@zh-CN"}
+	if got := s.Snapshot().cache.renderedOutputs(); !slices.Equal(got, want) {
+		t.Fatalf("修改页面后重新渲染 %v, 期望 %v", got, want)
+	}
+	if out, _ := os.ReadFile(filepath.Join(dest, "page-0.html")); !bytes.Contains(out, []byte("修改后的内容。")) {
+		t.Fatal("页面输出没有更新")
+	}
+
+	// 修改布局：只渲染使用该布局的输出，文章和搜索树沿用上一次快照
+	prev := s.Snapshot()
+	layoutPath := filepath.Join(src, "_layouts", "page.html")
+	os.MkdirAll(filepath.Dir(layoutPath), 0755)
+	if err := os.WriteFile(layoutPath, []byte(`<html><body class="custom">{{ .content }}</body></html>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rebuild([]string{layoutPath}); err != nil {
+		t.Fatal(err)
+	}
+	snap := s.Snapshot()
+	for _, key := range snap.cache.renderedOutputs() {
+		if !strings.HasPrefix(key, "page:") {
+			t.Errorf("修改 page 布局不应重新渲染 %s", key)
+		}
+	}
+	if snap.URLTree != prev.URLTree {
+		t.Error("内容未变化时应沿用上一次的URL树")
+	}
+	if out, _ := os.ReadFile(filepath.Join(dest, "page-0.html")); !bytes.Contains(out, []byte(`class="custom"`)) {
+		t.Fatal("页面没有使用新布局")
+	}
+
+	// 新增和删除静态文件：只复制或移除该文件，不重新构建
+	cssPath := filepath.Join(src, "stylesheets", "extra.css")
+	os.MkdirAll(filepath.Dir(cssPath), 0755)
+	os.WriteFile(cssPath, []byte("body{}"), 0644)
+	if err := s.Rebuild([]string{cssPath}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Snapshot() != snap {
+		t.Error("只有静态文件变化时不应产生新快照")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "stylesheets", "extra.css")); err != nil {
+		t.Fatal("静态文件没有复制到输出目录")
+	}
+	os.Remove(cssPath)
+	if err := s.Rebuild([]string{cssPath}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "stylesheets", "extra.css")); !os.IsNotExist(err) {
+		t.Fatal("已删除的静态文件应从输出目录移除")
+	}
+}
+
+// waitForIndex 等待开发模式的后台任务构建完标签云和搜索树
+func waitForIndex(tb testing.TB, s *Site) *Site {
+	tb.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if snap := s.Snapshot(); snap.index != nil {
+			return snap
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tb.Fatal("后台索引没有完成")
+	return nil
+}
+
+func TestDevServerRendersOnDemand(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 12)
+
+	// 磁盘构建作为对照
+	diskDest := filepath.Join(t.TempDir(), "disk")
+	if err := newTestSite(t, src, diskDest, 2).Build(); err != nil {
+		t.Fatal(err)
+	}
+	want := readTree(t, diskDest)
+
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	s.memory = true
+	s.watching = true
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Snapshot().Posts[0].RenderedContent != "" {
+		t.Fatal("开发模式加载时不应渲染")
+	}
+	snap := waitForIndex(t, s)
+	router := s.newRouter(nil)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// 首次请求时只渲染被请求的文章
+	post := snap.Posts[0]
+	route, _ := snap.postRoutes(post)
+	if w := get(route); w.Code != http.StatusOK {
+		t.Fatalf("请求文章 %s 返回 %d", route, w.Code)
+	}
+	other, _ := snap.postRoutes(snap.Posts[1])
+	if snap.routes[route].content == nil || snap.routes[other].content != nil {
+		t.Fatal("应只渲染被请求的文章")
+	}
+
+	// 每个输出文件（包括归档副本和静态文件）都应与磁盘构建的内容一致
+	for name, data := range want {
+		w := get("/" + filepath.ToSlash(name))
+		if w.Code != http.StatusOK {
+			t.Errorf("请求 %s 返回 %d", name, w.Code)
+			continue
+		}
+		if !bytes.Equal(buildTimeRegex.ReplaceAll(w.Body.Bytes(), nil), buildTimeRegex.ReplaceAll(data, nil)) {
+			t.Errorf("内容与磁盘构建不同: %s", name)
+		}
+	}
+	if w := get("/archives/"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("目录请求应返回 index.html，得到 %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := get("/missing.html"); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的页面返回 %d", w.Code)
+	}
+
+	// 修改文章后新快照重新渲染，旧的渲染结果失效
+	if err := os.WriteFile(post.Path, []byte("---\ntitle: \"修改后的文章\"\nlayout: post\n---\n\n新的正文。\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rebuild([]string{post.Path}); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(route); !strings.Contains(w.Body.String(), "新的正文。") {
+		t.Fatal("修改后的文章没有重新渲染")
+	}
+	waitForIndex(t, s)
+
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatal("开发模式不应写入输出目录")
+	}
+}
+
+func TestDevLiveReloadDoesNotShareCache(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_layouts/bare.html": "<p>{{ .page.Title }}</p>{{ .content }}",
+		"bare.md":            "---\ntitle: 片段\nlayout: bare\n---\n" + strings.Repeat("正文", 5500) + "\n",
+	})
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 2)
+	s.memory = true
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	target := "/" + s.Snapshot().Pages[0].URL
+	router := s.newRouter(NewLiveReload())
+
+	// 没有 </body> 的页面并发请求时，追加脚本不能写入缓存的渲染结果（配合 -race 检查）；
+	// 页面超过 32KB，按页取整分配的缓存有足够的剩余容量放下脚本
+	var wg sync.WaitGroup
+	bodies := make([]string, 8)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+	for _, body := range bodies {
+		if !strings.HasPrefix(body, "<p>片段</p>") || strings.Count(body, liveReloadPath) != 1 {
+			t.Fatalf("%s 返回 %d 字节，实时刷新脚本 %d 个", target, len(body), strings.Count(body, liveReloadPath))
+		}
+	}
+	cached := s.Snapshot().routes[target].content
+	if spare := cached[len(cached):cap(cached)]; strings.Contains(string(cached), liveReloadPath) || len(spare) > 0 && spare[0] == liveReloadScript[0] {
+		t.Error("缓存的渲染结果被写入了实时刷新脚本")
+	}
+
+	// 有剩余容量的输入也不能被写入
+	buf := make([]byte, 4, 4+2*len(liveReloadScript))
+	copy(buf, "<p>x")
+	if out := injectLiveReload(buf); &out[0] == &buf[0] || buf[:cap(buf)][4] != 0 {
+		t.Error("injectLiveReload 应返回新的切片")
+	}
+}
+
+func TestDevIndexAttachesToSnapshot(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_layouts/post.html":     "{{ .post.Title }}",
+		"_layouts/page.html":     "{{ .page.Title }}:{{ range .site.tags }}[{{ . }}]{{ end }}",
+		"_posts/2024-01-01-a.md": "---\ntitle: 静态网站生成器\n---\n正文\n",
+		"_posts/2024-01-02-b.md": "---\ntitle: 网站部署指南\n---\n正文\n",
+		"about.md":               "---\ntitle: 关于\nlayout: page\n---\n正文\n",
+	})
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 2)
+	s.memory = true
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	snap := s.Snapshot()
+	post, _ := snap.postRoutes(snap.Posts[0])
+	if _, err := snap.routes[post].get(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snap.routes["/about.html"].get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 索引附加到快照副本：不重新加载内容，不读取标签云的输出保留已渲染的结果
+	c := snap.withIndex(snap.buildIndex())
+	if c == snap || c.index == nil || c.Posts[0] != snap.Posts[0] || c.Layouts["post"] != snap.Layouts["post"] {
+		t.Fatal("应在原快照的内容上附加索引")
+	}
+	if c.routes[post] != snap.routes[post] {
+		t.Error("不读取标签云的文章应沿用已渲染的结果")
+	}
+	if c.routes["/about.html"] == snap.routes["/about.html"] || c.routes["/tags/index.html"] == snap.routes["/tags/index.html"] {
+		t.Error("读取标签云的输出应重新渲染")
+	}
+	if got, _ := c.routes["/about.html"].get(); !strings.Contains(string(got), "[网站]") {
+		t.Errorf("附加索引后的页面为 %s", got)
+	}
+	if got, _ := snap.routes["/about.html"].get(); snap.index == nil && string(got) != "关于:" {
+		t.Errorf("原快照不应被修改: %s", got)
+	}
+
+	// 后台任务完成后换上的快照同样沿用原快照的内容
+	if indexed := waitForIndex(t, s); indexed.Posts[0] != snap.Posts[0] || indexed.routes[post] != snap.routes[post] {
+		t.Error("后台索引不应重新加载站点")
+	}
+}
+
+func TestServeNotFoundAndHeaders(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 3)
+	notFound := "---\ntitle: \"找不到页面\"\n---\n<p class=\"missing\">页面不存在</p>\n"
+	if err := os.WriteFile(filepath.Join(src, "404.html"), []byte(notFound), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, memory := range []bool{false, true} {
+		t.Run(fmt.Sprintf("memory=%v", memory), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "out")
+			s := newTestSite(t, src, dest, 2)
+			s.Config.Paginate = 10
+			s.Config.CacheControl = []CacheRule{
+				{Pattern: "stylesheets", Value: "public, max-age=31536000, immutable"},
+				{Pattern: "*.html", Value: "no-cache"},
+			}
+			s.memory = memory
+			if err := s.Build(); err != nil {
+				t.Fatal(err)
+			}
+			router := s.newRouter(nil)
+			get := func(target string, header ...string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				for i := 0; i+1 < len(header); i += 2 {
+					req.Header.Set(header[i], header[i+1])
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			// 404 页面经过布局渲染，并以 404 状态返回
+			w := get("/no/such/page")
+			if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `<p class="missing">页面不存在</p>`) || !strings.Contains(w.Body.String(), "</html>") {
+				t.Fatalf("404 响应不正确: %d %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+				t.Errorf("404 页面 Content-Type 为 %q", got)
+			}
+
+			// 各类输出的 Content-Type 和 Cache-Control
+			for target, want := range map[string]string{
+				"/":                     "text/html; charset=utf-8",
+				"/page-0.html":          "text/html; charset=utf-8",
+				"/feed.xml":             "application/xml; charset=utf-8",
+				"/stylesheets/site.css": "text/css; charset=utf-8",
+			} {
+				w := get(target)
+				if w.Code != http.StatusOK {
+					t.Errorf("请求 %s 返回 %d", target, w.Code)
+					continue
+				}
+				if got := w.Header().Get("Content-Type"); got != want {
+					t.Errorf("%s 的 Content-Type 为 %q，期望 %q", target, got, want)
+				}
+				if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" && target != "/stylesheets/site.css" {
+					t.Errorf("%s 缺少 ETag 或 Last-Modified", target)
+				}
+			}
+			if got := get("/stylesheets/site.css").Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+				t.Errorf("样式表的 Cache-Control 为 %q", got)
+			}
+			if got := get("/page-0.html").Header().Get("Cache-Control"); got != "no-cache" {
+				t.Errorf("页面的 Cache-Control 为 %q", got)
+			}
+
+			// 条件请求
+			first := get("/page-0.html")
+			if w := get("/page-0.html", "If-None-Match", first.Header().Get("ETag")); w.Code != http.StatusNotModified {
+				t.Errorf("If-None-Match 匹配时返回 %d", w.Code)
+			}
+			if w := get("/page-0.html", "If-Modified-Since", first.Header().Get("Last-Modified")); w.Code != http.StatusNotModified {
+				t.Errorf("If-Modified-Since 未修改时返回 %d", w.Code)
+			}
+			if w := get("/page-0.html", "If-None-Match", `"other"`); w.Code != http.StatusOK {
+				t.Errorf("If-None-Match 不匹配时返回 %d", w.Code)
+			}
+
+			if w := get("/sitemap.xml"); strings.Contains(w.Body.String(), "404.html") {
+				t.Error("Sitemap 不应包含 404 页面")
+			}
+			waitForIndex(t, s)
+		})
+	}
+}
+
+// gunzip 解压 gzip 内容
+func gunzip(tb testing.TB, data []byte) []byte {
+	tb.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	cases := []struct {
+		header, enc string
+		want        bool
+	}{
+		{"gzip, deflate, br", "gzip", true},
+		{"gzip, deflate, br", "br", true},
+		{"deflate", "gzip", false},
+		{"gzip;q=0", "gzip", false},
+		{"br;q=0.5, gzip;q=1.0", "br", true},
+		{"*", "gzip", true},
+		{"*, gzip;q=0", "gzip", false},
+		{"identity, *;q=0", "br", false},
+		{"", "gzip", false},
+	}
+	for _, c := range cases {
+		if got := acceptsEncoding(c.header, c.enc); got != c.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, 期望 %v", c.header, c.enc, got, c.want)
+		}
+	}
+}
+
+func TestServerCORSAuthAndShutdown(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 3)
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 2)
+	s.Config.Paginate = 10
+	s.Config.CORSOrigins = []string{"https://example.com/"}
+	s.Config.BasicAuth = &BasicAuth{Username: "preview", Password: "secret"}
+	if err := s.Config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	lr := NewLiveReload()
+	router := s.newRouter(lr)
+	do := func(method, target, origin string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if auth {
+			req.SetBasicAuth("preview", "secret")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 没有凭据时所有路径都返回 401
+	for _, target := range []string{"/", "/api/search?q=文章", liveReloadPath} {
+		if w := do(http.MethodGet, target, "", false); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("GET %s 未认证应返回 401，实际 %d", target, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/", "", true); w.Code != http.StatusOK {
+		t.Fatalf("认证后应返回 200，实际 %d", w.Code)
+	}
+
+	// 只有配置的来源得到 Access-Control-Allow-Origin
+	if w := do(http.MethodGet, "/api/search?q=文章", "https://example.com", true); w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("允许的来源应被回显，实际 %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	w := do(http.MethodGet, "/api/search?q=文章", "https://evil.example", true)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("其他来源不应允许跨域: %v", w.Header())
+	}
+	if w := do(http.MethodOptions, "/api/search", "https://example.com", true); w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("预检请求应返回 204，实际 %d %v", w.Code, w.Header())
+	}
+	s.Config.CORSOrigins = nil
+	if w := do(http.MethodGet, "/api/search?q=文章", "https://example.com", true); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("默认不应允许跨域")
+	}
+
+	// 优雅关闭时结束实时刷新连接，不必等到超时
+	ts := httptest.NewUnstartedServer(router)
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Config.RegisterOnShutdown(lr.Close)
+	ts.Start()
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+liveReloadPath, nil)
+	req.SetBasicAuth("preview", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	time.Sleep(100 * time.Millisecond) // 超过 write_timeout 后连接仍然可用
+	lr.Notify(nil, nil)
+	buf := make([]byte, 256)
+	var got string
+	for !strings.Contains(got, `"reload"`) {
+		n, err := resp.Body.Read(buf)
+		if err != nil {
+			t.Fatalf("实时刷新连接不应受 write_timeout 影响: %v", err)
+		}
+		got += string(buf[:n])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := ts.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("关闭服务器失败: %v", err)
+	}
+
+	// 配置校验
+	bad := []func(c *Config){
+		func(c *Config) { c.BasicAuth = &BasicAuth{Username: "preview"} },
+		func(c *Config) { c.TLSCert = "cert.pem" },
+		func(c *Config) { c.TLSCert, c.TLSKey = "cert.pem", "key.pem" },
+		func(c *Config) { c.IdleTimeout = -time.Second },
+	}
+	for i, mutate := range bad {
+		cfg := *s.Config
+		cfg.BasicAuth = nil
+		mutate(&cfg)
+		if cfg.validate() == nil {
+			t.Errorf("第 %d 个无效配置应校验失败", i)
+		}
+	}
+}
+
+func TestTextAnalyzer(t *testing.T) {
+	a := &textAnalyzer{}
+	defer a.Close()
+	if got := a.Keywords("静态网站生成器把 Markdown 渲染为静态网站", 1); !slices.Equal(got, []string{"静态"}) && !slices.Equal(got, []string{"网站"}) {
+		t.Errorf("关键词为 %v", got)
+	}
+
+	// 多个 goroutine 同时使用，中途释放词典后按需重新加载
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if i == 0 && j == 10 {
+					a.Close()
+				}
+				if got := a.ToSimplified("開發伺服器"); got != "开发伺服器" {
+					t.Errorf("繁转简为 %s", got)
+					return
+				}
+				if got := a.ToTraditional("开发"); got != "開發" {
+					t.Errorf("简转繁为 %s", got)
+					return
+				}
+				if words := a.CutForSearch("静态网站生成器"); !slices.Contains(words, "网站") {
+					t.Errorf("分词结果为 %v", words)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSearchIndex(t *testing.T) {
+	src := t.TempDir()
+	postsDir := filepath.Join(src, "_posts")
+	os.MkdirAll(postsDir, 0755)
+	posts := map[string]string{
+		"2024-01-01-a.md": "---\ntitle: 静态网站生成器\ntags: [go, web]\n---\n介绍博客部署。\n",
+		"2024-02-01-b.md": "---\ntitle: 博客部署\ntags: go\n---\n博客的部署和博客的主题。\n",
+		"2024-03-01-c.md": "---\ntitle: 繁體中文\n---\n開發伺服器。\n",
+	}
+	for name, content := range posts {
+		file := filepath.Join(postsDir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// 文章日期取自文件修改时间
+		date, _ := time.Parse("2006-01-02", name[:10])
+		os.Chtimes(file, date, date)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 静态索引：文档按日期从新到旧编号，包含标签和带位置的简体词项
+	var manifest struct {
+		Shards   int                `json:"shards"`
+		Docs     []searchDoc        `json:"docs"`
+		Variants map[string]string  `json:"variants"`
+		Terms    map[string][][]int `json:"terms"`
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "search.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Shards != 1 || len(manifest.Docs) != 3 || !strings.HasSuffix(manifest.Docs[0].URL, "c.html") {
+		t.Fatalf("文档列表不正确: %+v", manifest.Docs)
+	}
+	if tags := manifest.Docs[2].Tags; !slices.Equal(tags, []string{"go", "web"}) {
+		t.Errorf("标签为 %v", tags)
+	}
+	// 倒排列表为 [文档, 字段, 位置...]：文档 1 的标题出现一次、正文出现两次，文档 2 的正文出现一次
+	if got := manifest.Terms["博客"]; fmt.Sprint(got) != "[[1 0 0] [1 3 0 6] [2 3 2]]" {
+		t.Errorf("博客 的倒排列表为 %v", got)
+	}
+	if manifest.Docs[1].Lengths[fieldTitle] != 2 {
+		t.Errorf("文档 1 的字段长度为 %v", manifest.Docs[1].Lengths)
+	}
+	if _, ok := manifest.Terms["开发"]; !ok || manifest.Variants["開"] != "开" {
+		t.Error("繁体内容应以简体词项索引，并提供繁简对照")
+	}
+
+	// /api/search 使用同一个索引：命中词项多的在前，繁体查询先转简体
+	router := s.newRouter(nil)
+	type searchResponse struct {
+		Results []struct {
+			URL   string  `json:"url"`
+			Score float64 `json:"score"`
+		} `json:"results"`
+		Total int `json:"total"`
+	}
+	search := func(params string) (resp searchResponse, code int) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?"+params, nil))
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp, w.Code
+	}
+	query := func(q string) []string {
+		resp, _ := search("q=" + url.QueryEscape(q))
+		var urls []string
+		for i, r := range resp.Results {
+			if r.Score <= 0 || i > 0 && r.Score > resp.Results[i-1].Score {
+				t.Errorf("%s 的得分应为正数且从高到低: %+v", q, resp.Results)
+			}
+			urls = append(urls, filepath.Base(r.URL))
+		}
+		return urls
+	}
+	if got := query("博客部署"); !slices.Equal(got, []string{"b.html", "a.html"}) {
+		t.Errorf("博客部署 的结果为 %v", got)
+	}
+	if got := query("開發"); !slices.Equal(got, []string{"c.html"}) {
+		t.Errorf("開發 的结果为 %v", got)
+	}
+	if got := query("web"); !slices.Equal(got, []string{"a.html"}) {
+		t.Errorf("标签 web 的结果为 %v", got)
+	}
+
+	// 分页：total 为全部命中数
+	if resp, _ := search("q=go&limit=1&offset=1"); resp.Total != 2 || len(resp.Results) != 1 {
+		t.Errorf("分页结果为 %+v", resp)
+	}
+	for _, params := range []string{"q=go&offset=5", "q=go&offset=9223372036854775807"} {
+		if resp, code := search(params); code != http.StatusOK || resp.Total != 2 || len(resp.Results) != 0 {
+			t.Errorf("%s 应返回空结果，实际 %d %+v", params, code, resp)
+		}
+	}
+	for _, params := range []string{"q=go&limit=0", "q=go&limit=abc", "q=go&offset=-1"} {
+		if _, code := search(params); code != http.StatusBadRequest {
+			t.Errorf("%s 应返回 400，实际 %d", params, code)
+		}
+	}
+
+	// 文档较多时词项按哈希分片，search.json 只保留文档
+	idx := &searchIndex{Terms: make(map[string][]posting)}
+	for i := 0; i < 2*searchShardDocs+1; i++ {
+		idx.Docs = append(idx.Docs, &searchDoc{ID: i})
+		idx.Terms[fmt.Sprintf("词%d", i)] = []posting{{Doc: i, Field: fieldBody, Positions: []int{0}}}
+	}
+	files := idx.files()
+	if len(files) != 5 || bytes.Contains(files["search.json"], []byte(`"terms"`)) {
+		t.Fatalf("应生成 search.json、search-suggest.json 和 3 个分片，实际 %d 个文件", len(files))
+	}
+	for term := range idx.Terms {
+		if !bytes.Contains(files[searchShardName(searchShard(term, 3))], []byte(`"`+term+`"`)) {
+			t.Fatalf("词项 %s 不在 searchShard 指定的分片中", term)
+		}
+	}
+
+	// 各分片路由共用一次序列化的结果
+	if again := idx.files(); &again[searchShardName(0)][0] != &files[searchShardName(0)][0] {
+		t.Error("files 应只序列化一次")
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	body := strings.Repeat("這是一段很長的介紹文字，用來測試摘要片段。", 6) +
+		"我們在本機啟動開發伺服器，然後比較 a < b 的結果。" +
+		strings.Repeat("其他無關的內容繼續寫下去。", 6) +
+		"\n\nAnother paragraph mentions golang performance tuning and benchmarks in English words.\n"
+	idx := buildSearchIndex(NewConverter(Defaults()), []*searchSource{
+		{Title: "開發伺服器指南", Content: body, Date: time.Now()},
+		{Title: "静态网站生成器", Content: "介绍静态网站的生成。", Date: time.Now()},
+	}, nil)
+	hit := func(q string) searchHit {
+		hits, _ := idx.search(q, searchOptions{})
+		if len(hits) == 0 {
+			t.Fatalf("%s 没有结果", q)
+		}
+		return hits[0]
+	}
+
+	// 简体查询命中繁体原文，高亮位置换算回原文
+	h := hit("开发")
+	if got := h.highlightTitle(); got != "<mark>開發</mark>伺服器指南" {
+		t.Errorf("标题高亮为 %q", got)
+	}
+	snippet := h.snippet(40)
+	if !strings.Contains(snippet, "<mark>開發</mark>伺服器") || !strings.HasPrefix(snippet, "…這是") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("片段应从句子开头截取并高亮原文: %q", snippet)
+	}
+	if !strings.Contains(snippet, "a &lt; b") {
+		t.Errorf("片段应转义 HTML: %q", snippet)
+	}
+
+	// 英文单词不被截断，段落之间的换行合并为空格
+	snippet = hit("benchmarks").snippet(40)
+	if !strings.HasSuffix(snippet, "<mark>benchmarks</mark> in English words.") {
+		t.Errorf("英文片段为 %q", snippet)
+	}
+	first := strings.Fields(strings.TrimPrefix(snippet, "…"))[0]
+	if !strings.Contains(body, " "+first+" ") && !strings.Contains(body, "\n"+first+" ") {
+		t.Errorf("片段开头截断了单词: %q", snippet)
+	}
+
+	// 重叠的词项合并为一个高亮，短正文完整返回
+	if got := hit("静态网站").snippet(40); got != "介绍<mark>静态网站</mark>的生成。" {
+		t.Errorf("短正文片段为 %q", got)
+	}
+
+	// 繁简转换改变字符数时按映射换算位置
+	text := searchText{runes: []rune("ab丙丁"), toOrig: []int{0, 1, 2, 2, 3, 4}}
+	if text.origin(3) != 2 || text.origin(5) != 4 || text.origin(9) != 4 {
+		t.Error("位置映射不正确")
+	}
+}
+
+func TestSearchSuggest(t *testing.T) {
+	src := t.TempDir()
+	postsDir := filepath.Join(src, "_posts")
+	os.MkdirAll(postsDir, 0755)
+	posts := map[string]string{
+		"2024-01-01-a.md": "---\ntitle: 博客主题\ntags: [Go, web]\n---\n介绍博客部署。\n",
+		"2024-02-01-b.md": "---\ntitle: 博客部署\ntags: go\n---\n博客的部署。\n",
+		"2024-03-01-c.md": "---\ntitle: Deploy guide\n---\ndeploy a website\n",
+	}
+	for name, content := range posts {
+		if err := os.WriteFile(filepath.Join(postsDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 静态候选为 [文本, 类型, 文档数, 键, 拼音]，按文档数排列
+	var file struct {
+		Suggestions [][]any `json:"suggestions"`
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "search-suggest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(file.Suggestions[0]); got != "[Go tag 2 go]" {
+		t.Errorf("第一个候选为 %s", got)
+	}
+	if !slices.ContainsFunc(file.Suggestions, func(sg []any) bool { return fmt.Sprint(sg) == "[博客 term 2 博客 boke]" }) {
+		t.Error("词项候选应包含拼音")
+	}
+
+	router := s.newRouter(nil)
+	get := func(path string, v any) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		json.Unmarshal(w.Body.Bytes(), v)
+		return w.Code
+	}
+	suggest := func(q string) string {
+		var resp struct {
+			Suggestions []struct{ Text, Type string } `json:"suggestions"`
+		}
+		get("/api/search/suggest?q="+url.QueryEscape(q), &resp)
+		var out []string
+		for _, sg := range resp.Suggestions {
+			out = append(out, sg.Text+"/"+sg.Type)
+		}
+		return strings.Join(out, ",")
+	}
+	for q, want := range map[string]string{
+		"bo ke":    "博客/term,博客主题/title,博客部署/title",
+		"博客部":      "博客部署/title",
+		"部":        "部署/term",
+		"Deploy g": "Deploy guide/title",
+		"g":        "Go/tag,guide/term",
+		"zzz":      "",
+	} {
+		if got := suggest(q); got != want {
+			t.Errorf("%s 的提示为 %q，应为 %q", q, got, want)
+		}
+	}
+	if code := get("/api/search/suggest?q=bo&limit=0", &struct{}{}); code != http.StatusBadRequest {
+		t.Errorf("limit=0 返回 %d", code)
+	}
+
+	// 没有结果时给出改写建议，有结果时不返回
+	didYouMean := func(q string) []string {
+		var resp struct {
+			DidYouMean []string `json:"did_you_mean"`
+		}
+		get("/api/search?q="+url.QueryEscape(q), &resp)
+		return resp.DidYouMean
+	}
+	for q, want := range map[string]string{
+		"博克":        "[博客]",
+		"bo ke":     "[博客 go ke]",
+		"deploi 博克": "[deploy 博客]",
+		"tag:go 主提": "[tag:go 主题]",
+		"博客":        "[]",
+		"tag:gogo":  "[]",
+	} {
+		if got := fmt.Sprint(didYouMean(q)); got != want {
+			t.Errorf("%s 的改写建议为 %s，应为 %s", q, got, want)
+		}
+	}
+}
+
+func TestSearchScope(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"_posts/2024-01-01-a.md": "---\ntitle: 部署文章\n---\n介绍部署。\n",
+		"_posts/2024-02-01-b.md": "---\ntitle: 草稿\nsearch: false\n---\n部署草稿。\n",
+		"docs/install.md":        "---\ntitle: 安装文档\ntags: [docs]\n---\n部署和安装步骤。\n",
+		"docs/internal.md":       "---\ntitle: 内部文档\nsearch: false\n---\n部署内部说明。\n",
+		"404.md":                 "---\ntitle: 找不到页面\n---\n部署的页面不存在。\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	search := func(s *Site, params string) []string {
+		w := httptest.NewRecorder()
+		s.newRouter(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?"+params, nil))
+		var resp struct {
+			Results []struct{ Title, Type, URL string } `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var out []string
+		for _, r := range resp.Results {
+			out = append(out, r.Type+":"+r.Title)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	// 页面和文章都参与搜索，search: false 的文档和 404 页面除外
+	if got := fmt.Sprint(search(s, "q=部署")); got != "[page:安装文档 post:部署文章]" {
+		t.Errorf("搜索结果为 %s", got)
+	}
+	if got := fmt.Sprint(search(s, "q=部署&collection=pages")); got != "[page:安装文档]" {
+		t.Errorf("只搜索页面的结果为 %s", got)
+	}
+	if got := fmt.Sprint(search(s, "q=tag:docs")); got != "[page:安装文档]" {
+		t.Errorf("页面标签的结果为 %s", got)
+	}
+	docs := s.Snapshot().searchIndex().Docs
+	if i := slices.IndexFunc(docs, func(d *searchDoc) bool { return d.Type == "page" }); i < 0 || docs[i].URL != "/docs/install.html" || docs[i].Collection != "pages" {
+		t.Errorf("页面文档为 %+v", docs)
+	}
+
+	// search_collections 关闭页面集合
+	dest2 := filepath.Join(t.TempDir(), "out")
+	s2 := newTestSite(t, src, dest2, 2)
+	s2.Config.SearchCollections = map[string]bool{"pages": false}
+	if err := s2.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(search(s2, "q=部署")); got != "[post:部署文章]" {
+		t.Errorf("关闭页面集合后的结果为 %s", got)
+	}
+
+	cfg := *s.Config
+	cfg.SearchCollections = map[string]bool{"drafts": true}
+	if cfg.validate() == nil {
+		t.Error("未知集合应校验失败")
+	}
+}
+
+func TestSearchHTMLPages(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"docs/deploy.html":      "---\ntitle: 运维手册\n---\n<h1>手册</h1>\n<p>服务器<b>部署</b>&amp;回滚</p>\n<script>var 脚本 = 1;</script>\n",
+		"docs/raw.html":         "<p>部署草稿</p>\n",
+		"stylesheets/demo.html": "---\ntitle: 样式演示\n---\n<p>部署演示</p>\n",
+	})
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 带前置数据的 HTML 文件作为页面输出；没有前置数据或在静态资源目录中的原样处理
+	pages := s.Snapshot().Pages
+	if len(pages) != 1 || pages[0].URL != "docs/deploy.html" {
+		t.Fatalf("页面为 %+v", pages)
+	}
+	if html, err := os.ReadFile(filepath.Join(dest, "docs", "deploy.html")); err != nil || !strings.Contains(string(html), "<b>部署</b>&amp;回滚") {
+		t.Errorf("HTML 页面输出为 %s: %v", html, err)
+	}
+
+	search := func(q string) string {
+		w := httptest.NewRecorder()
+		s.newRouter(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape(q), nil))
+		var resp struct {
+			Results []struct{ Title, Type, Snippet string } `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var out []string
+		for _, r := range resp.Results {
+			out = append(out, r.Type+":"+r.Title+":"+r.Snippet)
+		}
+		return fmt.Sprint(out)
+	}
+
+	// 只索引标签之外的文本，字符引用解析为字符，脚本内容不参与搜索
+	if got := search("部署"); !strings.Contains(got, "page:运维手册:") || !strings.Contains(got, "<mark>部署</mark>&amp;回滚") {
+		t.Errorf("搜索 部署 的结果为 %s", got)
+	}
+	for _, q := range []string{"脚本", "script", "草稿", "演示"} {
+		if got := search(q); got != "[]" {
+			t.Errorf("搜索 %s 的结果为 %s", q, got)
+		}
+	}
+	if got := htmlPlainText("<!-- 注释 --><div>第一段<br>第二<i>段</i></div><style>p{}</style>&lt;&#x4e2d;&gt;"); got != "第一段\n第二段\n<中>" {
+		t.Errorf("htmlPlainText = %q", got)
+	}
+}
+
+func TestSearchTraditionalExcerpt(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_posts/2024-01-02-env.md": "---\ntitle: 筆記\n---\n本文介紹開發環境的設定。\n\n後面的段落與主題無關。\n",
+	})
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.newRouter(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape("开发环境"), nil))
+	var resp struct {
+		Results []struct{ Title, Excerpt, Snippet string } `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// 简体查询命中繁体摘要，摘要和高亮保持原文字形
+	if len(resp.Results) != 1 {
+		t.Fatalf("搜索结果为 %s", w.Body.String())
+	}
+	r := resp.Results[0]
+	if r.Title != "筆記" || !strings.Contains(r.Excerpt, "本文介紹開發環境的設定") {
+		t.Errorf("结果为 %+v", r)
+	}
+	if !strings.Contains(r.Snippet, "<mark>開發環境</mark>的設定") {
+		t.Errorf("片段为 %q", r.Snippet)
+	}
+}
+
+func TestUserDictAndSynonyms(t *testing.T) {
+	defer analyzer.UseUserDict(nil)
+
+	words := parseUserDict([]byte("# 注释\n云原生 100 n\n\n开发服务器\n坏 行 有 太多 字段\n"), "jieba_user.dict")
+	if got := fmt.Sprint(words); got != "[{云原生 100 n} {开发服务器 0 }]" {
+		t.Errorf("用户词典解析为 %s", got)
+	}
+
+	syn := parseSynonyms([]interface{}{
+		[]interface{}{"K8s", "kubernetes"},
+		[]interface{}{"kube", "k8s"},
+		[]interface{}{"孤单"},
+	})
+	if got := fmt.Sprint(syn["kube"]); got != "[kube k8s kubernetes]" {
+		t.Errorf("合并后的同义词组为 %s", got)
+	}
+	if _, ok := syn["孤单"]; ok {
+		t.Error("只有一个词的组不应保留")
+	}
+	syn = parseSynonyms(map[string]interface{}{"部落格": []interface{}{"博客"}, "blog": "部落格"})
+	if got := fmt.Sprint(syn["博客"]); got != "[部落格 blog 博客]" {
+		t.Errorf("映射形式的同义词组为 %s", got)
+	}
+
+	src := t.TempDir()
+	files := map[string]string{
+		"_posts/2024-01-01-a.md": "---\ntitle: 云原生实践\n---\n在 Kubernetes 上部署。\n",
+		"_posts/2024-02-01-b.md": "---\ntitle: 部落格搭建\n---\n搭建个人站点。\n",
+		"_data/jieba_user.dict":  "云原生 100 n\n",
+		"_data/synonyms.yml":     "- [k8s, kubernetes]\n- [博客, 部落格]\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	titles := func(q string) string {
+		w := httptest.NewRecorder()
+		s.newRouter(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape(q), nil))
+		var resp struct {
+			Results []struct{ Title string } `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var out []string
+		for _, r := range resp.Results {
+			out = append(out, r.Title)
+		}
+		return fmt.Sprint(out)
+	}
+
+	// 用户词典让“云原生”成为一个词项
+	if _, ok := s.Snapshot().searchIndex().Terms["云原生"]; !ok {
+		t.Error("用户词没有进入索引")
+	}
+	// 查询时按同义词扩展，短语和其他字段不扩展
+	for q, want := range map[string]string{
+		"k8s":      "[云原生实践]",
+		"title:博客": "[部落格搭建]",
+		"-k8s":     "[部落格搭建]",
+		`"k8s"`:    "[]",
+		"tag:k8s":  "[]",
+	} {
+		if got := titles(q); got != want {
+			t.Errorf("查询 %s 的结果为 %s，期望 %s", q, got, want)
+		}
+	}
+
+	var manifest struct {
+		Synonyms map[string][]string `json:"synonyms"`
+	}
+	data, err := os.ReadFile(filepath.Join(s.Config.Destination, "search.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(data, &manifest)
+	if got := fmt.Sprint(manifest.Synonyms["kubernetes"]); got != "[k8s kubernetes]" {
+		t.Errorf("索引清单中的同义词为 %s", got)
+	}
+
+	// 修改同义词文件后重建即生效
+	os.WriteFile(filepath.Join(src, "_data/synonyms.yml"), []byte("- [k8s, 站点]\n"), 0644)
+	if err := s.Rebuild([]string{filepath.Join(src, "_data/synonyms.yml")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles("k8s"); got != "[部落格搭建]" {
+		t.Errorf("修改同义词后的结果为 %s", got)
+	}
+}
+
+func TestSearchPinyin(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	idx := buildSearchIndex(NewConverter(Defaults()), []*searchSource{
+		{Path: "a", Title: "Boke naming", Content: "The word boke appears here.", Date: day(3)},
+		{Path: "b", Title: "博客搭建", Content: "介绍个人博客的部署。", Date: day(2)},
+		{Path: "c", Title: "缓存", Content: "服务器缓存。", Date: day(1)},
+	}, nil)
+	if got := fmt.Sprint(idx.Pinyin["boke"], idx.Pinyin["bk"]); got != "[博客] [博客]" {
+		t.Errorf("拼音索引为 %s", got)
+	}
+
+	titles := func(q string) string {
+		hits, err := idx.search(q, searchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.Doc.Title)
+		}
+		return fmt.Sprint(out)
+	}
+	// 全拼、首字母、带声调的拼音都能命中中文，中文命中排在英文字面命中前面
+	for q, want := range map[string]string{
+		"boke":          "[博客搭建 Boke naming]",
+		"bk":            "[博客搭建]",
+		"bókè":          "[博客搭建]",
+		"bo2ke4":        "[博客搭建]",
+		"title:huancun": "[缓存]",
+		"boke -bushu":   "[Boke naming]",
+		`"boke"`:        "[Boke naming]",
+		"mp3":           "[]",
+	} {
+		if got := titles(q); got != want {
+			t.Errorf("查询 %s 的结果为 %s，期望 %s", q, got, want)
+		}
+	}
+
+	hits, _ := idx.search("boke", searchOptions{})
+	if got := hits[0].highlightTitle(); got != "<mark>博客</mark>搭建" {
+		t.Errorf("拼音命中的标题高亮为 %s", got)
+	}
+
+	for word, want := range map[string]string{"lü4": "lv", "Zhong1guo2": "", "zhong1guo2": "zhongguo", "mp3": "", "h5": "", "a": ""} {
+		if got, _ := pinyinQueryKey(word); got != want {
+			t.Errorf("pinyinQueryKey(%q) = %q，期望 %q", word, got, want)
+		}
+	}
+
+	var manifest struct {
+		PinyinBoost float64             `json:"pinyin_boost"`
+		Pinyin      map[string][]string `json:"pinyin"`
+	}
+	json.Unmarshal(idx.files()["search.json"], &manifest)
+	if manifest.PinyinBoost != searchPinyinBoost || fmt.Sprint(manifest.Pinyin["huancun"]) != "[缓存]" {
+		t.Errorf("静态索引中的拼音为 %v %v", manifest.PinyinBoost, manifest.Pinyin)
+	}
+}
+
+func TestSearchQuerySyntax(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	post := func(title, body, lang, date string, tags ...string) *searchSource {
+		return &searchSource{Type: "post", Collection: "posts", Title: title, Content: body, Lang: lang, Date: day(date), Tags: tags}
+	}
+	idx := buildSearchIndex(NewConverter(Defaults()), []*searchSource{
+		post("静态网站生成器", "介绍博客的部署和缓存。", "zh-CN", "2025-03-01", "Go", "web"),
+		post("博客部署指南", "部署静态网站到服务器。", "zh-CN", "2024-06-01", "go"),
+		post("Deploy guide", "deploy a blog with cache", "en", "2023-01-15", "web"),
+	}, nil)
+	titles := func(q string, opts searchOptions) string {
+		hits, err := idx.search(q, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.Doc.Title)
+		}
+		return strings.Join(out, ",")
+	}
+
+	for q, want := range map[string]string{
+		"博客 部署":                     "博客部署指南,静态网站生成器",
+		"博客 -缓存":                    "博客部署指南",
+		"缓存 OR 服务器":                 "博客部署指南,静态网站生成器",
+		`"部署静态"`:                    "博客部署指南",
+		`"静态部署"`:                    "",
+		"title:博客":                  "博客部署指南",
+		"tag:GO 部署":                 "博客部署指南,静态网站生成器",
+		"tag:web -lang:en":          "静态网站生成器",
+		"date:2024..2025 部署":        "博客部署指南,静态网站生成器",
+		"date:..2024-06 OR lang:en": "博客部署指南,Deploy guide",
+		"date:2025-03":              "静态网站生成器",
+		"deploy":                    "Deploy guide",
+		"靜態網站":                      "静态网站生成器,博客部署指南",
+	} {
+		if got := titles(q, searchOptions{}); got != want {
+			t.Errorf("%s 的结果为 %q，应为 %q", q, got, want)
+		}
+	}
+	if got := titles("tag:web", searchOptions{Sort: "date"}); got != "静态网站生成器,Deploy guide" {
+		t.Errorf("按日期排序为 %q", got)
+	}
+	if got := titles("部署", searchOptions{Collection: "pages"}); got != "" {
+		t.Errorf("集合筛选后为 %q", got)
+	}
+
+	for q, pos := range map[string]int{
+		"":                0,
+		"OR 博客":           0,
+		"博客 OR":           5,
+		"博客 -":            3,
+		"title: 博客":       0,
+		`"博客`:             0,
+		`部署 ""`:           3,
+		"date:2025..2024": 0,
+		"date:24":         0,
+	} {
+		_, err := idx.search(q, searchOptions{})
+		var qerr *queryError
+		if !errors.As(err, &qerr) || qerr.Pos != pos {
+			t.Errorf("%q 应在第 %d 个字符报错，实际为 %v", q, pos, err)
+		}
+	}
+}
+
+func TestGzipStaticAndNegotiation(t *testing.T) {
+	src := t.TempDir()
+	generateSite(t, src, 3)
+	appJS := filepath.Join(src, "js", "app.js")
+	os.MkdirAll(filepath.Dir(appJS), 0755)
+	if err := os.WriteFile(appJS, bytes.Repeat([]byte("console.log('jacky');\n"), 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	s.Config.GzipStatic = true
+	s.Config.GzipMinLength = 512
+	s.Config.Paginate = 10
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 足够大的文本输出都有内容一致的 .gz 副本，小文件和非文本文件没有
+	for name, data := range readTree(t, dest) {
+		if strings.HasSuffix(name, ".gz") {
+			continue
+		}
+		gz, err := os.ReadFile(filepath.Join(dest, name+".gz"))
+		want := compressible(name) && len(data) >= 512
+		if want != (err == nil) {
+			t.Errorf("%s 的 .gz 副本: 期望存在 %v", name, want)
+			continue
+		}
+		if want && !bytes.Equal(gunzip(t, gz), data) {
+			t.Errorf("%s.gz 的内容与原文件不一致", name)
+		}
+	}
+
+	// 文件变小后删除旧的副本
+	os.WriteFile(appJS, []byte("console.log(1);\n"), 0644)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "js", "app.js.gz")); !os.IsNotExist(err) {
+		t.Error("低于阈值的文件不应保留 .gz 副本")
+	}
+
+	get := func(router http.Handler, target, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 服务器优先使用预压缩副本：.br 优先于 .gz
+	router := s.newRouter(nil)
+	page := filepath.Join(dest, "page-0.html")
+	original, _ := os.ReadFile(page)
+	os.WriteFile(page+".gz", gzipBytes([]byte("预压缩")), 0644)
+	if w := get(router, "/page-0.html", "gzip"); w.Header().Get("Content-Encoding") != "gzip" || string(gunzip(t, w.Body.Bytes())) != "预压缩" {
+		t.Errorf("应提供 .gz 预压缩副本，得到 %q", w.Header().Get("Content-Encoding"))
+	}
+	os.WriteFile(page+".br", []byte("brotli"), 0644)
+	if w := get(router, "/page-0.html", "gzip, br"); w.Header().Get("Content-Encoding") != "br" || w.Body.String() != "brotli" {
+		t.Errorf("应提供 .br 预压缩副本，得到 %q", w.Header().Get("Content-Encoding"))
+	}
+	w := get(router, "/page-0.html", "")
+	if w.Header().Get("Content-Encoding") != "" || !bytes.Equal(w.Body.Bytes(), original) {
+		t.Error("不接受压缩时应返回原文件")
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary 为 %q", w.Header().Get("Vary"))
+	}
+
+	// 开发模式即时压缩，Content-Type 不变
+	mem := newTestSite(t, src, filepath.Join(t.TempDir(), "mem"), 2)
+	mem.memory = true
+	mem.Config.Paginate = 10
+	if err := mem.Build(); err != nil {
+		t.Fatal(err)
+	}
+	// 后台索引完成时标签云变化，读取标签的首页会重新渲染，因此先等待索引
+	waitForIndex(t, mem)
+	memRouter := mem.newRouter(nil)
+	plain := get(memRouter, "/", "")
+	gz := get(memRouter, "/", "gzip")
+	if gz.Header().Get("Content-Encoding") != "gzip" || gz.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("应即时 gzip 压缩: %q %q", gz.Header().Get("Content-Encoding"), gz.Header().Get("Content-Type"))
+	}
+	if !bytes.Equal(gunzip(t, gz.Body.Bytes()), plain.Body.Bytes()) {
+		t.Error("即时压缩的内容与原内容不一致")
+	}
+	if gz.Header().Get("ETag") == plain.Header().Get("ETag") {
+		t.Error("压缩后的响应应有不同的 ETag")
+	}
+}
+
+func TestChineseMirror(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"_posts/2024-01-01-a.md": "---\ntitle: 开发服务器\n---\n简体正文，[链接](/关于.html)。\n\n```go\n// 简体注释\n```\n\n行内 `简体代码`。\n",
+		"about.md":               "---\ntitle: 关于\n---\n关于本站。\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	s.Config.Title, s.Config.URL, s.Config.ChineseMirror = "简体博客", "https://example.com", "zh-hant"
+	s.Config.Paginate = 10
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	snap := s.Snapshot()
+	ms := snap.sites[len(snap.sites)-1]
+	if ms.mirror == nil || len(ms.Posts) != 1 || len(ms.Pages) != 1 {
+		t.Fatalf("镜像子站点为 %+v", ms.mirror)
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	route := ms.Posts[0].extractRelativeURL()
+	if !strings.HasPrefix(route, "/zh-hant/") {
+		t.Fatalf("镜像文章的路径为 %s", route)
+	}
+	post := read(route)
+	for _, want := range []string{
+		`<html lang="zh-Hant">`,
+		"<h1>開發服務器</h1>",
+		"簡體正文",
+		`href="/%E5%85%B3%E4%BA%8E.html"`, // URL 不转换
+		"// 简体注释",                         // 代码块不转换
+		"<code>简体代码</code>",
+		`<link rel="alternate" hreflang="zh-CN" href="https://example.com` + strings.TrimPrefix(route, "/zh-hant") + `">`,
+		`<link rel="alternate" hreflang="zh-Hant" href="https://example.com` + route + `">`,
+		`lang="zh-CN">简体中文</a>`, // 切换到原站点的链接保持原文
+	} {
+		if !strings.Contains(post, want) {
+			t.Errorf("镜像文章缺少 %s", want)
+		}
+	}
+	if original := read(strings.TrimPrefix(route, "/zh-hant")); !strings.Contains(original, `lang="zh-Hant">繁體中文</a>`) || !strings.Contains(original, "<h1>开发服务器</h1>") {
+		t.Error("原文章应保持简体并链接到镜像")
+	}
+	if page := read("zh-hant/about.html"); !strings.Contains(page, "<title>關於 - 簡體博客</title>") || !strings.Contains(page, `hreflang="zh-CN" href="https://example.com/about.html"`) {
+		t.Error("镜像页面不正确")
+	}
+	if index := read("zh-hant/index.html"); !strings.Contains(index, `hreflang="zh-CN" href="https://example.com/"`) || !strings.Contains(index, "簡體博客") {
+		t.Error("镜像首页不正确")
+	}
+	if !strings.Contains(read("sitemap.xml"), "https://example.com/zh-hant/about.html") {
+		t.Error("Sitemap 应包含镜像页面")
+	}
+
+	m := &chineseMirror{Lang: "zh-Hant", traditional: true}
+	for in, want := range map[string]string{
+		`<p title="简体">简体</p>`:                                                         `<p title="簡體">簡體</p>`,
+		`<script>var s = "简体";</script>后`:                                              `<script>var s = "简体";</script>後`,
+		`<span lang="zh-CN">简体<b>简体</b></span>简体`:                                      `<span lang="zh-CN">简体<b>简体</b></span>簡體`,
+		`<pre><code>简体<code>简体</code>简体</code></pre>简体`:                                `<pre><code>简体<code>简体</code>简体</code></pre>簡體`,
+		`<meta name="description" content="简体"><meta property="og:url" content="/简体">`: `<meta name="description" content="簡體"><meta property="og:url" content="/简体">`,
+		`<img alt="简体" src="/简体.png"><!-- 简体 -->a < b`:                                 `<img alt="簡體" src="/简体.png"><!-- 简体 -->a < b`,
+	} {
+		if got := m.convertHTML(in); got != want {
+			t.Errorf("convertHTML(%s) = %s，期望 %s", in, got, want)
+		}
+	}
+
+	cfg := *s.Config
+	cfg.DefaultLang = "zh-TW"
+	cfg.ChineseMirror = "auto"
+	if m := cfg.chineseMirror(); m == nil || m.Prefix != "/zh-hans" || m.traditional {
+		t.Errorf("繁体站点的自动镜像为 %+v", m)
+	}
+	cfg.ChineseMirror = "zh-hk"
+	if cfg.validate() == nil {
+		t.Error("无效的 chinese_mirror 应校验失败")
+	}
+}
+
+func TestPostTitlesKeepScript(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"_posts/2024-01-01-a.md": "---\ntitle: 開發環境指南\n---\n繁體正文。\n",
+		"_posts/2024-01-02-b.md": "---\ntitle: 環境設定\nsimplify: true\n---\n繁體正文。\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(simplify bool) (*Site, func(string) string) {
+		dest := filepath.Join(t.TempDir(), "out")
+		s := newTestSite(t, src, dest, 2)
+		s.Config.URL, s.Config.SimplifyTitles = "https://example.com", simplify
+		if err := s.Build(); err != nil {
+			t.Fatal(err)
+		}
+		return s, func(name string) string {
+			data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+
+	s, read := build(false)
+	titles := map[string]*Post{}
+	for _, p := range s.Snapshot().Posts {
+		titles[p.Title] = p
+	}
+	a, b := titles["開發環境指南"], titles["环境设定"]
+	if a == nil || b == nil {
+		t.Fatalf("文章标题为 %v", titles)
+	}
+	if a.SearchTitle != "开发环境指南" || b.SearchTitle != "环境设定" {
+		t.Errorf("标签云用的简体副本为 %q、%q", a.SearchTitle, b.SearchTitle)
+	}
+	if post := read(a.extractRelativeURL()); !strings.Contains(post, "開發環境指南") {
+		t.Error("文章页面应保持繁体标题")
+	}
+	feed := read("feed.xml")
+	if !strings.Contains(feed, "開發環境指南") || !strings.Contains(feed, "环境设定") {
+		t.Errorf("RSS 的标题不正确:\n%s", feed)
+	}
+	// 标签云来自简体副本，繁体标题的文章仍归到简体标签下
+	tags := read("tags/index.html")
+	group := tags[strings.Index(tags, `id="环境"`):]
+	if !strings.Contains(group, "開發環境指南") || !strings.Contains(group, "环境设定") {
+		t.Errorf("标签页面不正确:\n%s", tags)
+	}
+
+	s, read = build(true)
+	titles = map[string]*Post{}
+	for _, p := range s.Snapshot().Posts {
+		titles[p.Title] = p
+	}
+	if titles["开发环境指南"] == nil || titles["环境设定"] == nil {
+		t.Errorf("simplify_titles 时文章标题为 %v", titles)
+	}
+	os.WriteFile(filepath.Join(src, "_posts/2024-01-02-b.md"), []byte("---\ntitle: 環境設定\nsimplify: false\n---\n繁體正文。\n"), 0644)
+	s, _ = build(true)
+	titles = map[string]*Post{}
+	for _, p := range s.Snapshot().Posts {
+		titles[p.Title] = p
+	}
+	if titles["开发环境指南"] == nil || titles["環境設定"] == nil {
+		t.Errorf("前置数据 simplify: false 时文章标题为 %v", titles)
+	}
+}
+
+func TestTemplateErrorLocations(t *testing.T) {
+	build := func(files map[string]string) error {
+		src := t.TempDir()
+		writeFiles(t, src, files)
+		return newTestSite(t, src, filepath.Join(t.TempDir(), "out"), 1).Build()
+	}
+
+	// 多个布局的解析错误在一次构建中全部报告，位置映射回各自的源文件
+	err := build(map[string]string{
+		"_layouts/bad.html":  "<html>\n{{ if }}\n</html>\n",
+		"_layouts/bad2.html": "<p>\n</p>\n{{ end }}\n",
+		"index.md":           "---\ntitle: 首页\n---\n正文\n",
+	})
+	if err == nil {
+		t.Fatal("模板解析错误应使构建失败")
+	}
+	for _, want := range []string{
+		"2 个模板解析失败",
+		"_layouts/bad.html:2: missing value for if",
+		"> 2 | {{ if }}",
+		"_layouts/bad2.html:3: unexpected {{end}}",
+		"> 3 | {{ end }}",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("解析错误缺少 %q:\n%v", want, err)
+		}
+	}
+	var te *TemplateError
+	if !errors.As(err, &te) || te.File != "_layouts/bad.html" || te.Line != 2 || te.Col != 0 {
+		t.Errorf("第一个解析错误为 %+v", te)
+	}
+
+	// include 去除 define 包装后的执行错误映射回包含文件的行列，并用 ^ 标出列
+	err = build(map[string]string{
+		"_layouts/page.html": "<html>\n{{ include \"hdr\" }}\n</html>\n",
+		"_includes/hdr.html": "{{ define \"hdr\" }}<header>\n  <h1>标题</h1>\n  <p>{{ index .site 5 }}</p>\n</header>{{ end }}\n",
+		"index.md":           "---\ntitle: 首页\nlayout: page\n---\n正文\n",
+	})
+	if !errors.As(err, &te) || te.File != "_includes/hdr.html" || te.Line != 3 || te.Col != 8 {
+		t.Fatalf("包含文件的执行错误为 %+v: %v", te, err)
+	}
+	for _, want := range []string{
+		"_layouts/page.html:2:3: executing \"page\"",
+		"_includes/hdr.html:3:8: executing \"hdr\" at <index .site 5>",
+		"> 3 |   <p>{{ index .site 5 }}</p>\n    |         ^",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("执行错误缺少 %q:\n%v", want, err)
+		}
+	}
+
+	// 与 define 同一行的错误，列号加上被去除的前缀长度
+	err = build(map[string]string{
+		"_layouts/page.html": "<html>{{ include \"hdr\" }}</html>\n",
+		"_includes/hdr.html": "{{ define \"hdr\" }}<p>{{ index .site 5 }}</p>{{ end }}\n",
+		"index.md":           "---\ntitle: 首页\nlayout: page\n---\n正文\n",
+	})
+	if !errors.As(err, &te) || te.Line != 1 || te.Col != 24 {
+		t.Errorf("第一行的执行错误为 %+v: %v", te, err)
+	}
+
+	if got := sourceExcerpt("a\n\tb c\nd", 2, 3, 1); got != "  1 | a\n> 2 | \tb c\n    | \t  ^\n  3 | d" {
+		t.Errorf("sourceExcerpt = %q", got)
+	}
+}
+
+func TestThemeLayers(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"themes/house/_layouts/page.html":     "主题页面 {{ .page.Title }}",
+		"themes/house/_layouts/post.html":     "主题文章 {{ .post.Title }}",
+		"themes/house/stylesheets/site.css":   "/* 主题样式 */",
+		"themes/house/_includes/sidebar.html": "主题侧栏",
+		"_layouts/post.html":                  "站点文章 {{ .post.Title }}",
+		"_posts/2024-01-01-a.md":              "---\ntitle: 文章\n---\n正文\n",
+		"about.md":                            "---\ntitle: 关于\nlayout: page\n---\n正文\n",
+	})
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 1)
+	s.Config.Theme, s.Config.Paginate = "house", 10
+
+	// 同名文件按 站点 > 主题 > 内置主题 的顺序取用
+	files, err := s.walkLayered(s.Config.LayoutsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := map[string]string{}
+	for _, f := range files {
+		layers[f.Name] = f.Layer.Name
+	}
+	for name, want := range map[string]string{
+		"_layouts/post.html":  "站点",
+		"_layouts/page.html":  "主题 house",
+		"_layouts/index.html": "内置主题",
+	} {
+		if layers[name] != want {
+			t.Errorf("%s 来自 %q，期望 %q", name, layers[name], want)
+		}
+	}
+
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	out := readTree(t, dest)
+	if got := string(out["about.html"]); got != "主题页面 关于" {
+		t.Errorf("页面使用了 %q", got)
+	}
+	post := strings.TrimPrefix(s.Snapshot().Posts[0].extractRelativeURL(), "/")
+	if got := string(out[filepath.FromSlash(post)]); got != "站点文章 文章" {
+		t.Errorf("文章使用了 %q", got)
+	}
+	if got := string(out[filepath.Join("stylesheets", "site.css")]); got != "/* 主题样式 */" {
+		t.Errorf("样式表为 %q", got)
+	}
+	if index := string(out["index.html"]); !strings.Contains(index, "主题侧栏") || !strings.Contains(index, "<!DOCTYPE html>") {
+		t.Errorf("首页应使用内置布局和主题的包含文件:\n%s", index)
+	}
+	for _, name := range []string{"_layouts", "themes"} {
+		if _, ok := out[name]; ok {
+			t.Errorf("不应输出 %s", name)
+		}
+	}
+
+	// theme new 生成主题骨架，已存在时报错
+	if err := createNewTheme("shop", s.Config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "themes", "shop", "_layouts", "post.html")); err != nil {
+		t.Error(err)
+	}
+	if createNewTheme("shop", s.Config) == nil || createNewTheme("../x", s.Config) == nil {
+		t.Error("已存在或无效的主题名称应报错")
+	}
+
+	// eject 复制内置主题的文件，保留站点中已有的同名文件
+	ejected := t.TempDir()
+	writeFiles(t, ejected, map[string]string{"_layouts/post.html": "自定义"})
+	cfg := *s.Config
+	cfg.Source = ejected
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	err = ejectDefaultTheme(&cfg)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readTree(t, ejected)
+	if string(got[filepath.Join("_layouts", "post.html")]) != "自定义" {
+		t.Error("eject 不应覆盖已存在的文件")
+	}
+	want, err := defaultThemeFS.ReadFile(defaultThemeRoot + "/_layouts/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[filepath.Join("_layouts", "page.html")], want) || got[filepath.Join("stylesheets", "site.css")] == nil {
+		t.Error("eject 应复制内置主题的文件")
+	}
+}
+
+func TestBareDirectoryUsesEmbeddedTheme(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_posts/2024-01-01-a.md": "---\ntitle: 第一篇\n---\n正文\n",
+	})
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	out := readTree(t, dest)
+
+	post := strings.TrimPrefix(s.Snapshot().Posts[0].extractRelativeURL(), "/")
+	if html := string(out[filepath.FromSlash(post)]); !strings.Contains(html, "<!DOCTYPE html>") || !strings.Contains(html, "第一篇") {
+		t.Errorf("文章应使用内置布局渲染:\n%s", html)
+	}
+	want, err := defaultThemeFS.ReadFile(defaultThemeRoot + "/stylesheets/site.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[filepath.Join("stylesheets", "site.css")], want) {
+		t.Error("应输出内置主题的样式表")
+	}
+	if _, ok := out[filepath.Join("archives", "index.html")]; !ok {
+		t.Error("应输出归档页面")
+	}
+
+	// 未设置 paginate 时不分页，与内置主题无关
+	if _, ok := out["index.html"]; ok {
+		t.Error("未设置 paginate 时不应生成分页首页")
+	}
+	s.Config.PaginatePath = ""
+	if got := s.paginationRoute(1); got != "/page/2/index.html" {
+		t.Errorf("默认分页路径为 %s", got)
+	}
+}
+
+func TestMultilingualPagination(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{}
+	for i := 1; i <= 5; i++ {
+		files[fmt.Sprintf("_posts/2024-01-%02d-p%d.md", i, i)] = fmt.Sprintf("---\ntitle: 文章 %d\n---\n正文\n", i)
+		files[fmt.Sprintf("_posts/2024-01-%02d-p%d.en.md", i, i)] = fmt.Sprintf("---\ntitle: Post %d\n---\nBody\n", i)
+	}
+	writeFiles(t, src, files)
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	s.Config.Languages = map[string]*Language{"zh-CN": {Name: "中文"}, "en": {Name: "English"}}
+	s.Config.Paginate, s.Config.PaginatePath = 2, "p"
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// 分页链接带有语言前缀并使用 paginate_path，与输出路径一致
+	for name, links := range map[string][]string{
+		"index.html":        {`href="/p/2/"`},
+		"p/3/index.html":    {`href="/p/2/"`},
+		"en/index.html":     {`href="/en/p/2/"`},
+		"en/p/2/index.html": {`href="/en/"`, `href="/en/p/3/"`},
+		"en/p/3/index.html": {`href="/en/p/2/"`},
+	} {
+		html := read(name)
+		for _, link := range links {
+			if !strings.Contains(html, link) {
+				t.Errorf("%s 缺少分页链接 %s", name, link)
+			}
+		}
+		if strings.Contains(html, `href="/page/`) {
+			t.Errorf("%s 包含默认分页路径的链接", name)
+		}
+	}
+	if html := read("en/p/2/index.html"); !strings.Contains(html, "Post 3") || strings.Contains(html, "文章") {
+		t.Errorf("英文第 2 页的文章不正确:\n%s", html)
+	}
+}
+
+func TestLanguageSuffixAndTranslations(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_layouts/page.html":            "<html><head><title>{{ .page.Title }}</title></head><body>{{ t \"greeting\" }}|{{ t \"home\" }}|{{ t \"missing_key\" }}</body></html>",
+		"_i18n/zh-CN.yml":               "greeting: 你好\n",
+		"_i18n/en.yml":                  "farewell: Bye\n",
+		"about.md":                      "---\ntitle: 关于\nlayout: page\n---\n正文\n",
+		"about.en.md":                   "---\ntitle: About\nlayout: page\n---\nBody\n",
+		"_posts/2024-01-01-hello.md":    "---\ntitle: 你好\n---\n正文\n",
+		"_posts/2024-01-01-hello.en.md": "---\ntitle: Hello\n---\nBody\n",
+		"_posts/2024-01-02-only.md":     "---\ntitle: 仅中文\n---\n正文\n",
+	})
+	dest := filepath.Join(t.TempDir(), "out")
+	s := newTestSite(t, src, dest, 2)
+	s.Config.URL = "https://example.com"
+	s.Config.Languages = map[string]*Language{"zh-CN": {Name: "中文"}, "en": {Name: "English"}}
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// 文件名后缀决定语言，非默认语言的输出带有语言前缀
+	routes := map[string]string{}
+	for _, p := range s.Snapshot().Posts {
+		routes[p.Title] = p.extractRelativeURL()
+	}
+	if !strings.HasPrefix(routes["Hello"], "/en/") || strings.HasPrefix(routes["你好"], "/en/") {
+		t.Fatalf("文章路径为 %v", routes)
+	}
+
+	// 当前语言缺少的翻译回退到默认语言，都没有时显示键名
+	if got := read("en/about.html"); !strings.Contains(got, "你好|Home|missing_key") {
+		t.Errorf("英文页面的翻译不正确:\n%s", got)
+	}
+	if got := read("about.html"); !strings.Contains(got, "你好|首页|missing_key") {
+		t.Errorf("中文页面的翻译不正确:\n%s", got)
+	}
+
+	// 互为翻译的页面和文章彼此带有 hreflang 链接，没有翻译的文章不带
+	zh := `<link rel="alternate" hreflang="zh-CN" href="https://example.com%s">`
+	en := `<link rel="alternate" hreflang="en" href="https://example.com%s">`
+	for _, pair := range [][2]string{
+		{"/about.html", "/en/about.html"},
+		{routes["你好"], routes["Hello"]},
+	} {
+		for _, name := range pair {
+			html := read(name)
+			if !strings.Contains(html, fmt.Sprintf(zh, pair[0])) || !strings.Contains(html, fmt.Sprintf(en, pair[1])) {
+				t.Errorf("%s 缺少 hreflang 链接:\n%s", name, html)
+			}
+		}
+	}
+	if html := read(routes["仅中文"]); strings.Contains(html, "hreflang") {
+		t.Errorf("没有翻译的文章不应带 hreflang 链接")
+	}
+}